@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/backup"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+)
+
+// runBackup writes the archive of the configured storage to the file, "-" is the standard output.
+// A failed archive is removed, failing to remove it is logged.
+func runBackup(ctx context.Context, logg *logger.Logger, config StorageConf, path string) (backup.Stats, error) {
+	s, closeStorage, err := openBackupStorage(ctx, logg, config)
+	if err != nil {
+		return backup.Stats{}, err
+	}
+	defer closeStorage()
+
+	if path == "-" {
+		return backup.Backup(ctx, s, os.Stdout, time.Now())
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return backup.Stats{}, err
+	}
+	stats, err := backup.Backup(ctx, s, f, time.Now())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if removeErr := os.Remove(path); removeErr != nil {
+			logg.Error("failed to remove incomplete archive: " + removeErr.Error())
+		}
+	}
+	return stats, err
+}
+
+// runRestore loads the archive from the file, "-" is the standard input, into the configured storage.
+func runRestore(ctx context.Context, logg *logger.Logger, config StorageConf, path string) (backup.Stats, error) {
+	s, closeStorage, err := openBackupStorage(ctx, logg, config)
+	if err != nil {
+		return backup.Stats{}, err
+	}
+	defer closeStorage()
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return backup.Stats{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return backup.Restore(ctx, s, r)
+}
+
+// openBackupStorage connects to the storage bypassing the cache. The memory storage lives only as long
+// as the process, so there is nothing to back up or restore into.
+func openBackupStorage(ctx context.Context, logg *logger.Logger, config StorageConf) (backup.Storage, func(), error) {
+	if config.Type == storageMemory {
+		return nil, nil, errors.New("backup needs the sql or sqlite storage")
+	}
+	s, err := openStorage(ctx, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeStorage := func() {
+		if closer, ok := s.(interface{ Close(context.Context) error }); ok {
+			if err := closer.Close(ctx); err != nil {
+				logg.Error("failed to close storage: " + err.Error())
+			}
+		}
+	}
+	backupStorage, ok := s.(backup.Storage)
+	if !ok {
+		closeStorage()
+		return nil, nil, fmt.Errorf("storage %q does not support backups", config.Type)
+	}
+	return backupStorage, closeStorage, nil
+}
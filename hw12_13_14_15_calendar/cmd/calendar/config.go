@@ -1,20 +1,123 @@
 package main
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
 // При желании конфигурацию можно вынести в internal/config.
 // Организация конфига в main принуждает нас сужать API компонентов, использовать
 // при их конструировании только необходимые параметры, а также уменьшает вероятность циклической зависимости.
 type Config struct {
-	Logger LoggerConf
-	// TODO
+	Logger    LoggerConf
+	App       AppConf
+	Storage   StorageConf
+	HTTP      HTTPConf
+	GRPC      GRPCConf
+	TLS       TLSConf
+	Auth      AuthConf
+	RateLimit RateLimitConf
+	Debug     DebugConf
+	Shutdown  ShutdownConf
 }
 
 type LoggerConf struct {
 	Level string
-	// TODO
 }
 
-func NewConfig() Config {
-	return Config{}
+type AppConf struct {
+	IdempotencyTTL time.Duration `toml:"idempotency_ttl"`
+}
+
+type StorageConf struct {
+	Type  string // memory, sql or sqlite.
+	DSN   string // Postgres connection string or SQLite database file.
+	Cache StorageCacheConf
+}
+
+// StorageCacheConf sets how many event lists are cached and for how long, zero capacity disables the cache.
+// It is off by default and only used with the sql and sqlite storages.
+type StorageCacheConf struct {
+	Capacity int
+	TTL      time.Duration
+}
+
+type HTTPConf struct {
+	Host string
+	Port string
+}
+
+type GRPCConf struct {
+	Host string
+	Port string
+}
+
+// TLSConf enables TLS on both the HTTP and gRPC servers once the certificate and key are set.
+// The files are reloaded when they change. With ClientCAFile set, clients have to present a certificate
+// issued by one of its CAs.
+type TLSConf struct {
+	CertFile     string `toml:"cert_file"`
+	KeyFile      string `toml:"key_file"`
+	ClientCAFile string `toml:"client_ca_file"`
 }
 
-// TODO
+type AuthConf struct {
+	Mode   string // header or jwt.
+	Header string
+	JWT    JWTConf
+}
+
+type JWTConf struct {
+	Algorithm string // HS256 or RS256.
+	KeyFile   string `toml:"key_file"`
+	Issuer    string
+	Audience  string
+}
+
+// RateLimitConf sets requests per second with the given burst, zero rate disables the limit.
+type RateLimitConf struct {
+	UserRate  float64 `toml:"user_rate"`
+	UserBurst int     `toml:"user_burst"`
+	IPRate    float64 `toml:"ip_rate"`
+	IPBurst   int     `toml:"ip_burst"`
+}
+
+// DebugConf enables the listener serving pprof, goroutine dumps and the build info. It has no authentication,
+// so it should listen on a loopback or otherwise private address.
+type DebugConf struct {
+	Enabled bool
+	Host    string
+	Port    string
+}
+
+// ShutdownConf limits how long the process waits for the work in progress to finish on shutdown
+// and then for the connections to be closed.
+type ShutdownConf struct {
+	DrainTimeout time.Duration `toml:"drain_timeout"`
+	CloseTimeout time.Duration `toml:"close_timeout"`
+}
+
+func NewConfig(path string) (Config, error) {
+	config := Config{
+		Logger:  LoggerConf{Level: "INFO"},
+		App:     AppConf{IdempotencyTTL: 24 * time.Hour},
+		Storage: StorageConf{Type: storageMemory, Cache: StorageCacheConf{TTL: 30 * time.Second}},
+		HTTP:    HTTPConf{Host: "0.0.0.0", Port: "8080"},
+		GRPC:    GRPCConf{Host: "0.0.0.0", Port: "50051"},
+		Auth:    AuthConf{Mode: authHeader, Header: "X-User-ID"},
+		RateLimit: RateLimitConf{
+			UserRate:  10,
+			UserBurst: 20,
+			IPRate:    50,
+			IPBurst:   100,
+		},
+		Debug:    DebugConf{Host: "127.0.0.1", Port: "6060"},
+		Shutdown: ShutdownConf{DrainTimeout: 15 * time.Second, CloseTimeout: 5 * time.Second},
+	}
+	if _, err := toml.DecodeFile(path, &config); err != nil {
+		return Config{}, fmt.Errorf("decode config %s: %w", path, err)
+	}
+	return config, nil
+}
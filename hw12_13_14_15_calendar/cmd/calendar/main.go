@@ -2,16 +2,39 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
 	"flag"
+	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
+	_ "time/tzdata" // Working hours time zones, the alpine image has no zoneinfo.
 
 	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/lifecycle"
 	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ratelimit"
+	internaldebug "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/debug"
+	internalgrpc "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/grpc"
 	internalhttp "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/http"
+	cachestorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/cache"
 	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	sqlstorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/sql"
+	sqlitestorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/sqlite"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/calendartls"
+)
+
+const (
+	storageMemory = "memory"
+	storageSQL    = "sql"
+	storageSQLite = "sqlite"
+
+	authHeader = "header"
+	authJWT    = "jwt"
 )
 
 var configFile string
@@ -28,34 +51,158 @@ func main() {
 		return
 	}
 
-	config := NewConfig()
+	config, err := NewConfig(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	logg := logger.New(config.Logger.Level)
 
-	storage := memorystorage.New()
-	calendar := app.New(logg, storage)
-
-	server := internalhttp.NewServer(logg, calendar)
-
 	ctx, cancel := signal.NotifyContext(context.Background(),
 		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	defer cancel()
 
-	go func() {
-		<-ctx.Done()
+	switch command := flag.Arg(0); command {
+	case "backup", "restore":
+		if flag.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "usage: calendar [-config FILE] %s ARCHIVE|-\n", command)
+			cancel()
+			os.Exit(2) //nolint:gocritic
+		}
+		// The archive may go to the standard output.
+		logg = logger.NewWithWriter(config.Logger.Level, os.Stderr)
+		run := runBackup
+		if command == "restore" {
+			run = runRestore
+		}
+		stats, err := run(ctx, logg, config.Storage, flag.Arg(1))
+		if err != nil {
+			logg.Error(command + " failed: " + err.Error())
+			cancel()
+			os.Exit(1)
+		}
+		logg.Info(fmt.Sprintf("%s done: %d user settings, %d tags, %d events",
+			command, stats.Settings, stats.Tags, stats.Events))
+		return
+	}
+
+	storage, err := newStorage(ctx, config.Storage)
+	if err != nil {
+		logg.Error("failed to init storage: " + err.Error())
+		cancel()
+		os.Exit(1)
+	}
+	calendar := app.New(logg, storage, config.App.IdempotencyTTL)
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-		defer cancel()
+	authenticator, err := newAuthenticator(config.Auth)
+	if err != nil {
+		logg.Error("failed to init authentication: " + err.Error())
+		cancel()
+		os.Exit(1)
+	}
 
-		if err := server.Stop(ctx); err != nil {
-			logg.Error("failed to stop http server: " + err.Error())
-		}
-	}()
+	limiter := ratelimit.New(config.RateLimit.UserRate, config.RateLimit.UserBurst,
+		config.RateLimit.IPRate, config.RateLimit.IPBurst)
+
+	tlsConfig, err := newTLSConfig(logg, config.TLS)
+	if err != nil {
+		logg.Error("failed to init tls: " + err.Error())
+		cancel()
+		os.Exit(1)
+	}
+
+	grpcServer := internalgrpc.NewServer(logg, calendar,
+		net.JoinHostPort(config.GRPC.Host, config.GRPC.Port), authenticator, limiter, tlsConfig)
+	gateway, err := grpcServer.Gateway(ctx, config.Auth.Header)
+	if err != nil {
+		logg.Error("failed to init grpc gateway: " + err.Error())
+		cancel()
+		os.Exit(1)
+	}
+
+	// The stats are served by the debug server at /debug/vars.
+	if cache, ok := storage.(*cachestorage.Storage); ok {
+		expvar.Publish("storage_cache", expvar.Func(func() interface{} { return cache.Stats() }))
+	}
+
+	lc := lifecycle.New(logg, config.Shutdown.DrainTimeout, config.Shutdown.CloseTimeout)
+	lc.Add("http server", internalhttp.NewServer(logg,
+		net.JoinHostPort(config.HTTP.Host, config.HTTP.Port), gateway, tlsConfig))
+	lc.Add("grpc server", grpcServer)
+	if config.Debug.Enabled {
+		lc.Add("debug server", internaldebug.NewServer(logg,
+			net.JoinHostPort(config.Debug.Host, config.Debug.Port), buildInfo()))
+	}
+	if closer, ok := storage.(interface{ Close(context.Context) error }); ok {
+		lc.AddCloser("storage", closer.Close)
+	}
 
 	logg.Info("calendar is running...")
 
-	if err := server.Start(ctx); err != nil {
-		logg.Error("failed to start http server: " + err.Error())
+	if err := lc.Run(ctx); err != nil {
 		cancel()
-		os.Exit(1) //nolint:gocritic
+		os.Exit(1)
+	}
+}
+
+// newStorage wraps the sql and sqlite storages with the cache if it is enabled, the memory one is fast enough.
+func newStorage(ctx context.Context, config StorageConf) (app.Storage, error) {
+	storage, err := openStorage(ctx, config)
+	if err != nil || config.Cache.Capacity <= 0 || config.Type == storageMemory {
+		return storage, err
+	}
+	return cachestorage.New(storage, config.Cache.Capacity, config.Cache.TTL), nil
+}
+
+func openStorage(ctx context.Context, config StorageConf) (app.Storage, error) {
+	switch config.Type {
+	case storageMemory:
+		return memorystorage.New(), nil
+	case storageSQL:
+		storage := sqlstorage.New(config.DSN)
+		if err := storage.Connect(ctx); err != nil {
+			return nil, err
+		}
+		return storage, nil
+	case storageSQLite:
+		storage := sqlitestorage.New(config.DSN)
+		if err := storage.Connect(ctx); err != nil {
+			return nil, err
+		}
+		return storage, nil
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", config.Type)
+	}
+}
+
+// newTLSConfig returns nil, i.e. plaintext, unless the certificate is set. The files failing to reload
+// are logged, the previous certificate and CAs stay in use.
+func newTLSConfig(logg *logger.Logger, config TLSConf) (*tls.Config, error) {
+	serverConfig := calendartls.ServerConfig{
+		CertFile:     config.CertFile,
+		KeyFile:      config.KeyFile,
+		ClientCAFile: config.ClientCAFile,
+		OnReloadError: func(err error) {
+			logg.Warn("failed to reload tls files: " + err.Error())
+		},
+	}
+	if !serverConfig.Enabled() {
+		if config.ClientCAFile != "" {
+			return nil, errors.New("client_ca_file requires cert_file and key_file")
+		}
+		return nil, nil
+	}
+	return serverConfig.TLSConfig()
+}
+
+func newAuthenticator(config AuthConf) (auth.Authenticator, error) {
+	switch config.Mode {
+	case authHeader:
+		return auth.NewHeaderAuthenticator(config.Header), nil
+	case authJWT:
+		return auth.NewJWTAuthenticator(config.JWT.Algorithm, config.JWT.KeyFile,
+			config.JWT.Issuer, config.JWT.Audience)
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", config.Mode)
 	}
 }
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+
+	internaldebug "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/debug"
 )
 
 var (
@@ -12,16 +14,16 @@ var (
 	gitHash   = "UNKNOWN"
 )
 
-func printVersion() {
-	if err := json.NewEncoder(os.Stdout).Encode(struct {
-		Release   string
-		BuildDate string
-		GitHash   string
-	}{
+func buildInfo() internaldebug.BuildInfo {
+	return internaldebug.BuildInfo{
 		Release:   release,
 		BuildDate: buildDate,
 		GitHash:   gitHash,
-	}); err != nil {
+	}
+}
+
+func printVersion() {
+	if err := json.NewEncoder(os.Stdout).Encode(buildInfo()); err != nil {
 		fmt.Printf("error while decode version info: %v\n", err)
 	}
 }
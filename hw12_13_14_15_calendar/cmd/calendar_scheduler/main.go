@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	_ "time/tzdata" // Digest time zones, the alpine image has no zoneinfo.
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/lifecycle"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue/rabbit"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	internaldebug "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/debug"
+	sqlstorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/sql"
+	sqlitestorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/sqlite"
+)
+
+const (
+	storageSQL    = "sql"
+	storageSQLite = "sqlite"
+)
+
+var configFile string
+
+func init() {
+	flag.StringVar(&configFile, "config", "/etc/calendar/scheduler_config.toml", "Path to configuration file")
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.Arg(0) == "version" {
+		printVersion()
+		return
+	}
+
+	config, err := NewConfig(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logg := logger.New(config.Logger.Level)
+
+	ctx, cancel := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer cancel()
+
+	lc := lifecycle.New(logg, config.Shutdown.DrainTimeout, config.Shutdown.CloseTimeout)
+
+	storage, err := newStorage(ctx, config.Storage)
+	if err != nil {
+		logg.Error("failed to init storage: " + err.Error())
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+	lc.AddCloser("storage", storage.Close)
+
+	publisher := rabbit.New(config.Queue.URI, config.Queue.Name)
+	if err := publisher.Connect(ctx); err != nil {
+		logg.Error("failed to connect to queue: " + err.Error())
+		cancel()
+		storage.Close(context.Background())
+		os.Exit(1)
+	}
+	lc.AddCloser("queue", func(context.Context) error { return publisher.Close() })
+
+	lc.Add("scheduler", scheduler.New(logg, storage, publisher, config.Scheduler.Interval,
+		config.Scheduler.EventRetention, config.Scheduler.TrashRetention, config.Scheduler.DigestAt))
+	if config.Debug.Enabled {
+		lc.Add("debug server", internaldebug.NewServer(logg,
+			net.JoinHostPort(config.Debug.Host, config.Debug.Port), buildInfo()))
+	}
+
+	logg.Info("scheduler is running...")
+
+	if err := lc.Run(ctx); err != nil {
+		cancel()
+		os.Exit(1)
+	}
+}
+
+type closableStorage interface {
+	scheduler.Storage
+	Close(ctx context.Context) error
+}
+
+func newStorage(ctx context.Context, config StorageConf) (closableStorage, error) {
+	switch config.Type {
+	case storageSQL:
+		storage := sqlstorage.New(config.DSN)
+		if err := storage.Connect(ctx); err != nil {
+			return nil, err
+		}
+		return storage, nil
+	case storageSQLite:
+		storage := sqlitestorage.New(config.DSN)
+		if err := storage.Connect(ctx); err != nil {
+			return nil, err
+		}
+		return storage, nil
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", config.Type)
+	}
+}
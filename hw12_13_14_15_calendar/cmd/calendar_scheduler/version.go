@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	internaldebug "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/debug"
+)
+
+var (
+	release   = "UNKNOWN"
+	buildDate = "UNKNOWN"
+	gitHash   = "UNKNOWN"
+)
+
+func buildInfo() internaldebug.BuildInfo {
+	return internaldebug.BuildInfo{
+		Release:   release,
+		BuildDate: buildDate,
+		GitHash:   gitHash,
+	}
+}
+
+func printVersion() {
+	if err := json.NewEncoder(os.Stdout).Encode(buildInfo()); err != nil {
+		fmt.Printf("error while decode version info: %v\n", err)
+	}
+}
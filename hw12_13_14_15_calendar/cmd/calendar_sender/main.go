@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/lifecycle"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue/rabbit"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/sender"
+	internaldebug "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/debug"
+)
+
+var configFile string
+
+func init() {
+	flag.StringVar(&configFile, "config", "/etc/calendar/sender_config.toml", "Path to configuration file")
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.Arg(0) == "version" {
+		printVersion()
+		return
+	}
+
+	config, err := NewConfig(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logg := logger.New(config.Logger.Level)
+
+	ctx, cancel := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer cancel()
+
+	consumer := rabbit.New(config.Queue.URI, config.Queue.Name)
+	if err := consumer.Connect(ctx); err != nil {
+		logg.Error("failed to connect to queue: " + err.Error())
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+
+	lc := lifecycle.New(logg, config.Shutdown.DrainTimeout, config.Shutdown.CloseTimeout)
+	lc.AddCloser("queue", func(context.Context) error { return consumer.Close() })
+	lc.Add("sender", sender.New(logg, consumer, sender.NewLogNotifier(logg)))
+	if config.Debug.Enabled {
+		lc.Add("debug server", internaldebug.NewServer(logg,
+			net.JoinHostPort(config.Debug.Host, config.Debug.Port), buildInfo()))
+	}
+
+	logg.Info("sender is running...")
+
+	if err := lc.Run(ctx); err != nil {
+		cancel()
+		os.Exit(1)
+	}
+}
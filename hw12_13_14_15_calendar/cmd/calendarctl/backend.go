@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/calendarclient"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/eventpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// backend hides whether the calendar is called over HTTP or gRPC, events are passed as the HTTP client models.
+type backend interface {
+	CreateEvent(ctx context.Context, event calendarclient.Event) (calendarclient.Event, error)
+	UpdateEvent(ctx context.Context, id string, event calendarclient.Event) (calendarclient.Event, error)
+	DeleteEvent(ctx context.Context, id string) error
+	ListEvents(ctx context.Context, period string, date time.Time, shared bool, tag string) ([]calendarclient.Event, error)
+	Close() error
+}
+
+const (
+	periodDay   = "day"
+	periodWeek  = "week"
+	periodMonth = "month"
+)
+
+type httpBackend struct {
+	client *calendarclient.Client
+}
+
+// newHTTPBackend calls the calendar over HTTPS when tlsConfig is set, unless addr has another scheme.
+func newHTTPBackend(addr string, auth authFlags, tlsConfig *tls.Config) *httpBackend {
+	if !strings.Contains(addr, "://") {
+		scheme := "http://"
+		if tlsConfig != nil {
+			scheme = "https://"
+		}
+		addr = scheme + addr
+	}
+	opts := []calendarclient.Option{calendarclient.WithUserHeader(auth.header, auth.userID)}
+	if auth.token != "" {
+		opts[0] = calendarclient.WithBearerToken(auth.token)
+	}
+	if tlsConfig != nil {
+		opts = append(opts, calendarclient.WithTLS(tlsConfig))
+	}
+	return &httpBackend{client: calendarclient.New(addr, opts...)}
+}
+
+func (b *httpBackend) CreateEvent(ctx context.Context, event calendarclient.Event) (calendarclient.Event, error) {
+	return b.client.CreateEvent(ctx, event, "")
+}
+
+func (b *httpBackend) UpdateEvent(
+	ctx context.Context, id string, event calendarclient.Event,
+) (calendarclient.Event, error) {
+	return b.client.UpdateEvent(ctx, id, event)
+}
+
+func (b *httpBackend) DeleteEvent(ctx context.Context, id string) error {
+	return b.client.DeleteEvent(ctx, id)
+}
+
+func (b *httpBackend) ListEvents(
+	ctx context.Context, period string, date time.Time, shared bool, tag string,
+) ([]calendarclient.Event, error) {
+	var opts []calendarclient.ListOption
+	if shared {
+		opts = append(opts, calendarclient.IncludeShared())
+	}
+	if tag != "" {
+		opts = append(opts, calendarclient.WithTag(tag))
+	}
+	switch period {
+	case periodDay:
+		return b.client.ListDayEvents(ctx, date, opts...)
+	case periodWeek:
+		return b.client.ListWeekEvents(ctx, date, opts...)
+	case periodMonth:
+		return b.client.ListMonthEvents(ctx, date, opts...)
+	default:
+		return nil, fmt.Errorf("unknown period %q", period)
+	}
+}
+
+func (b *httpBackend) Close() error {
+	return nil
+}
+
+type grpcBackend struct {
+	conn   *grpc.ClientConn
+	client eventpb.EventServiceClient
+	md     metadata.MD
+}
+
+func newGRPCBackend(addr string, auth authFlags, tlsConfig *tls.Config) (*grpcBackend, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+
+	md := metadata.Pairs(strings.ToLower(auth.header), auth.userID)
+	if auth.token != "" {
+		md = metadata.Pairs("authorization", "Bearer "+auth.token)
+	}
+	return &grpcBackend{
+		conn:   conn,
+		client: eventpb.NewEventServiceClient(conn),
+		md:     md,
+	}, nil
+}
+
+func (b *grpcBackend) CreateEvent(ctx context.Context, event calendarclient.Event) (calendarclient.Event, error) {
+	resp, err := b.client.CreateEvent(b.outgoing(ctx), &eventpb.CreateEventRequest{Event: toEventPB(event)})
+	if err != nil {
+		return calendarclient.Event{}, err
+	}
+	return fromEventPB(resp.GetEvent()), nil
+}
+
+func (b *grpcBackend) UpdateEvent(
+	ctx context.Context, id string, event calendarclient.Event,
+) (calendarclient.Event, error) {
+	resp, err := b.client.UpdateEvent(b.outgoing(ctx), &eventpb.UpdateEventRequest{Id: id, Event: toEventPB(event)})
+	if err != nil {
+		return calendarclient.Event{}, err
+	}
+	return fromEventPB(resp.GetEvent()), nil
+}
+
+func (b *grpcBackend) DeleteEvent(ctx context.Context, id string) error {
+	_, err := b.client.DeleteEvent(b.outgoing(ctx), &eventpb.DeleteEventRequest{Id: id})
+	return err
+}
+
+func (b *grpcBackend) ListEvents(
+	ctx context.Context, period string, date time.Time, shared bool, tag string,
+) ([]calendarclient.Event, error) {
+	list := map[string]func(
+		ctx context.Context, in *eventpb.ListEventsRequest, opts ...grpc.CallOption,
+	) (*eventpb.ListEventsResponse, error){
+		periodDay:   b.client.ListDayEvents,
+		periodWeek:  b.client.ListWeekEvents,
+		periodMonth: b.client.ListMonthEvents,
+	}[period]
+	if list == nil {
+		return nil, fmt.Errorf("unknown period %q", period)
+	}
+
+	resp, err := list(b.outgoing(ctx), &eventpb.ListEventsRequest{
+		Date: timestamppb.New(date), IncludeShared: shared, Tag: tag,
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]calendarclient.Event, 0, len(resp.GetEvents()))
+	for _, pb := range resp.GetEvents() {
+		events = append(events, fromEventPB(pb))
+	}
+	return events, nil
+}
+
+func (b *grpcBackend) Close() error {
+	return b.conn.Close()
+}
+
+func (b *grpcBackend) outgoing(ctx context.Context) context.Context {
+	return metadata.NewOutgoingContext(ctx, b.md)
+}
+
+func toEventPB(event calendarclient.Event) *eventpb.Event {
+	pb := &eventpb.Event{
+		Title:       event.Title,
+		StartAt:     timestamppb.New(event.StartAt),
+		EndAt:       timestamppb.New(event.EndAt),
+		Description: event.Description,
+		UserId:      event.UserID,
+		Kind:        string(event.Kind),
+		Category:    event.Category,
+		Color:       event.Color,
+		Tags:        event.Tags,
+		NoReminders: event.Reminders != nil && len(event.Reminders) == 0,
+		Tentative:   event.Tentative,
+	}
+	for _, before := range event.Reminders {
+		pb.Reminders = append(pb.Reminders, durationpb.New(before))
+	}
+	for _, a := range event.Attendees {
+		pb.Attendees = append(pb.Attendees, &eventpb.Attendee{UserId: a.UserID})
+	}
+	return pb
+}
+
+func fromEventPB(pb *eventpb.Event) calendarclient.Event {
+	event := calendarclient.Event{
+		ID:          pb.GetId(),
+		Title:       pb.GetTitle(),
+		StartAt:     pb.GetStartAt().AsTime(),
+		EndAt:       pb.GetEndAt().AsTime(),
+		Description: pb.GetDescription(),
+		UserID:      pb.GetUserId(),
+		Kind:        calendarclient.EventKind(pb.GetKind()),
+		Category:    pb.GetCategory(),
+		Color:       pb.GetColor(),
+		Tags:        pb.GetTags(),
+		Tentative:   pb.GetTentative(),
+
+		OutsideWorkingHours: pb.GetOutsideWorkingHours(),
+	}
+	for _, before := range pb.GetReminders() {
+		event.Reminders = append(event.Reminders, before.AsDuration())
+	}
+	if pb.GetDeletedAt() != nil {
+		event.DeletedAt = pb.GetDeletedAt().AsTime()
+	}
+	for _, a := range pb.GetAttendees() {
+		event.Attendees = append(event.Attendees, calendarclient.Attendee{
+			UserID: a.GetUserId(),
+			Status: calendarclient.RSVPStatus(a.GetStatus()),
+		})
+	}
+	return event
+}
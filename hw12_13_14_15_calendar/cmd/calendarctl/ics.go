@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/calendarclient"
+)
+
+const icsTimeLayout = "20060102T150405Z"
+
+// writeICS writes the events as an iCalendar (RFC 5545) file, reminders become display alarms.
+func writeICS(w io.Writer, events []calendarclient.Event, now time.Time) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//otus//calendarctl//EN",
+		"CALSCALE:GREGORIAN",
+	}
+	for _, e := range events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+e.ID,
+			"DTSTAMP:"+now.UTC().Format(icsTimeLayout),
+			"DTSTART:"+e.StartAt.UTC().Format(icsTimeLayout),
+			"DTEND:"+e.EndAt.UTC().Format(icsTimeLayout),
+			"SUMMARY:"+escapeICS(e.Title),
+		)
+		if e.Tentative {
+			lines = append(lines, "STATUS:TENTATIVE")
+		}
+		if e.Description != "" {
+			lines = append(lines, "DESCRIPTION:"+escapeICS(e.Description))
+		}
+		if e.UserID != "" {
+			lines = append(lines, "ORGANIZER;CN="+escapeParam(e.UserID)+":urn:calendar:user:"+e.UserID)
+		}
+		for _, a := range e.Attendees {
+			lines = append(lines, "ATTENDEE;CN="+escapeParam(a.UserID)+";PARTSTAT="+partStat(a.Status)+
+				":urn:calendar:user:"+a.UserID)
+		}
+		for _, before := range e.Reminders {
+			lines = append(lines,
+				"BEGIN:VALARM",
+				"ACTION:DISPLAY",
+				"DESCRIPTION:"+escapeICS(e.Title),
+				"TRIGGER:"+icsDuration(before),
+				"END:VALARM",
+			)
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, foldICS(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// icsDuration formats the reminder offset as a negative RFC 5545 duration.
+func icsDuration(d time.Duration) string {
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("-PT%dM", d/time.Minute)
+	}
+	return fmt.Sprintf("-PT%dS", d/time.Second)
+}
+
+func escapeICS(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func escapeParam(s string) string {
+	if strings.ContainsAny(s, ";:,") {
+		return `"` + strings.ReplaceAll(s, `"`, "") + `"`
+	}
+	return s
+}
+
+func partStat(status calendarclient.RSVPStatus) string {
+	switch status {
+	case calendarclient.RSVPAccepted:
+		return "ACCEPTED"
+	case calendarclient.RSVPDeclined:
+		return "DECLINED"
+	case calendarclient.RSVPTentative:
+		return "TENTATIVE"
+	default:
+		return "NEEDS-ACTION"
+	}
+}
+
+// foldICS splits lines longer than 75 octets, continuation lines start with a space.
+// It doesn't split UTF-8 sequences.
+func foldICS(line string) string {
+	const limit = 75
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/calendarclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteICS(t *testing.T) {
+	start := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	events := []calendarclient.Event{{
+		ID:          "1",
+		Title:       "standup; daily, short",
+		StartAt:     start,
+		EndAt:       start.Add(15 * time.Minute),
+		Description: "line one\nline two",
+		UserID:      "alice",
+		Reminders:   []time.Duration{time.Hour, 10 * time.Minute},
+		Attendees:   []calendarclient.Attendee{{UserID: "bob", Status: calendarclient.RSVPAccepted}},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeICS(&buf, events, start))
+
+	require.Equal(t, strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//otus//calendarctl//EN",
+		"CALSCALE:GREGORIAN",
+		"BEGIN:VEVENT",
+		"UID:1",
+		"DTSTAMP:20220601T070000Z",
+		"DTSTART:20220601T070000Z",
+		"DTEND:20220601T071500Z",
+		`SUMMARY:standup\; daily\, short`,
+		`DESCRIPTION:line one\nline two`,
+		"ORGANIZER;CN=alice:urn:calendar:user:alice",
+		"ATTENDEE;CN=bob;PARTSTAT=ACCEPTED:urn:calendar:user:bob",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		`DESCRIPTION:standup\; daily\, short`,
+		"TRIGGER:-PT60M",
+		"END:VALARM",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		`DESCRIPTION:standup\; daily\, short`,
+		"TRIGGER:-PT10M",
+		"END:VALARM",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n"), buf.String())
+}
+
+func TestFoldICS(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("й", 50)
+	folded := foldICS(line)
+
+	for _, part := range strings.Split(folded, "\r\n") {
+		require.LessOrEqual(t, len(part), 75)
+	}
+	require.Equal(t, line, strings.ReplaceAll(folded, "\r\n ", ""))
+}
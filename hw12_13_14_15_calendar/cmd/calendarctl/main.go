@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/calendarclient"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/calendartls"
+)
+
+const (
+	transportHTTP = "http"
+	transportGRPC = "grpc"
+
+	dateLayout = "2006-01-02"
+)
+
+const usage = `Usage: calendarctl [flags] <command> [command flags]
+
+Commands:
+  create -title T -start TIME -end TIME [-description D] [-reminders 24h,15m] [-attendees a,b] [-tentative]
+         [-out-of-office] [-category C] [-color #rrggbb] [-tags a,b] [-owner U]
+  update <id> -title T -start TIME -end TIME [-description D] [-reminders 24h,15m] [-attendees a,b] [-tentative]
+         [-out-of-office] [-category C] [-color #rrggbb] [-tags a,b]
+  delete <id>
+  list day|week|month [-date YYYY-MM-DD] [-shared] [-tag T]
+  export ics [-period day|week|month] [-date YYYY-MM-DD] [-shared] [-tag T] [-out FILE]
+  version
+
+TIME is RFC 3339, e.g. 2022-06-01T10:00:00+03:00. Update replaces the whole event.
+
+Flags:
+`
+
+var errUsage = errors.New("invalid usage")
+
+type authFlags struct {
+	header string
+	userID string
+	token  string
+}
+
+// tlsFlags enable TLS when -tls or any of the files is set.
+type tlsFlags struct {
+	enabled    bool
+	caFile     string
+	certFile   string
+	keyFile    string
+	serverName string
+}
+
+// config returns nil for plaintext.
+func (f tlsFlags) config() (*tls.Config, error) {
+	if !f.enabled && f.caFile == "" && f.certFile == "" && f.keyFile == "" {
+		return nil, nil
+	}
+	return calendartls.ClientConfig{
+		CAFile:     f.caFile,
+		CertFile:   f.certFile,
+		KeyFile:    f.keyFile,
+		ServerName: f.serverName,
+	}.TLSConfig()
+}
+
+type options struct {
+	transport string
+	addr      string
+	output    string
+	timeout   time.Duration
+	auth      authFlags
+	tls       tlsFlags
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.transport, "transport", transportHTTP, "Calendar API: http or grpc")
+	flag.StringVar(&opts.addr, "addr", "",
+		"Calendar address, localhost:8080 for http and localhost:50051 for grpc by default")
+	flag.StringVar(&opts.output, "output", outputTable, "Output format: table or json")
+	flag.DurationVar(&opts.timeout, "timeout", 10*time.Second, "Request timeout")
+	flag.StringVar(&opts.auth.header, "user-header", "X-User-ID", "Header passing the user ID")
+	flag.StringVar(&opts.auth.userID, "user", os.Getenv("CALENDAR_USER"), "User ID, $CALENDAR_USER by default")
+	flag.StringVar(&opts.auth.token, "token", os.Getenv("CALENDAR_TOKEN"),
+		"JWT bearer token used instead of the user ID, $CALENDAR_TOKEN by default")
+	flag.BoolVar(&opts.tls.enabled, "tls", false, "Connect with TLS, verifying the server by the system CAs")
+	flag.StringVar(&opts.tls.caFile, "tls-ca", "", "CA file verifying the server instead of the system CAs, implies -tls")
+	flag.StringVar(&opts.tls.certFile, "tls-cert", "", "Client certificate file for mutual TLS, implies -tls")
+	flag.StringVar(&opts.tls.keyFile, "tls-key", "", "Client key file for mutual TLS")
+	flag.StringVar(&opts.tls.serverName, "tls-server-name", "",
+		"Name the server certificate is verified for, the host by default, required with -tls-ca to dial an IP")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.Arg(0) == "version" {
+		printVersion()
+		return
+	}
+
+	if err := run(opts, flag.Args(), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "calendarctl:", err)
+		if errors.Is(err, errUsage) {
+			flag.Usage()
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(opts options, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: command is required", errUsage)
+	}
+
+	b, err := newBackend(opts)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "create":
+		return createEvent(ctx, b, opts.output, args, out)
+	case "update":
+		return updateEvent(ctx, b, opts.output, args, out)
+	case "delete":
+		return deleteEvent(ctx, b, args)
+	case "list":
+		return listEvents(ctx, b, opts.output, args, out)
+	case "export":
+		return exportEvents(ctx, b, args, out)
+	default:
+		return fmt.Errorf("%w: unknown command %q", errUsage, command)
+	}
+}
+
+func newBackend(opts options) (backend, error) {
+	tlsConfig, err := opts.tls.config()
+	if err != nil {
+		return nil, err
+	}
+	switch opts.transport {
+	case transportHTTP:
+		if opts.addr == "" {
+			opts.addr = "localhost:8080"
+		}
+		return newHTTPBackend(opts.addr, opts.auth, tlsConfig), nil
+	case transportGRPC:
+		if opts.addr == "" {
+			opts.addr = "localhost:50051"
+		}
+		return newGRPCBackend(opts.addr, opts.auth, tlsConfig)
+	default:
+		return nil, fmt.Errorf("%w: unknown transport %q", errUsage, opts.transport)
+	}
+}
+
+func createEvent(ctx context.Context, b backend, output string, args []string, out io.Writer) error {
+	event, err := parseEvent("create", args, true)
+	if err != nil {
+		return err
+	}
+	created, err := b.CreateEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	return writeEvents(out, output, []calendarclient.Event{created})
+}
+
+func updateEvent(ctx context.Context, b backend, output string, args []string, out io.Writer) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("%w: update needs the event id", errUsage)
+	}
+	event, err := parseEvent("update", args[1:], false)
+	if err != nil {
+		return err
+	}
+	updated, err := b.UpdateEvent(ctx, args[0], event)
+	if err != nil {
+		return err
+	}
+	return writeEvents(out, output, []calendarclient.Event{updated})
+}
+
+func deleteEvent(ctx context.Context, b backend, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: delete needs the event id", errUsage)
+	}
+	return b.DeleteEvent(ctx, args[0])
+}
+
+func listEvents(ctx context.Context, b backend, output string, args []string, out io.Writer) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("%w: list needs the period: day, week or month", errUsage)
+	}
+	period := args[0]
+
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	date := fs.String("date", time.Now().Format(dateLayout), "First day of the period")
+	shared := fs.Bool("shared", false, "Include calendars shared with the user")
+	tag := fs.String("tag", "", "List only the events tagged with the tag")
+	if err := fs.Parse(args[1:]); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	events, err := list(ctx, b, period, *date, *shared, *tag)
+	if err != nil {
+		return err
+	}
+	return writeEvents(out, output, events)
+}
+
+func exportEvents(ctx context.Context, b backend, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "ics" {
+		return fmt.Errorf("%w: only ics export is supported", errUsage)
+	}
+
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	period := fs.String("period", periodMonth, "Period to export: day, week or month")
+	date := fs.String("date", time.Now().Format(dateLayout), "First day of the period")
+	shared := fs.Bool("shared", false, "Include calendars shared with the user")
+	tag := fs.String("tag", "", "Export only the events tagged with the tag")
+	file := fs.String("out", "", "File to write, stdout by default")
+	if err := fs.Parse(args[1:]); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	events, err := list(ctx, b, *period, *date, *shared, *tag)
+	if err != nil {
+		return err
+	}
+
+	if *file == "" {
+		return writeICS(out, events, time.Now())
+	}
+	f, err := os.Create(*file)
+	if err != nil {
+		return err
+	}
+	if err := writeICS(f, events, time.Now()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func list(
+	ctx context.Context, b backend, period, date string, shared bool, tag string,
+) ([]calendarclient.Event, error) {
+	day, err := time.ParseInLocation(dateLayout, date, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("%w: date: %v", errUsage, err)
+	}
+	return b.ListEvents(ctx, period, day, shared, tag)
+}
+
+// parseEvent reads the event from the flags, the owner can be chosen only for new events.
+func parseEvent(command string, args []string, withOwner bool) (calendarclient.Event, error) {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	title := fs.String("title", "", "Event title")
+	start := fs.String("start", "", "Start time, RFC 3339")
+	end := fs.String("end", "", "End time, RFC 3339")
+	description := fs.String("description", "", "Event description")
+	reminders := fs.String("reminders", "",
+		"Comma separated durations before the start to remind at, empty for none, the default reminders if not set")
+	attendees := fs.String("attendees", "", "Comma separated IDs of invited users")
+	tentative := fs.Bool("tentative", false, "Mark the event tentative, it may overlap others if the policy allows")
+	outOfOffice := fs.Bool("out-of-office", false, "Mark the time away, overlapping invitations are declined")
+	category := fs.String("category", "", "Free-form category, like work or family")
+	color := fs.String("color", "", "Color to show the event with, #rrggbb")
+	tags := fs.String("tags", "", "Comma separated tags from the vocabulary of the owner")
+	var owner string
+	if withOwner {
+		fs.StringVar(&owner, "owner", "", "Calendar shared with write access to create the event in, own by default")
+	}
+	if err := fs.Parse(args); err != nil {
+		return calendarclient.Event{}, fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	event := calendarclient.Event{
+		UserID:      owner,
+		Title:       *title,
+		Description: *description,
+		Tentative:   *tentative,
+		Category:    *category,
+		Color:       *color,
+		Tags:        splitList(*tags),
+	}
+	if *outOfOffice {
+		event.Kind = calendarclient.EventOutOfOffice
+	}
+	var err error
+	if event.StartAt, err = time.Parse(time.RFC3339, *start); err != nil {
+		return calendarclient.Event{}, fmt.Errorf("%w: start: %v", errUsage, err)
+	}
+	if event.EndAt, err = time.Parse(time.RFC3339, *end); err != nil {
+		return calendarclient.Event{}, fmt.Errorf("%w: end: %v", errUsage, err)
+	}
+	if isFlagSet(fs, "reminders") {
+		if event.Reminders, err = parseReminders(*reminders); err != nil {
+			return calendarclient.Event{}, fmt.Errorf("%w: reminders: %v", errUsage, err)
+		}
+	}
+	for _, userID := range splitList(*attendees) {
+		event.Attendees = append(event.Attendees, calendarclient.Attendee{UserID: userID})
+	}
+	return event, nil
+}
+
+// splitList splits the comma separated value dropping the empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// parseReminders returns an empty, not nil, list for the empty value, so the event gets no reminders.
+func parseReminders(value string) ([]time.Duration, error) {
+	reminders := []time.Duration{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, d)
+	}
+	return reminders, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/calendarclient"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+const tableTimeLayout = "2006-01-02 15:04"
+
+func writeEvents(w io.Writer, format string, events []calendarclient.Event) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if events == nil {
+			events = []calendarclient.Event{}
+		}
+		return enc.Encode(events)
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTART\tEND\tTITLE\tOWNER\tREMIND\tATTENDEES\tNOTES")
+		for _, e := range events {
+			remind := "-"
+			if len(e.Reminders) > 0 {
+				remind = formatReminders(e.Reminders)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.ID,
+				e.StartAt.Local().Format(tableTimeLayout),
+				e.EndAt.Local().Format(tableTimeLayout),
+				e.Title,
+				e.UserID,
+				remind,
+				formatAttendees(e.Attendees),
+				formatNotes(e),
+			)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+func formatAttendees(attendees []calendarclient.Attendee) string {
+	if len(attendees) == 0 {
+		return "-"
+	}
+	parts := make([]string, 0, len(attendees))
+	for _, a := range attendees {
+		parts = append(parts, a.UserID+"("+string(a.Status)+")")
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatReminders(reminders []time.Duration) string {
+	values := make([]string, 0, len(reminders))
+	for _, d := range reminders {
+		values = append(values, d.String())
+	}
+	return strings.Join(values, ",")
+}
+
+func formatNotes(e calendarclient.Event) string {
+	var notes []string
+	if e.Kind == calendarclient.EventOutOfOffice {
+		notes = append(notes, "out of office")
+	}
+	if e.Tentative {
+		notes = append(notes, "tentative")
+	}
+	if e.OutsideWorkingHours {
+		notes = append(notes, "outside working hours")
+	}
+	if e.Category != "" {
+		notes = append(notes, e.Category)
+	}
+	for _, tag := range e.Tags {
+		notes = append(notes, "#"+tag)
+	}
+	if len(notes) == 0 {
+		return "-"
+	}
+	return strings.Join(notes, ",")
+}
@@ -0,0 +1,6 @@
+// Package integration holds black-box tests of the calendar HTTP API.
+//
+// By default the tests start the API, the scheduler and the sender in-process with the in-memory
+// storage and queue. With CALENDAR_HTTP_ADDR set they target the calendar running at that address
+// instead, then the reminder delivery is not checked as the sender is out of reach.
+package integration
@@ -0,0 +1,314 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/calendarclient"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// Far from now, so the reminders of these events never fire during the tests.
+var day = time.Date(2030, time.March, 4, 0, 0, 0, 0, time.UTC)
+
+// newClient returns the client of a user unique to the run, tests against a long-living calendar
+// don't see each other's events.
+func newClient(name string) (*calendarclient.Client, string) {
+	userID := name + "-" + uuid.New().String()
+	return calendarclient.New(baseURL, calendarclient.WithUserHeader(userIDHeader, userID)), userID
+}
+
+func ids(events []calendarclient.Event) []string {
+	ids := make([]string, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestCreateAndList(t *testing.T) {
+	ctx := context.Background()
+	alice, aliceID := newClient("alice")
+
+	var created []string
+	for _, start := range []time.Time{
+		day.Add(10 * time.Hour),
+		day.AddDate(0, 0, 2).Add(10 * time.Hour),
+		day.AddDate(0, 0, 14).Add(10 * time.Hour),
+	} {
+		e, err := alice.CreateEvent(ctx,
+			calendarclient.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)}, "")
+		require.NoError(t, err)
+		require.NotEmpty(t, e.ID)
+		require.Equal(t, aliceID, e.UserID)
+		created = append(created, e.ID)
+	}
+
+	events, err := alice.ListDayEvents(ctx, day)
+	require.NoError(t, err)
+	require.Equal(t, created[:1], ids(events))
+	events, err = alice.ListWeekEvents(ctx, day)
+	require.NoError(t, err)
+	require.Equal(t, created[:2], ids(events))
+	events, err = alice.ListMonthEvents(ctx, day)
+	require.NoError(t, err)
+	require.Equal(t, created, ids(events))
+
+	bob, _ := newClient("bob")
+	events, err = bob.ListMonthEvents(ctx, day)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	t.Run("date busy", func(t *testing.T) {
+		_, err := alice.CreateEvent(ctx, calendarclient.Event{
+			Title: "overlap", StartAt: day.Add(10*time.Hour + 30*time.Minute), EndAt: day.Add(12 * time.Hour),
+		}, "")
+		require.True(t, calendarclient.IsConflict(err), err)
+		var apiErr *calendarclient.APIError
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	})
+
+	t.Run("idempotent retry", func(t *testing.T) {
+		start := day.Add(20 * time.Hour)
+		event := calendarclient.Event{Title: "retried", StartAt: start, EndAt: start.Add(time.Hour)}
+		key := uuid.New().String()
+
+		first, err := alice.CreateEvent(ctx, event, key)
+		require.NoError(t, err)
+		retried, err := alice.CreateEvent(ctx, event, key)
+		require.NoError(t, err)
+		require.Equal(t, first, retried)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := alice.CreateEvent(ctx, calendarclient.Event{
+			Title: "reversed", StartAt: day.Add(12 * time.Hour), EndAt: day.Add(11 * time.Hour),
+		}, "")
+		var apiErr *calendarclient.APIError
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := calendarclient.New(baseURL).ListDayEvents(ctx, day)
+		var apiErr *calendarclient.APIError
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	alice, _ := newClient("alice")
+	bob, _ := newClient("bob")
+	start := day.Add(10 * time.Hour)
+
+	created, err := alice.CreateEvent(ctx,
+		calendarclient.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)}, "")
+	require.NoError(t, err)
+
+	moved := calendarclient.Event{
+		Title: "moved", StartAt: start.AddDate(0, 0, 1), EndAt: start.AddDate(0, 0, 1).Add(time.Hour),
+	}
+	_, err = bob.UpdateEvent(ctx, created.ID, moved)
+	require.True(t, calendarclient.IsForbidden(err), err)
+	_, err = alice.UpdateEvent(ctx, uuid.New().String(), moved)
+	require.True(t, calendarclient.IsNotFound(err), err)
+
+	updated, err := alice.UpdateEvent(ctx, created.ID, moved)
+	require.NoError(t, err)
+	require.Equal(t, "moved", updated.Title)
+
+	events, err := alice.ListDayEvents(ctx, day)
+	require.NoError(t, err)
+	require.Empty(t, events)
+	events, err = alice.ListDayEvents(ctx, day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, []string{created.ID}, ids(events))
+}
+
+func TestInvitation(t *testing.T) {
+	ctx := context.Background()
+	alice, _ := newClient("alice")
+	bob, bobID := newClient("bob")
+	start := day.Add(10 * time.Hour)
+
+	created, err := alice.CreateEvent(ctx, calendarclient.Event{
+		Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour),
+		Attendees: []calendarclient.Attendee{{UserID: bobID}},
+	}, "")
+	require.NoError(t, err)
+
+	require.NoError(t, bob.RespondToEvent(ctx, created.ID, calendarclient.RSVPAccepted))
+
+	events, err := bob.ListDayEvents(ctx, day)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, []calendarclient.Attendee{{UserID: bobID, Status: calendarclient.RSVPAccepted}}, events[0].Attendees)
+}
+
+func TestSharing(t *testing.T) {
+	ctx := context.Background()
+	alice, aliceID := newClient("alice")
+	bob, bobID := newClient("bob")
+	start := day.Add(10 * time.Hour)
+
+	_, err := alice.CreateEvent(ctx, calendarclient.Event{Title: "own", StartAt: start, EndAt: start.Add(time.Hour)}, "")
+	require.NoError(t, err)
+
+	delegated := calendarclient.Event{
+		Title: "delegated", UserID: aliceID, StartAt: start.Add(2 * time.Hour), EndAt: start.Add(3 * time.Hour),
+	}
+	_, err = bob.CreateEvent(ctx, delegated, "")
+	require.True(t, calendarclient.IsForbidden(err), err)
+
+	_, err = alice.ShareCalendar(ctx, bobID, calendarclient.AccessWrite)
+	require.NoError(t, err)
+	created, err := bob.CreateEvent(ctx, delegated, "")
+	require.NoError(t, err)
+	require.Equal(t, aliceID, created.UserID)
+
+	events, err := bob.ListDayEvents(ctx, day)
+	require.NoError(t, err)
+	require.Empty(t, events)
+	events, err = bob.ListDayEvents(ctx, day, calendarclient.IncludeShared())
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	require.NoError(t, alice.UnshareCalendar(ctx, bobID))
+	require.True(t, calendarclient.IsForbidden(bob.DeleteEvent(ctx, created.ID)))
+}
+
+func TestDeleteAndRestore(t *testing.T) {
+	ctx := context.Background()
+	alice, aliceID := newClient("alice")
+	start := day.Add(10 * time.Hour)
+
+	created, err := alice.CreateEvent(ctx,
+		calendarclient.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)}, "")
+	require.NoError(t, err)
+
+	require.NoError(t, alice.DeleteEvent(ctx, created.ID))
+	require.True(t, calendarclient.IsNotFound(alice.DeleteEvent(ctx, created.ID)))
+	events, err := alice.ListDayEvents(ctx, day)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	trash, err := alice.ListTrash(ctx)
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	require.False(t, trash[0].DeletedAt.IsZero())
+
+	restored, err := alice.RestoreEvent(ctx, created.ID)
+	require.NoError(t, err)
+	require.True(t, restored.DeletedAt.IsZero())
+	events, err = alice.ListDayEvents(ctx, day)
+	require.NoError(t, err)
+	require.Equal(t, []string{created.ID}, ids(events))
+
+	records, err := alice.EventHistory(ctx, created.ID)
+	require.NoError(t, err)
+	actions := make([]string, 0, len(records))
+	for _, record := range records {
+		require.Equal(t, aliceID, record.ActorID)
+		actions = append(actions, record.Action)
+	}
+	require.Equal(t, []string{"create", "delete", "restore"}, actions)
+}
+
+func TestConflictPolicy(t *testing.T) {
+	ctx := context.Background()
+	alice, _ := newClient("alice")
+	start := day.Add(10 * time.Hour)
+	event := calendarclient.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)}
+
+	settings, err := alice.GetSettings(ctx)
+	require.NoError(t, err)
+	require.Equal(t, calendarclient.ConflictReject, settings.ConflictPolicy)
+
+	_, err = alice.CreateEvent(ctx, event, "")
+	require.NoError(t, err)
+	tentative := event
+	tentative.Tentative = true
+	_, err = alice.CreateEvent(ctx, tentative, "")
+	require.True(t, calendarclient.IsConflict(err))
+
+	_, err = alice.UpdateSettings(ctx, calendarclient.Settings{ConflictPolicy: calendarclient.ConflictAllowTentative})
+	require.NoError(t, err)
+	created, err := alice.CreateEvent(ctx, tentative, "")
+	require.NoError(t, err)
+	require.True(t, created.Tentative)
+	_, err = alice.CreateEvent(ctx, event, "")
+	require.True(t, calendarclient.IsConflict(err))
+
+	_, err = alice.UpdateSettings(ctx, calendarclient.Settings{ConflictPolicy: calendarclient.ConflictReject})
+	require.True(t, calendarclient.IsConflict(err))
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	alice, _ := newClient("alice")
+	start := day.Add(10 * time.Hour)
+	event := calendarclient.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)}
+
+	existing, err := alice.CreateEvent(ctx, event, "")
+	require.NoError(t, err)
+	later := event
+	later.StartAt, later.EndAt = start.Add(2*time.Hour), start.Add(3*time.Hour)
+
+	report, err := alice.ApplyBatch(ctx, calendarclient.BatchAtomic,
+		calendarclient.CreateOp(later), calendarclient.CreateOp(event))
+	require.NoError(t, err)
+	require.Equal(t, 0, report.Applied)
+	require.Equal(t, codes.FailedPrecondition.String(), report.Results[1].Code)
+
+	report, err = alice.ApplyBatch(ctx, calendarclient.BatchBestEffort,
+		calendarclient.CreateOp(later), calendarclient.CreateOp(event), calendarclient.DeleteOp(existing.ID))
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Applied)
+	require.Equal(t, "failed", report.Results[1].Status)
+
+	events, err := alice.ListDayEvents(ctx, day)
+	require.NoError(t, err)
+	require.Equal(t, []string{report.Results[0].Event.ID}, ids(events))
+}
+
+func TestReminder(t *testing.T) {
+	if notifications == nil {
+		t.Skip("the sender of a remote calendar can't be observed")
+	}
+
+	alice, aliceID := newClient("alice")
+	start := time.Now().Add(time.Minute + 300*time.Millisecond)
+
+	reminders := []time.Duration{time.Minute + 100*time.Millisecond, time.Minute}
+	created, err := alice.CreateEvent(context.Background(), calendarclient.Event{
+		Title: "soon", StartAt: start, EndAt: start.Add(time.Hour), Reminders: reminders,
+	}, "")
+	require.NoError(t, err)
+
+	// Each reminder is delivered on its own.
+	var delivered []time.Duration
+	timeout := time.After(5 * time.Second)
+	for len(delivered) < len(reminders) {
+		select {
+		case n := <-notifications:
+			if n.EventID != created.ID {
+				continue
+			}
+			require.Equal(t, aliceID, n.UserID)
+			require.Equal(t, "soon", n.Title)
+			require.True(t, start.Equal(n.StartAt))
+			delivered = append(delivered, n.Before)
+		case <-timeout:
+			require.Fail(t, "reminders are not delivered", "delivered %v", delivered)
+			return
+		}
+	}
+	require.Equal(t, reminders, delivered)
+}
@@ -0,0 +1,136 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	memoryqueue "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ratelimit"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/sender"
+	internalgrpc "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/grpc"
+	internalhttp "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/http"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+)
+
+const (
+	addrEnv      = "CALENDAR_HTTP_ADDR"
+	userIDHeader = "X-User-ID"
+)
+
+var (
+	baseURL string
+	// notifications receives the reminders delivered by the in-process sender, nil for a remote calendar.
+	notifications chan storage.Notification
+)
+
+type notifier struct{}
+
+func (notifier) Notify(ctx context.Context, notification storage.Notification) error {
+	notifications <- notification
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	if addr := os.Getenv(addrEnv); addr != "" {
+		baseURL = "http://" + addr
+		os.Exit(m.Run())
+	}
+
+	stop, err := startCalendar()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to start calendar:", err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// startCalendar runs the calendar processes wired together as in production, but within the test binary.
+func startCalendar() (func(), error) {
+	addr, err := freeAddr()
+	if err != nil {
+		return nil, err
+	}
+	grpcAddr, err := freeAddr()
+	if err != nil {
+		return nil, err
+	}
+	baseURL = "http://" + addr
+	notifications = make(chan storage.Notification, 100)
+
+	logg := logger.NewWithWriter("error", io.Discard)
+	events := memorystorage.New()
+	queue := memoryqueue.New(100)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	grpcServer := internalgrpc.NewServer(logg, app.New(logg, events, time.Hour), grpcAddr,
+		auth.NewHeaderAuthenticator(userIDHeader), ratelimit.New(0, 0, 0, 0), nil)
+	gateway, err := grpcServer.Gateway(ctx, userIDHeader)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() {
+		if err := grpcServer.Start(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "grpc server failed:", err)
+		}
+	}()
+	server := internalhttp.NewServer(logg, addr, gateway, nil)
+	go func() {
+		if err := server.Start(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "http server failed:", err)
+		}
+	}()
+	sched := scheduler.New(logg, events, queue, 100*time.Millisecond, 0, 0, 0)
+	go func() {
+		_ = sched.Start(ctx)
+	}()
+	send := sender.New(logg, queue, notifier{})
+	go func() {
+		_ = send.Start(ctx)
+	}()
+
+	stop := func() {
+		_ = server.Stop(context.Background())
+		_ = grpcServer.Stop(context.Background())
+		_ = sched.Stop(context.Background())
+		_ = send.Stop(context.Background())
+		cancel()
+	}
+	if err := waitReady(addr); err != nil {
+		stop()
+		return nil, err
+	}
+	return stop, nil
+}
+
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+func waitReady(addr string) error {
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			return conn.Close()
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return fmt.Errorf("%s is not listening", addr)
+}
@@ -2,25 +2,867 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnauthenticated = errors.New("user is not authenticated")
+	ErrInvalidEvent    = errors.New("invalid event")
+	ErrInvalidRSVP     = errors.New("invalid rsvp status")
+	ErrForbidden       = errors.New("access denied")
+	ErrInvalidShare    = errors.New("invalid share")
+	ErrInvalidSettings = errors.New("invalid settings")
+	ErrInvalidBatch    = errors.New("invalid batch")
+	ErrInvalidTag      = errors.New("invalid tag")
 )
 
-type App struct { // TODO
+const (
+	// MaxReminders limits the number of reminders of an event and of the default ones.
+	MaxReminders = 10
+	// MaxCategoryLength limits the length of event categories in characters.
+	MaxCategoryLength = 64
+
+	// idempotencyPending is how long a request waits for the event of an idempotency key reserved
+	// by a concurrent request before it considers the reservation abandoned.
+	idempotencyPending = 10 * time.Second
+	// idempotencyPoll is how often the waiting request looks for the event.
+	idempotencyPoll = 50 * time.Millisecond
+)
+
+type App struct {
+	logger         Logger
+	storage        Storage
+	idempotencyTTL time.Duration
+	now            func() time.Time
 }
 
-type Logger interface { // TODO
+// Logger adds the request ID of the context to the log lines.
+type Logger interface {
+	DebugContext(ctx context.Context, msg string)
+	InfoContext(ctx context.Context, msg string)
+	WarnContext(ctx context.Context, msg string)
+	ErrorContext(ctx context.Context, msg string)
 }
 
-type Storage interface { // TODO
+type Storage interface {
+	CreateEvent(ctx context.Context, event storage.Event) error
+	UpdateEvent(ctx context.Context, event storage.Event) error
+	TrashEvent(ctx context.Context, id string, deletedAt time.Time) error
+	RestoreEvent(ctx context.Context, id string) error
+	ListTrash(ctx context.Context, userID string) ([]storage.Event, error)
+	GetEvent(ctx context.Context, id string) (storage.Event, error)
+	ListEvents(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error)
+	SetAttendeeStatus(ctx context.Context, eventID, userID string, status storage.RSVPStatus) error
+	GetIdempotencyKey(ctx context.Context, userID, key string) (storage.IdempotencyKey, error)
+	ReserveIdempotencyKey(ctx context.Context, key storage.IdempotencyKey, now time.Time) error
+	DeleteIdempotencyKey(ctx context.Context, key storage.IdempotencyKey) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) error
+	AddAuditRecord(ctx context.Context, record storage.AuditRecord) error
+	ListAuditRecords(ctx context.Context, eventID string) ([]storage.AuditRecord, error)
+	SaveShare(ctx context.Context, share storage.Share) error
+	DeleteShare(ctx context.Context, ownerID, userID string) error
+	GetShare(ctx context.Context, ownerID, userID string) (storage.Share, error)
+	ListShares(ctx context.Context, ownerID string) ([]storage.Share, error)
+	ListSharedWith(ctx context.Context, userID string) ([]storage.Share, error)
+	GetUserSettings(ctx context.Context, userID string) (storage.UserSettings, error)
+	SaveUserSettings(ctx context.Context, settings storage.UserSettings) error
+	ApplyBatch(ctx context.Context, ops []storage.BatchOp, mode storage.BatchMode) ([]error, error)
+	ListTags(ctx context.Context, userID string) ([]storage.Tag, error)
+	SaveTag(ctx context.Context, tag storage.Tag) error
+	DeleteTag(ctx context.Context, userID, name string) error
 }
 
-func New(logger Logger, storage Storage) *App {
-	return &App{}
+func New(logger Logger, storage Storage, idempotencyTTL time.Duration) *App {
+	return &App{
+		logger:         logger,
+		storage:        storage,
+		idempotencyTTL: idempotencyTTL,
+		now:            time.Now,
+	}
 }
 
-func (a *App) CreateEvent(ctx context.Context, id, title string) error {
-	// TODO
+// CreateEvent creates the event owned by the user of the context, or by the owner set in the event if the user
+// has write access to the owner's calendar. When the context carries an idempotency key already used by the user
+// within the TTL, the originally created event is returned instead. The key is reserved before the event is
+// created, so of concurrent requests with the same key only one creates the event and the others wait for it.
+func (a *App) CreateEvent(ctx context.Context, event storage.Event) (storage.Event, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+
+	event, err = a.newEvent(ctx, userID, event)
+	if err != nil {
+		return storage.Event{}, err
+	}
+
+	key := idempotencyKey(ctx)
+	if key != "" {
+		reserved, created, err := a.reserveIdempotencyKey(ctx, userID, key, event.ID)
+		if err != nil {
+			return storage.Event{}, err
+		}
+		if !reserved {
+			a.logger.DebugContext(ctx, "event "+created.ID+" returned for repeated idempotency key "+key)
+			return created, nil
+		}
+	}
+
+	if err := a.storage.CreateEvent(ctx, event); err != nil {
+		if key != "" {
+			a.releaseIdempotencyKey(ctx, userID, key, event.ID)
+		}
+		return storage.Event{}, err
+	}
+	a.logger.DebugContext(ctx, "event "+event.ID+" created by "+userID)
+	a.audit(ctx, userID, storage.AuditCreate, storage.Event{ID: event.ID}, event)
+	a.declineInvitations(ctx, event)
+	return event, nil
+}
+
+func (a *App) UpdateEvent(ctx context.Context, id string, event storage.Event) (storage.Event, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+
+	current, err := a.writableEvent(ctx, userID, id)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	event, err = a.updatedEvent(ctx, current, event)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if err := a.storage.UpdateEvent(ctx, event); err != nil {
+		return storage.Event{}, err
+	}
+	a.logger.DebugContext(ctx, "event "+event.ID+" updated by "+userID)
+	a.audit(ctx, userID, storage.AuditUpdate, current, event)
+	a.declineInvitations(ctx, event)
+	return event, nil
+}
+
+// DeleteEvent moves the event to the trash, it is purged by the scheduler after the retention period.
+func (a *App) DeleteEvent(ctx context.Context, id string) error {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	event, err := a.writableEvent(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	trashed := event
+	trashed.DeletedAt = a.now()
+	if err := a.storage.TrashEvent(ctx, id, trashed.DeletedAt); err != nil {
+		return err
+	}
+	a.logger.DebugContext(ctx, "event "+id+" moved to trash by "+userID)
+	a.audit(ctx, userID, storage.AuditDelete, event, trashed)
 	return nil
-	// return a.storage.CreateEvent(storage.Event{ID: id, Title: title})
 }
 
-// TODO
+// RestoreEvent brings the event back from the trash unless its time is already taken by another event.
+func (a *App) RestoreEvent(ctx context.Context, id string) (storage.Event, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+
+	event, err := a.storage.GetEvent(ctx, id)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if err := a.checkWriteAccess(ctx, userID, event.UserID); err != nil {
+		return storage.Event{}, err
+	}
+	if !event.Trashed() {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+
+	if err := a.storage.RestoreEvent(ctx, id); err != nil {
+		return storage.Event{}, err
+	}
+	a.logger.DebugContext(ctx, "event "+id+" restored by "+userID)
+
+	restored := event
+	restored.DeletedAt = time.Time{}
+	a.audit(ctx, userID, storage.AuditRestore, event, restored)
+	a.declineInvitations(ctx, restored)
+	return restored, nil
+}
+
+// ListTrash returns deleted events of the user, the most recently deleted first.
+func (a *App) ListTrash(ctx context.Context) ([]storage.Event, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.ListTrash(ctx, userID)
+}
+
+// EventHistory returns the audit records of the event to its owner, attendees and users the owner's calendar
+// is shared with, trashed events included.
+func (a *App) EventHistory(ctx context.Context, id string) ([]storage.AuditRecord, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := a.storage.GetEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := event.Attendee(userID); !ok {
+		if err := a.checkReadAccess(ctx, userID, event.UserID); err != nil {
+			return nil, err
+		}
+	}
+	return a.storage.ListAuditRecords(ctx, id)
+}
+
+// RespondToEvent records the invitee's answer to the event invitation.
+func (a *App) RespondToEvent(ctx context.Context, id string, status storage.RSVPStatus) error {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !status.IsResponse() {
+		return fmt.Errorf("%w: %q", ErrInvalidRSVP, status)
+	}
+
+	if err := a.storage.SetAttendeeStatus(ctx, id, userID, status); err != nil {
+		return err
+	}
+	a.logger.DebugContext(ctx, "user "+userID+" responded "+string(status)+" to event "+id)
+	return nil
+}
+
+// ShareCalendar grants the user access to the calendar of the current user, sharing again changes the level.
+func (a *App) ShareCalendar(ctx context.Context, userID string, level storage.AccessLevel) (storage.Share, error) {
+	ownerID, err := currentUser(ctx)
+	if err != nil {
+		return storage.Share{}, err
+	}
+
+	switch {
+	case userID == "":
+		return storage.Share{}, fmt.Errorf("%w: user is empty", ErrInvalidShare)
+	case userID == ownerID:
+		return storage.Share{}, fmt.Errorf("%w: calendar can't be shared with its owner", ErrInvalidShare)
+	case !level.Valid():
+		return storage.Share{}, fmt.Errorf("%w: unknown access level %q", ErrInvalidShare, level)
+	}
+
+	share := storage.Share{OwnerID: ownerID, UserID: userID, Level: level}
+	if err := a.storage.SaveShare(ctx, share); err != nil {
+		return storage.Share{}, err
+	}
+	a.logger.DebugContext(ctx, "calendar of "+ownerID+" shared with "+userID+" for "+string(level))
+	return share, nil
+}
+
+// UnshareCalendar revokes the access of the user to the calendar of the current user.
+func (a *App) UnshareCalendar(ctx context.Context, userID string) error {
+	ownerID, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := a.storage.DeleteShare(ctx, ownerID, userID); err != nil {
+		return err
+	}
+	a.logger.DebugContext(ctx, "calendar of "+ownerID+" unshared with "+userID)
+	return nil
+}
+
+// ListShares returns whom the current user has shared the calendar with.
+func (a *App) ListShares(ctx context.Context) ([]storage.Share, error) {
+	ownerID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.ListShares(ctx, ownerID)
+}
+
+// ListSharedWithMe returns the calendars shared with the current user.
+func (a *App) ListSharedWithMe(ctx context.Context) ([]storage.Share, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.ListSharedWith(ctx, userID)
+}
+
+func (a *App) GetSettings(ctx context.Context) (storage.UserSettings, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+	return a.storage.GetUserSettings(ctx, userID)
+}
+
+// UpdateSettings saves the settings of the current user. Switching to a stricter conflict policy fails
+// with ErrDateBusy while the user has events overlapping under it. Working hours without days clear them,
+// a disabled digest keeps no time zone.
+func (a *App) UpdateSettings(ctx context.Context, settings storage.UserSettings) (storage.UserSettings, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+	if !settings.ConflictPolicy.Valid() {
+		return storage.UserSettings{}, fmt.Errorf("%w: unknown conflict policy %q", ErrInvalidSettings,
+			settings.ConflictPolicy)
+	}
+	settings.DefaultReminders = storage.NormalizeReminders(settings.DefaultReminders)
+	if err := checkReminders(settings.DefaultReminders); err != nil {
+		return storage.UserSettings{}, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	if err := checkWorkingHours(settings.WorkingHours); err != nil {
+		return storage.UserSettings{}, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	if !settings.Digest.Enabled {
+		settings.Digest = storage.DigestSettings{}
+	}
+	if _, err := time.LoadLocation(settings.Digest.TimeZone); err != nil {
+		return storage.UserSettings{}, fmt.Errorf("%w: unknown digest time zone %q", ErrInvalidSettings,
+			settings.Digest.TimeZone)
+	}
+
+	settings.UserID = userID
+	if err := a.storage.SaveUserSettings(ctx, settings); err != nil {
+		return storage.UserSettings{}, err
+	}
+	a.logger.DebugContext(ctx, "settings of "+userID+" updated")
+	return settings, nil
+}
+
+// ListTags returns the tag vocabulary of the current user sorted by name.
+func (a *App) ListTags(ctx context.Context) ([]storage.Tag, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.ListTags(ctx, userID)
+}
+
+// SaveTag adds the tag to the vocabulary of the current user, saving an existing tag changes its color.
+func (a *App) SaveTag(ctx context.Context, tag storage.Tag) (storage.Tag, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return storage.Tag{}, err
+	}
+
+	tag.UserID = userID
+	tag.Name = storage.NormalizeTag(tag.Name)
+	tag.Color = storage.NormalizeColor(tag.Color)
+	switch {
+	case tag.Name == "":
+		return storage.Tag{}, fmt.Errorf("%w: name is empty", ErrInvalidTag)
+	case utf8.RuneCountInString(tag.Name) > storage.MaxTagLength:
+		return storage.Tag{}, fmt.Errorf("%w: name is longer than %d characters", ErrInvalidTag, storage.MaxTagLength)
+	case strings.ContainsAny(tag.Name, ",/"):
+		return storage.Tag{}, fmt.Errorf("%w: name can't contain commas and slashes", ErrInvalidTag)
+	case !storage.ValidColor(tag.Color):
+		return storage.Tag{}, fmt.Errorf("%w: color %q is not #rrggbb", ErrInvalidTag, tag.Color)
+	}
+
+	if err := a.storage.SaveTag(ctx, tag); err != nil {
+		return storage.Tag{}, err
+	}
+	a.logger.DebugContext(ctx, "tag "+tag.Name+" saved by "+userID)
+	return tag, nil
+}
+
+// DeleteTag removes the tag from the vocabulary of the current user and from all the events of the user.
+func (a *App) DeleteTag(ctx context.Context, name string) error {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	name = storage.NormalizeTag(name)
+	if err := a.storage.DeleteTag(ctx, userID, name); err != nil {
+		return err
+	}
+	a.logger.DebugContext(ctx, "tag "+name+" deleted by "+userID)
+	return nil
+}
+
+// ListDayEvents returns events of the user and events the user is invited to, marking the ones outside
+// the user's working hours. With WithSharedCalendars the events of calendars shared with the user are included,
+// with WithTag only the events tagged with the tag are.
+func (a *App) ListDayEvents(ctx context.Context, date time.Time) ([]storage.Event, error) {
+	from := startOfDay(date)
+	return a.listEvents(ctx, from, from.AddDate(0, 0, 1))
+}
+
+func (a *App) ListWeekEvents(ctx context.Context, date time.Time) ([]storage.Event, error) {
+	from := startOfDay(date)
+	return a.listEvents(ctx, from, from.AddDate(0, 0, 7))
+}
+
+func (a *App) ListMonthEvents(ctx context.Context, date time.Time) ([]storage.Event, error) {
+	from := startOfDay(date)
+	return a.listEvents(ctx, from, from.AddDate(0, 1, 0))
+}
+
+func (a *App) listEvents(ctx context.Context, from, to time.Time) ([]storage.Event, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := a.storage.ListEvents(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if sharedCalendars(ctx) {
+		if events, err = a.withSharedEvents(ctx, userID, events, from, to); err != nil {
+			return nil, err
+		}
+	}
+	if tag, ok := tagFilter(ctx); ok {
+		events = withTag(events, storage.NormalizeTag(tag))
+	}
+
+	settings, err := a.storage.GetUserSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i, event := range events {
+		events[i].OutsideWorkingHours = !settings.WorkingHours.Contains(event.StartAt, event.EndAt)
+	}
+	return events, nil
+}
+
+// withSharedEvents adds the events of the calendars shared with the user to the user's own ones.
+func (a *App) withSharedEvents(
+	ctx context.Context, userID string, events []storage.Event, from, to time.Time,
+) ([]storage.Event, error) {
+	shares, err := a.storage.ListSharedWith(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{}, len(events))
+	for _, event := range events {
+		seen[event.ID] = struct{}{}
+	}
+	for _, share := range shares {
+		shared, err := a.storage.ListEvents(ctx, share.OwnerID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range shared {
+			if _, ok := seen[event.ID]; !ok {
+				seen[event.ID] = struct{}{}
+				events = append(events, event)
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartAt.Before(events[j].StartAt)
+	})
+	return events, nil
+}
+
+func withTag(events []storage.Event, tag string) []storage.Event {
+	tagged := make([]storage.Event, 0, len(events))
+	for _, event := range events {
+		if event.HasTag(tag) {
+			tagged = append(tagged, event)
+		}
+	}
+	return tagged
+}
+
+// reserveIdempotencyKey reserves the key of the user for the event about to be created. If the key is
+// already reserved by an earlier request, the event created by that request is returned instead.
+func (a *App) reserveIdempotencyKey(
+	ctx context.Context, userID, key, eventID string,
+) (reserved bool, created storage.Event, err error) {
+	if err := a.storage.DeleteExpiredIdempotencyKeys(ctx, a.now()); err != nil {
+		a.logger.ErrorContext(ctx, "failed to delete expired idempotency keys: "+err.Error())
+	}
+
+	for {
+		now := a.now()
+		err := a.storage.ReserveIdempotencyKey(ctx, storage.IdempotencyKey{
+			UserID:    userID,
+			Key:       key,
+			EventID:   eventID,
+			ExpiresAt: now.Add(a.idempotencyTTL),
+		}, now)
+		if err == nil {
+			return true, storage.Event{}, nil
+		}
+		if !errors.Is(err, storage.ErrIdempotencyKeyExists) {
+			return false, storage.Event{}, err
+		}
+
+		created, err := a.idempotentEvent(ctx, userID, key)
+		if err == nil {
+			return false, created, nil
+		}
+		// The key has been released or dropped meanwhile, so it can be reserved again.
+		if !errors.Is(err, storage.ErrIdempotencyKeyNotFound) {
+			return false, storage.Event{}, err
+		}
+	}
+}
+
+// idempotentEvent returns the event created with the key. While the request holding the key is still
+// creating the event, it waits for the event to appear. A key whose event was deleted, or never appeared
+// within idempotencyPending, is dropped and reported as not found.
+func (a *App) idempotentEvent(ctx context.Context, userID, key string) (storage.Event, error) {
+	for {
+		k, err := a.storage.GetIdempotencyKey(ctx, userID, key)
+		if err != nil {
+			return storage.Event{}, err
+		}
+		now := a.now()
+		if !k.ExpiresAt.After(now) {
+			return storage.Event{}, storage.ErrIdempotencyKeyNotFound
+		}
+
+		event, err := a.storage.GetEvent(ctx, k.EventID)
+		if err == nil && !event.Trashed() {
+			return event, nil
+		}
+		if err != nil && !errors.Is(err, storage.ErrEventNotFound) {
+			return storage.Event{}, err
+		}
+		reservedAt := k.ExpiresAt.Add(-a.idempotencyTTL)
+		if err == nil || now.Sub(reservedAt) >= idempotencyPending {
+			if err := a.storage.DeleteIdempotencyKey(ctx, k); err != nil {
+				return storage.Event{}, err
+			}
+			return storage.Event{}, storage.ErrIdempotencyKeyNotFound
+		}
+
+		select {
+		case <-ctx.Done():
+			return storage.Event{}, ctx.Err()
+		case <-time.After(idempotencyPoll):
+		}
+	}
+}
+
+// releaseIdempotencyKey frees the key reserved for the event that failed to be created, so that the client
+// can retry the request. A failure to free it is logged, the error of the request is more relevant.
+func (a *App) releaseIdempotencyKey(ctx context.Context, userID, key, eventID string) {
+	err := a.storage.DeleteIdempotencyKey(ctx, storage.IdempotencyKey{UserID: userID, Key: key, EventID: eventID})
+	if err != nil {
+		a.logger.ErrorContext(ctx, "failed to release idempotency key: "+err.Error())
+	}
+}
+
+// audit records the change made by the user. The change is already stored at this point,
+// so a failure to record it is logged rather than returned.
+func (a *App) audit(ctx context.Context, userID string, action storage.AuditAction, old, new storage.Event) {
+	err := a.storage.AddAuditRecord(ctx, storage.AuditRecord{
+		EventID: new.ID,
+		Action:  action,
+		ActorID: userID,
+		At:      a.now(),
+		Changes: storage.DiffEvents(old, new),
+	})
+	if err != nil {
+		a.logger.ErrorContext(ctx, "failed to record "+string(action)+" of event "+new.ID+": "+err.Error())
+	}
+}
+
+// newEvent prepares the event to be created by the user.
+func (a *App) newEvent(ctx context.Context, userID string, event storage.Event) (storage.Event, error) {
+	if event.UserID == "" {
+		event.UserID = userID
+	}
+	if err := a.checkWriteAccess(ctx, userID, event.UserID); err != nil {
+		return storage.Event{}, err
+	}
+
+	event.ID = uuid.New().String()
+	event.Attendees = mergeAttendees(nil, event.Attendees)
+	return a.preparedEvent(ctx, event)
+}
+
+// updatedEvent replaces the current event with the new one, keeping its identity and the RSVP statuses.
+func (a *App) updatedEvent(ctx context.Context, current, event storage.Event) (storage.Event, error) {
+	event.ID = current.ID
+	event.UserID = current.UserID
+	event.Attendees = mergeAttendees(current.Attendees, event.Attendees)
+	return a.preparedEvent(ctx, event)
+}
+
+// preparedEvent fills in the defaults of the event and validates it. Pending invitations of the attendees
+// who are out of office at the time are declined.
+func (a *App) preparedEvent(ctx context.Context, event storage.Event) (storage.Event, error) {
+	if event.Kind == "" {
+		event.Kind = storage.EventRegular
+	}
+	event.Category = strings.TrimSpace(event.Category)
+	event.Color = storage.NormalizeColor(event.Color)
+	event.Tags = storage.NormalizeTags(event.Tags)
+	event, err := a.withReminders(ctx, event)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if err := validate(event); err != nil {
+		return storage.Event{}, err
+	}
+	if err := a.checkTags(ctx, event); err != nil {
+		return storage.Event{}, err
+	}
+
+	for i, attendee := range event.Attendees {
+		if attendee.Status != storage.RSVPPending {
+			continue
+		}
+		away, err := a.outOfOffice(ctx, attendee.UserID, event.StartAt, event.EndAt)
+		if err != nil {
+			return storage.Event{}, err
+		}
+		if away {
+			event.Attendees[i].Status = storage.RSVPDeclined
+		}
+	}
+	return event, nil
+}
+
+// withReminders gives the event the default reminders of its owner unless the event specifies own ones,
+// an empty list included.
+func (a *App) withReminders(ctx context.Context, event storage.Event) (storage.Event, error) {
+	if event.Reminders == nil {
+		settings, err := a.storage.GetUserSettings(ctx, event.UserID)
+		if err != nil {
+			return storage.Event{}, err
+		}
+		event.Reminders = settings.DefaultReminders
+	}
+	event.Reminders = storage.NormalizeReminders(event.Reminders)
+	return event, nil
+}
+
+// checkTags makes sure the event is tagged with the names from the vocabulary of its owner only.
+func (a *App) checkTags(ctx context.Context, event storage.Event) error {
+	if len(event.Tags) == 0 {
+		return nil
+	}
+	tags, err := a.storage.ListTags(ctx, event.UserID)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		known[tag.Name] = struct{}{}
+	}
+	for _, name := range event.Tags {
+		if _, ok := known[name]; !ok {
+			return fmt.Errorf("%w: unknown tag %q", ErrInvalidEvent, name)
+		}
+	}
+	return nil
+}
+
+// outOfOffice reports whether the user has an out-of-office event overlapping the [from, to) interval.
+func (a *App) outOfOffice(ctx context.Context, userID string, from, to time.Time) (bool, error) {
+	events, err := a.storage.ListEvents(ctx, userID, from, to)
+	if err != nil {
+		return false, err
+	}
+	for _, event := range events {
+		if event.UserID == userID && event.OutOfOffice() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// declineInvitations declines the pending invitations of the owner of the stored out-of-office event that
+// overlap it. The event is already stored at this point, so failures are logged rather than returned.
+func (a *App) declineInvitations(ctx context.Context, event storage.Event) {
+	if !event.OutOfOffice() || event.Trashed() {
+		return
+	}
+
+	invitations, err := a.storage.ListEvents(ctx, event.UserID, event.StartAt, event.EndAt)
+	if err != nil {
+		a.logger.ErrorContext(ctx, "failed to list invitations of "+event.UserID+": "+err.Error())
+		return
+	}
+	for _, invitation := range invitations {
+		if attendee, ok := invitation.Attendee(event.UserID); !ok || attendee.Status != storage.RSVPPending {
+			continue
+		}
+		err := a.storage.SetAttendeeStatus(ctx, invitation.ID, event.UserID, storage.RSVPDeclined)
+		if err != nil {
+			a.logger.ErrorContext(ctx, "failed to decline event "+invitation.ID+" for "+event.UserID+": "+err.Error())
+			continue
+		}
+		a.logger.DebugContext(ctx, "event "+invitation.ID+" declined for "+event.UserID+" out of office")
+	}
+}
+
+// writableEvent returns the event if the user may change it.
+func (a *App) writableEvent(ctx context.Context, userID, id string) (storage.Event, error) {
+	event, err := a.storage.GetEvent(ctx, id)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if event.Trashed() {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	if err := a.checkWriteAccess(ctx, userID, event.UserID); err != nil {
+		return storage.Event{}, err
+	}
+	return event, nil
+}
+
+// checkWriteAccess allows the owner and users with write access to the owner's calendar.
+func (a *App) checkWriteAccess(ctx context.Context, userID, ownerID string) error {
+	share, err := a.share(ctx, userID, ownerID)
+	if err != nil {
+		return err
+	}
+	if share.Level != storage.AccessWrite {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// checkReadAccess allows the owner and users with any access to the owner's calendar.
+func (a *App) checkReadAccess(ctx context.Context, userID, ownerID string) error {
+	_, err := a.share(ctx, userID, ownerID)
+	return err
+}
+
+// share returns the access of the user to the owner's calendar, the owner has write access to its own.
+func (a *App) share(ctx context.Context, userID, ownerID string) (storage.Share, error) {
+	if userID == ownerID {
+		return storage.Share{OwnerID: ownerID, UserID: userID, Level: storage.AccessWrite}, nil
+	}
+	share, err := a.storage.GetShare(ctx, ownerID, userID)
+	if errors.Is(err, storage.ErrShareNotFound) {
+		return storage.Share{}, ErrForbidden
+	}
+	return share, err
+}
+
+func currentUser(ctx context.Context) (string, error) {
+	userID, ok := UserFromContext(ctx)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	return userID, nil
+}
+
+func validate(event storage.Event) error {
+	switch {
+	case event.UserID == "":
+		return fmt.Errorf("%w: owner is empty", ErrInvalidEvent)
+	case event.Title == "":
+		return fmt.Errorf("%w: title is empty", ErrInvalidEvent)
+	case event.StartAt.IsZero():
+		return fmt.Errorf("%w: start time is empty", ErrInvalidEvent)
+	case !event.EndAt.After(event.StartAt):
+		return fmt.Errorf("%w: end time must be after start time", ErrInvalidEvent)
+	case !event.Kind.Valid():
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidEvent, event.Kind)
+	case event.OutOfOffice() && len(event.Attendees) > 0:
+		return fmt.Errorf("%w: out-of-office event can't have attendees", ErrInvalidEvent)
+	case utf8.RuneCountInString(event.Category) > MaxCategoryLength:
+		return fmt.Errorf("%w: category is longer than %d characters", ErrInvalidEvent, MaxCategoryLength)
+	case !storage.ValidColor(event.Color):
+		return fmt.Errorf("%w: color %q is not #rrggbb", ErrInvalidEvent, event.Color)
+	}
+	if err := checkReminders(event.Reminders); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+
+	seen := make(map[string]struct{}, len(event.Attendees))
+	for _, a := range event.Attendees {
+		if a.UserID == "" || a.UserID == event.UserID {
+			return fmt.Errorf("%w: attendee %q is not allowed", ErrInvalidEvent, a.UserID)
+		}
+		if _, ok := seen[a.UserID]; ok {
+			return fmt.Errorf("%w: attendee %q is duplicated", ErrInvalidEvent, a.UserID)
+		}
+		seen[a.UserID] = struct{}{}
+	}
+	return nil
+}
+
+func checkReminders(reminders []time.Duration) error {
+	if len(reminders) > MaxReminders {
+		return fmt.Errorf("expected at most %d reminders, got %d", MaxReminders, len(reminders))
+	}
+	for _, before := range reminders {
+		if before <= 0 {
+			return fmt.Errorf("reminder %s is not positive", before)
+		}
+	}
+	return nil
+}
+
+func checkWorkingHours(hours storage.WorkingHours) error {
+	if hours.IsZero() {
+		return nil
+	}
+
+	seen := make(map[time.Weekday]struct{}, len(hours.Days))
+	for _, day := range hours.Days {
+		if day < time.Sunday || day > time.Saturday {
+			return fmt.Errorf("unknown working day %d", day)
+		}
+		if _, ok := seen[day]; ok {
+			return fmt.Errorf("working day %s is duplicated", day)
+		}
+		seen[day] = struct{}{}
+	}
+	if hours.Start < 0 || hours.End > 24*time.Hour || hours.End <= hours.Start {
+		return fmt.Errorf("working hours %s-%s are not within a day", hours.Start, hours.End)
+	}
+	if _, err := time.LoadLocation(hours.TimeZone); err != nil {
+		return fmt.Errorf("unknown time zone %q", hours.TimeZone)
+	}
+	return nil
+}
+
+// mergeAttendees keeps the answers of already invited users, newcomers start as pending.
+func mergeAttendees(current, invited []storage.Attendee) []storage.Attendee {
+	if len(invited) == 0 {
+		return nil
+	}
+
+	statuses := make(map[string]storage.RSVPStatus, len(current))
+	for _, a := range current {
+		statuses[a.UserID] = a.Status
+	}
+
+	attendees := make([]storage.Attendee, 0, len(invited))
+	for _, a := range invited {
+		status, ok := statuses[a.UserID]
+		if !ok {
+			status = storage.RSVPPending
+		}
+		attendees = append(attendees, storage.Attendee{UserID: a.UserID, Status: status})
+	}
+	return attendees
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,637 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+
+func asUser(userID string) context.Context {
+	return WithUser(context.Background(), userID)
+}
+
+func newApp() *App {
+	return New(logger.New("error"), memorystorage.New(), time.Hour)
+}
+
+func TestCreateEvent(t *testing.T) {
+	a := newApp()
+
+	event, err := a.CreateEvent(asUser("alice"), storage.Event{
+		Title:     "meeting",
+		StartAt:   start,
+		EndAt:     start.Add(time.Hour),
+		Attendees: []storage.Attendee{{UserID: "bob", Status: storage.RSVPAccepted}},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, event.ID)
+	require.Equal(t, "alice", event.UserID)
+	require.Equal(t, []storage.Attendee{{UserID: "bob", Status: storage.RSVPPending}}, event.Attendees)
+
+	// Events can be created in another calendar only with write access to it.
+	_, err = a.CreateEvent(asUser("alice"), storage.Event{
+		Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour), UserID: "mallory",
+	})
+	require.ErrorIs(t, err, ErrForbidden)
+
+	invalid := []storage.Event{
+		{StartAt: start, EndAt: start.Add(time.Hour)},
+		{Title: "no start"},
+		{Title: "reversed", StartAt: start, EndAt: start.Add(-time.Hour)},
+		{Title: "self invite", StartAt: start, EndAt: start.Add(time.Hour),
+			Attendees: []storage.Attendee{{UserID: "alice"}}},
+		{Title: "duplicate", StartAt: start, EndAt: start.Add(time.Hour),
+			Attendees: []storage.Attendee{{UserID: "bob"}, {UserID: "bob"}}},
+		{Title: "negative reminder", StartAt: start, EndAt: start.Add(time.Hour),
+			Reminders: []time.Duration{time.Hour, -time.Minute}},
+	}
+	for _, e := range invalid {
+		_, err := a.CreateEvent(asUser("alice"), e)
+		require.ErrorIs(t, err, ErrInvalidEvent, e.Title)
+	}
+}
+
+func TestUpdateEvent(t *testing.T) {
+	a := newApp()
+
+	event, err := a.CreateEvent(asUser("alice"), storage.Event{
+		Title:     "meeting",
+		StartAt:   start,
+		EndAt:     start.Add(time.Hour),
+		Attendees: []storage.Attendee{{UserID: "bob"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, a.RespondToEvent(asUser("bob"), event.ID, storage.RSVPAccepted))
+
+	event.Title = "renamed"
+	event.Attendees = append(event.Attendees, storage.Attendee{UserID: "carol"})
+	_, err = a.UpdateEvent(asUser("bob"), event.ID, event)
+	require.ErrorIs(t, err, ErrForbidden)
+
+	updated, err := a.UpdateEvent(asUser("alice"), event.ID, event)
+	require.NoError(t, err)
+	require.Equal(t, "renamed", updated.Title)
+	require.Equal(t, []storage.Attendee{
+		{UserID: "bob", Status: storage.RSVPAccepted},
+		{UserID: "carol", Status: storage.RSVPPending},
+	}, updated.Attendees)
+
+	require.ErrorIs(t, a.DeleteEvent(asUser("bob"), event.ID), ErrForbidden)
+	require.NoError(t, a.DeleteEvent(asUser("alice"), event.ID))
+}
+
+func TestRespondToEvent(t *testing.T) {
+	a := newApp()
+
+	event, err := a.CreateEvent(asUser("alice"), storage.Event{
+		Title:     "meeting",
+		StartAt:   start,
+		EndAt:     start.Add(time.Hour),
+		Attendees: []storage.Attendee{{UserID: "bob"}},
+	})
+	require.NoError(t, err)
+
+	require.ErrorIs(t, a.RespondToEvent(asUser("bob"), event.ID, storage.RSVPPending), ErrInvalidRSVP)
+	require.ErrorIs(t, a.RespondToEvent(asUser("carol"), event.ID, storage.RSVPAccepted), storage.ErrNotAttendee)
+	require.NoError(t, a.RespondToEvent(asUser("bob"), event.ID, storage.RSVPTentative))
+
+	events, err := a.ListDayEvents(asUser("bob"), start)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, storage.RSVPTentative, events[0].Attendees[0].Status)
+}
+
+func TestDeleteAndRestoreEvent(t *testing.T) {
+	a := newApp()
+	a.now = func() time.Time { return start }
+
+	event, err := a.CreateEvent(asUser("alice"),
+		storage.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+
+	require.ErrorIs(t, a.DeleteEvent(asUser("bob"), event.ID), ErrForbidden)
+	require.NoError(t, a.DeleteEvent(asUser("alice"), event.ID))
+	require.ErrorIs(t, a.DeleteEvent(asUser("alice"), event.ID), storage.ErrEventNotFound)
+
+	events, err := a.ListDayEvents(asUser("alice"), start)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	trash, err := a.ListTrash(asUser("alice"))
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	require.Equal(t, start, trash[0].DeletedAt)
+
+	// The freed time can be taken, then the trashed event can't be restored over it.
+	other, err := a.CreateEvent(asUser("alice"),
+		storage.Event{Title: "other", StartAt: start, EndAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+	_, err = a.RestoreEvent(asUser("alice"), event.ID)
+	require.ErrorIs(t, err, storage.ErrDateBusy)
+	require.NoError(t, a.DeleteEvent(asUser("alice"), other.ID))
+
+	_, err = a.RestoreEvent(asUser("bob"), event.ID)
+	require.ErrorIs(t, err, ErrForbidden)
+	restored, err := a.RestoreEvent(asUser("alice"), event.ID)
+	require.NoError(t, err)
+	require.False(t, restored.Trashed())
+
+	_, err = a.RestoreEvent(asUser("alice"), event.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	events, err = a.ListDayEvents(asUser("alice"), start)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+}
+
+func TestEventHistory(t *testing.T) {
+	a := newApp()
+	a.now = func() time.Time { return start }
+
+	event, err := a.CreateEvent(asUser("alice"), storage.Event{
+		Title:     "meeting",
+		StartAt:   start,
+		EndAt:     start.Add(time.Hour),
+		Attendees: []storage.Attendee{{UserID: "bob"}},
+	})
+	require.NoError(t, err)
+	_, err = a.UpdateEvent(asUser("alice"), event.ID, storage.Event{
+		Title:     "renamed",
+		StartAt:   start,
+		EndAt:     start.Add(time.Hour),
+		Attendees: []storage.Attendee{{UserID: "bob"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, a.DeleteEvent(asUser("alice"), event.ID))
+	_, err = a.RestoreEvent(asUser("alice"), event.ID)
+	require.NoError(t, err)
+
+	_, err = a.EventHistory(asUser("carol"), event.ID)
+	require.ErrorIs(t, err, ErrForbidden)
+
+	records, err := a.EventHistory(asUser("bob"), event.ID)
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+
+	actions := make([]storage.AuditAction, 0, len(records))
+	for _, record := range records {
+		require.Equal(t, "alice", record.ActorID)
+		require.Equal(t, start, record.At)
+		actions = append(actions, record.Action)
+	}
+	require.Equal(t, []storage.AuditAction{
+		storage.AuditCreate, storage.AuditUpdate, storage.AuditDelete, storage.AuditRestore,
+	}, actions)
+	require.Contains(t, records[0].Changes, storage.FieldChange{Field: "title", New: "meeting"})
+	require.Equal(t, []storage.FieldChange{{Field: "title", Old: "meeting", New: "renamed"}}, records[1].Changes)
+	require.Equal(t, []storage.FieldChange{{Field: "deletedAt", New: "2022-06-01T10:00:00Z"}}, records[2].Changes)
+	require.Equal(t, []storage.FieldChange{{Field: "deletedAt", Old: "2022-06-01T10:00:00Z"}}, records[3].Changes)
+}
+
+func TestSharing(t *testing.T) {
+	a := newApp()
+
+	event, err := a.CreateEvent(asUser("alice"),
+		storage.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+
+	_, err = a.ShareCalendar(asUser("alice"), "alice", storage.AccessRead)
+	require.ErrorIs(t, err, ErrInvalidShare)
+	_, err = a.ShareCalendar(asUser("alice"), "bob", "admin")
+	require.ErrorIs(t, err, ErrInvalidShare)
+
+	_, err = a.ShareCalendar(asUser("alice"), "bob", storage.AccessRead)
+	require.NoError(t, err)
+	_, err = a.ShareCalendar(asUser("alice"), "carol", storage.AccessWrite)
+	require.NoError(t, err)
+
+	shares, err := a.ListShares(asUser("alice"))
+	require.NoError(t, err)
+	require.Equal(t, []storage.Share{
+		{OwnerID: "alice", UserID: "bob", Level: storage.AccessRead},
+		{OwnerID: "alice", UserID: "carol", Level: storage.AccessWrite},
+	}, shares)
+	shares, err = a.ListSharedWithMe(asUser("bob"))
+	require.NoError(t, err)
+	require.Equal(t, []storage.Share{{OwnerID: "alice", UserID: "bob", Level: storage.AccessRead}}, shares)
+
+	t.Run("read access", func(t *testing.T) {
+		events, err := a.ListDayEvents(asUser("bob"), start)
+		require.NoError(t, err)
+		require.Empty(t, events)
+		events, err = a.ListDayEvents(WithSharedCalendars(asUser("bob")), start)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		_, err = a.EventHistory(asUser("bob"), event.ID)
+		require.NoError(t, err)
+		_, err = a.UpdateEvent(asUser("bob"), event.ID,
+			storage.Event{Title: "renamed", StartAt: start, EndAt: start.Add(time.Hour)})
+		require.ErrorIs(t, err, ErrForbidden)
+		require.ErrorIs(t, a.DeleteEvent(asUser("bob"), event.ID), ErrForbidden)
+		_, err = a.CreateEvent(asUser("bob"), storage.Event{
+			Title: "delegated", StartAt: start.Add(2 * time.Hour), EndAt: start.Add(3 * time.Hour), UserID: "alice",
+		})
+		require.ErrorIs(t, err, ErrForbidden)
+	})
+
+	t.Run("write access", func(t *testing.T) {
+		updated, err := a.UpdateEvent(asUser("carol"), event.ID,
+			storage.Event{Title: "renamed", StartAt: start, EndAt: start.Add(time.Hour)})
+		require.NoError(t, err)
+		require.Equal(t, "alice", updated.UserID)
+
+		created, err := a.CreateEvent(asUser("carol"), storage.Event{
+			Title: "delegated", StartAt: start.Add(2 * time.Hour), EndAt: start.Add(3 * time.Hour), UserID: "alice",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "alice", created.UserID)
+
+		require.NoError(t, a.DeleteEvent(asUser("carol"), created.ID))
+		_, err = a.RestoreEvent(asUser("carol"), created.ID)
+		require.NoError(t, err)
+
+		records, err := a.EventHistory(asUser("alice"), created.ID)
+		require.NoError(t, err)
+		for _, record := range records {
+			require.Equal(t, "carol", record.ActorID)
+		}
+	})
+
+	t.Run("unshare", func(t *testing.T) {
+		require.NoError(t, a.UnshareCalendar(asUser("alice"), "carol"))
+		require.ErrorIs(t, a.UnshareCalendar(asUser("alice"), "carol"), storage.ErrShareNotFound)
+		require.ErrorIs(t, a.DeleteEvent(asUser("carol"), event.ID), ErrForbidden)
+		_, err := a.EventHistory(asUser("carol"), event.ID)
+		require.ErrorIs(t, err, ErrForbidden)
+	})
+}
+
+func TestSettings(t *testing.T) {
+	a := newApp()
+
+	settings, err := a.GetSettings(asUser("alice"))
+	require.NoError(t, err)
+	require.Equal(t, storage.ConflictReject, settings.ConflictPolicy)
+
+	_, err = a.UpdateSettings(asUser("alice"), storage.UserSettings{ConflictPolicy: "sometimes"})
+	require.ErrorIs(t, err, ErrInvalidSettings)
+
+	settings, err = a.UpdateSettings(asUser("alice"), storage.UserSettings{
+		UserID: "bob", ConflictPolicy: storage.ConflictAllowTentative,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "alice", settings.UserID)
+
+	_, err = a.CreateEvent(asUser("alice"), storage.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+	_, err = a.CreateEvent(asUser("alice"), storage.Event{
+		Title: "maybe", StartAt: start, EndAt: start.Add(time.Hour), Tentative: true,
+	})
+	require.NoError(t, err)
+
+	_, err = a.UpdateSettings(asUser("alice"), storage.UserSettings{ConflictPolicy: storage.ConflictReject})
+	require.ErrorIs(t, err, storage.ErrDateBusy)
+}
+
+func TestReminders(t *testing.T) {
+	a := newApp()
+	at := func(days int) storage.Event {
+		startAt := start.AddDate(0, 0, days)
+		return storage.Event{Title: "meeting", StartAt: startAt, EndAt: startAt.Add(time.Hour)}
+	}
+
+	tooMany := make([]time.Duration, 0, MaxReminders+1)
+	for i := 1; i <= MaxReminders+1; i++ {
+		tooMany = append(tooMany, time.Duration(i)*time.Minute)
+	}
+	_, err := a.UpdateSettings(asUser("alice"), storage.UserSettings{
+		ConflictPolicy: storage.ConflictReject, DefaultReminders: tooMany,
+	})
+	require.ErrorIs(t, err, ErrInvalidSettings)
+	settings, err := a.UpdateSettings(asUser("alice"), storage.UserSettings{
+		ConflictPolicy: storage.ConflictReject, DefaultReminders: []time.Duration{10 * time.Minute, 24 * time.Hour},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{24 * time.Hour, 10 * time.Minute}, settings.DefaultReminders)
+
+	// Events without reminders get the defaults, own reminders are kept sorted and deduplicated.
+	event, err := a.CreateEvent(asUser("alice"), at(0))
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{24 * time.Hour, 10 * time.Minute}, event.Reminders)
+
+	own := at(1)
+	own.Reminders = []time.Duration{time.Hour, 2 * time.Hour, time.Hour}
+	event, err = a.CreateEvent(asUser("alice"), own)
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{2 * time.Hour, time.Hour}, event.Reminders)
+
+	none := at(2)
+	none.Reminders = []time.Duration{}
+	event, err = a.CreateEvent(asUser("alice"), none)
+	require.NoError(t, err)
+	require.Empty(t, event.Reminders)
+
+	// The defaults are of the owner, not of the user creating the event.
+	_, err = a.ShareCalendar(asUser("bob"), "alice", storage.AccessWrite)
+	require.NoError(t, err)
+	shared := at(3)
+	shared.UserID = "bob"
+	event, err = a.CreateEvent(asUser("alice"), shared)
+	require.NoError(t, err)
+	require.Nil(t, event.Reminders)
+
+	event, err = a.UpdateEvent(asUser("alice"), event.ID, at(3))
+	require.NoError(t, err)
+	require.Nil(t, event.Reminders)
+}
+
+func TestOutOfOffice(t *testing.T) {
+	a := newApp()
+	invite := func(title string, at time.Time) storage.Event {
+		event, err := a.CreateEvent(asUser("alice"), storage.Event{
+			Title: title, StartAt: at, EndAt: at.Add(time.Hour), Attendees: []storage.Attendee{{UserID: "bob"}},
+		})
+		require.NoError(t, err)
+		return event
+	}
+	status := func(event storage.Event) storage.RSVPStatus {
+		event, err := a.storage.GetEvent(context.Background(), event.ID)
+		require.NoError(t, err)
+		attendee, _ := event.Attendee("bob")
+		return attendee.Status
+	}
+
+	pending := invite("pending", start)
+	accepted := invite("accepted", start.Add(2*time.Hour))
+	require.NoError(t, a.RespondToEvent(asUser("bob"), accepted.ID, storage.RSVPAccepted))
+	later := invite("later", start.AddDate(0, 0, 1))
+
+	_, err := a.CreateEvent(asUser("bob"), storage.Event{
+		Title: "vacation", StartAt: start, EndAt: start.Add(8 * time.Hour), Kind: storage.EventOutOfOffice,
+		Attendees: []storage.Attendee{{UserID: "alice"}},
+	})
+	require.ErrorIs(t, err, ErrInvalidEvent)
+	// Out-of-office events never conflict with the other events of the owner.
+	_, err = a.CreateEvent(asUser("bob"), storage.Event{Title: "focus", StartAt: start, EndAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+	away, err := a.CreateEvent(asUser("bob"), storage.Event{
+		Title: "vacation", StartAt: start, EndAt: start.Add(8 * time.Hour), Kind: storage.EventOutOfOffice,
+	})
+	require.NoError(t, err)
+
+	// Pending invitations overlapping the time away are declined, answered and later ones are kept.
+	require.Equal(t, storage.RSVPDeclined, status(pending))
+	require.Equal(t, storage.RSVPAccepted, status(accepted))
+	require.Equal(t, storage.RSVPPending, status(later))
+
+	// New invitations are declined right away.
+	require.Equal(t, storage.RSVPDeclined, status(invite("new", start.Add(4*time.Hour))))
+
+	// Moving the time away declines the invitations it overlaps now.
+	moved := away
+	moved.StartAt, moved.EndAt = later.StartAt, later.EndAt
+	_, err = a.UpdateEvent(asUser("bob"), away.ID, moved)
+	require.NoError(t, err)
+	require.Equal(t, storage.RSVPDeclined, status(later))
+
+	_, err = a.CreateEvent(asUser("bob"), storage.Event{
+		Title: "unknown", StartAt: start, EndAt: start.Add(time.Hour), Kind: "holiday",
+	})
+	require.ErrorIs(t, err, ErrInvalidEvent)
+}
+
+func TestWorkingHours(t *testing.T) {
+	a := newApp()
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+	invalid := []storage.WorkingHours{
+		{Days: []time.Weekday{time.Monday, time.Monday}, Start: 9 * time.Hour, End: 18 * time.Hour},
+		{Days: []time.Weekday{7}, Start: 9 * time.Hour, End: 18 * time.Hour},
+		{Days: weekdays, Start: 18 * time.Hour, End: 9 * time.Hour},
+		{Days: weekdays, Start: 9 * time.Hour, End: 25 * time.Hour},
+		{Days: weekdays, Start: 9 * time.Hour, End: 18 * time.Hour, TimeZone: "Mars/Olympus"},
+	}
+	for _, hours := range invalid {
+		_, err := a.UpdateSettings(asUser("alice"), storage.UserSettings{
+			ConflictPolicy: storage.ConflictReject, WorkingHours: hours,
+		})
+		require.ErrorIs(t, err, ErrInvalidSettings)
+	}
+
+	// 2022-06-01 10:00 UTC is Wednesday.
+	for _, at := range []time.Time{start, start.Add(10 * time.Hour), start.AddDate(0, 0, 3)} {
+		_, err := a.CreateEvent(asUser("alice"), storage.Event{Title: "event", StartAt: at, EndAt: at.Add(time.Hour)})
+		require.NoError(t, err)
+	}
+	outside := func() []bool {
+		events, err := a.ListWeekEvents(asUser("alice"), start)
+		require.NoError(t, err)
+		flags := make([]bool, 0, len(events))
+		for _, event := range events {
+			flags = append(flags, event.OutsideWorkingHours)
+		}
+		return flags
+	}
+	require.Equal(t, []bool{false, false, false}, outside())
+
+	_, err := a.UpdateSettings(asUser("alice"), storage.UserSettings{
+		ConflictPolicy: storage.ConflictReject,
+		WorkingHours:   storage.WorkingHours{Days: weekdays, Start: 9 * time.Hour, End: 18 * time.Hour},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []bool{false, true, true}, outside())
+}
+
+func TestDigestSettings(t *testing.T) {
+	a := newApp()
+
+	_, err := a.UpdateSettings(asUser("alice"), storage.UserSettings{
+		ConflictPolicy: storage.ConflictReject,
+		Digest:         storage.DigestSettings{Enabled: true, TimeZone: "Mars/Olympus"},
+	})
+	require.ErrorIs(t, err, ErrInvalidSettings)
+
+	settings, err := a.UpdateSettings(asUser("alice"), storage.UserSettings{
+		ConflictPolicy: storage.ConflictReject,
+		Digest:         storage.DigestSettings{Enabled: true, TimeZone: "Europe/Moscow"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, storage.DigestSettings{Enabled: true, TimeZone: "Europe/Moscow"}, settings.Digest)
+
+	// Opting out drops the time zone.
+	settings, err = a.UpdateSettings(asUser("alice"), storage.UserSettings{
+		ConflictPolicy: storage.ConflictReject,
+		Digest:         storage.DigestSettings{TimeZone: "Europe/Moscow"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, storage.DigestSettings{}, settings.Digest)
+}
+
+func TestListEvents(t *testing.T) {
+	a := newApp()
+
+	for _, at := range []time.Time{start, start.AddDate(0, 0, 3), start.AddDate(0, 0, 20), start.AddDate(0, 2, 0)} {
+		_, err := a.CreateEvent(asUser("alice"), storage.Event{Title: "event", StartAt: at, EndAt: at.Add(time.Hour)})
+		require.NoError(t, err)
+	}
+
+	events, err := a.ListDayEvents(asUser("alice"), start)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	events, err = a.ListWeekEvents(asUser("alice"), start)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	events, err = a.ListMonthEvents(asUser("alice"), start)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+}
+
+func TestTags(t *testing.T) {
+	a := newApp()
+	ctx := asUser("alice")
+
+	for _, tag := range []storage.Tag{{}, {Name: "a/b"}, {Name: "team", Color: "red"}, {Name: strings.Repeat("x", 33)}} {
+		_, err := a.SaveTag(ctx, tag)
+		require.ErrorIs(t, err, ErrInvalidTag, tag.Name)
+	}
+	tag, err := a.SaveTag(ctx, storage.Tag{Name: " Team ", Color: "#FFAA00"})
+	require.NoError(t, err)
+	require.Equal(t, storage.Tag{UserID: "alice", Name: "team", Color: "#ffaa00"}, tag)
+	_, err = a.SaveTag(ctx, storage.Tag{Name: "planning"})
+	require.NoError(t, err)
+
+	// Events are tagged with the names from the vocabulary of the owner only.
+	_, err = a.CreateEvent(ctx, storage.Event{
+		Title: "event", StartAt: start, EndAt: start.Add(time.Hour), Tags: []string{"team", "unknown"},
+	})
+	require.ErrorIs(t, err, ErrInvalidEvent)
+	_, err = a.CreateEvent(ctx, storage.Event{
+		Title: "event", StartAt: start, EndAt: start.Add(time.Hour), Color: "blue",
+	})
+	require.ErrorIs(t, err, ErrInvalidEvent)
+
+	tagged, err := a.CreateEvent(ctx, storage.Event{
+		Title: "tagged", StartAt: start, EndAt: start.Add(time.Hour),
+		Category: " work ", Color: "#336699", Tags: []string{"TEAM", "planning", "team"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "work", tagged.Category)
+	require.Equal(t, []string{"planning", "team"}, tagged.Tags)
+	_, err = a.CreateEvent(ctx, storage.Event{
+		Title: "other", StartAt: start.Add(time.Hour), EndAt: start.Add(2 * time.Hour),
+	})
+	require.NoError(t, err)
+
+	events, err := a.ListDayEvents(WithTag(ctx, "Team"), start)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, tagged.ID, events[0].ID)
+
+	require.NoError(t, a.DeleteTag(ctx, "team"))
+	require.ErrorIs(t, a.DeleteTag(ctx, "team"), storage.ErrTagNotFound)
+	events, err = a.ListDayEvents(WithTag(ctx, "team"), start)
+	require.NoError(t, err)
+	require.Empty(t, events)
+	tags, err := a.ListTags(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []storage.Tag{{UserID: "alice", Name: "planning"}}, tags)
+}
+
+func TestCreateEventIdempotency(t *testing.T) {
+	a := newApp()
+	now := start
+	a.now = func() time.Time { return now }
+
+	event := storage.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)}
+
+	first, err := a.CreateEvent(WithIdempotencyKey(asUser("alice"), "key-1"), event)
+	require.NoError(t, err)
+
+	retried, err := a.CreateEvent(WithIdempotencyKey(asUser("alice"), "key-1"), event)
+	require.NoError(t, err)
+	require.Equal(t, first, retried)
+
+	// Keys are scoped by user, so the same key of another user creates a new event.
+	other, err := a.CreateEvent(WithIdempotencyKey(asUser("bob"), "key-1"), event)
+	require.NoError(t, err)
+	require.NotEqual(t, first.ID, other.ID)
+
+	// After the TTL the key is forgotten and the overlapping retry is rejected as a new event.
+	now = now.Add(time.Hour)
+	_, err = a.CreateEvent(WithIdempotencyKey(asUser("alice"), "key-1"), event)
+	require.ErrorIs(t, err, storage.ErrDateBusy)
+
+	// Without a key every request creates an event.
+	_, err = a.CreateEvent(asUser("alice"), event)
+	require.ErrorIs(t, err, storage.ErrDateBusy)
+}
+
+func TestCreateEventIdempotencyConcurrent(t *testing.T) {
+	a := newApp()
+	event := storage.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)}
+
+	// Retries racing each other create one event and all of them return it.
+	const retries = 10
+	ids := make(chan string, retries)
+	var wg sync.WaitGroup
+	for i := 0; i < retries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			created, err := a.CreateEvent(WithIdempotencyKey(asUser("alice"), "key-1"), event)
+			require.NoError(t, err)
+			ids <- created.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	first := <-ids
+	for id := range ids {
+		require.Equal(t, first, id)
+	}
+	events, err := a.ListDayEvents(asUser("alice"), start)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+}
+
+func TestCreateEventIdempotencyFailure(t *testing.T) {
+	a := newApp()
+
+	// The key of a failed request is released, so the corrected retry creates the event.
+	_, err := a.CreateEvent(WithIdempotencyKey(asUser("alice"), "key-1"), storage.Event{Title: "meeting"})
+	require.ErrorIs(t, err, ErrInvalidEvent)
+
+	_, err = a.CreateEvent(asUser("alice"), storage.Event{Title: "busy", StartAt: start, EndAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+	event := storage.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)}
+	_, err = a.CreateEvent(WithIdempotencyKey(asUser("alice"), "key-1"), event)
+	require.ErrorIs(t, err, storage.ErrDateBusy)
+
+	event.StartAt, event.EndAt = start.Add(time.Hour), start.Add(2*time.Hour)
+	created, err := a.CreateEvent(WithIdempotencyKey(asUser("alice"), "key-1"), event)
+	require.NoError(t, err)
+	require.Equal(t, "meeting", created.Title)
+}
+
+func TestUnauthenticated(t *testing.T) {
+	ctx := context.Background()
+	a := newApp()
+
+	_, err := a.CreateEvent(ctx, storage.Event{Title: "meeting", StartAt: start, EndAt: start.Add(time.Hour)})
+	require.ErrorIs(t, err, ErrUnauthenticated)
+	_, err = a.ListDayEvents(ctx, start)
+	require.ErrorIs(t, err, ErrUnauthenticated)
+	require.ErrorIs(t, a.DeleteEvent(ctx, "1"), ErrUnauthenticated)
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// MaxBatchSize limits the number of operations in a batch.
+const MaxBatchSize = 100
+
+// BatchOp is an operation of a batch. ID selects the event to update or delete, Event is ignored on delete.
+type BatchOp struct {
+	Kind  storage.BatchOpKind
+	ID    string
+	Event storage.Event
+}
+
+// BatchResult is the outcome of a batch operation: the created, updated or trashed event, or the error.
+type BatchResult struct {
+	Event storage.Event
+	Err   error
+}
+
+var batchAuditActions = map[storage.BatchOpKind]storage.AuditAction{
+	storage.BatchCreate: storage.AuditCreate,
+	storage.BatchUpdate: storage.AuditUpdate,
+	storage.BatchDelete: storage.AuditDelete,
+}
+
+// ApplyBatch applies the operations in a single storage transaction and reports the result of each of them.
+// In the atomic mode nothing is applied if any operation fails, the others fail with storage.ErrBatchAborted.
+// The returned error is set only if the batch as a whole is invalid or can't be applied.
+func (a *App) ApplyBatch(ctx context.Context, ops []BatchOp, mode storage.BatchMode) ([]BatchResult, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 || len(ops) > MaxBatchSize {
+		return nil, fmt.Errorf("%w: expected 1 to %d operations, got %d", ErrInvalidBatch, MaxBatchSize, len(ops))
+	}
+	if !mode.Valid() {
+		return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidBatch, mode)
+	}
+
+	results := make([]BatchResult, len(ops))
+	prepared := make([]storage.BatchOp, 0, len(ops))
+	// Index of the operation and its event before the change, for each prepared operation.
+	indexes := make([]int, 0, len(ops))
+	olds := make([]storage.Event, 0, len(ops))
+	changed := make(map[string]struct{}, len(ops))
+	for i, op := range ops {
+		old, event, err := a.prepareBatchOp(ctx, userID, op)
+		if _, ok := changed[event.ID]; err == nil && ok {
+			err = fmt.Errorf("%w: event %s is changed twice", ErrInvalidBatch, event.ID)
+		}
+		if err != nil {
+			results[i].Err = err
+			if mode == storage.BatchAtomic {
+				return abortResults(results, i), nil
+			}
+			continue
+		}
+		changed[event.ID] = struct{}{}
+		prepared = append(prepared, storage.BatchOp{Kind: op.Kind, Event: event})
+		indexes = append(indexes, i)
+		olds = append(olds, old)
+	}
+	if len(prepared) == 0 {
+		return results, nil
+	}
+
+	errs, err := a.storage.ApplyBatch(ctx, prepared, mode)
+	if err != nil {
+		return nil, err
+	}
+	for j, err := range errs {
+		i := indexes[j]
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Event = prepared[j].Event
+		a.audit(ctx, userID, batchAuditActions[prepared[j].Kind], olds[j], prepared[j].Event)
+		a.declineInvitations(ctx, prepared[j].Event)
+	}
+	a.logger.DebugContext(ctx, fmt.Sprintf("batch of %d operations applied by %s", len(prepared), userID))
+	return results, nil
+}
+
+// prepareBatchOp checks the access and returns the event before and after the operation.
+func (a *App) prepareBatchOp(ctx context.Context, userID string, op BatchOp) (storage.Event, storage.Event, error) {
+	switch op.Kind {
+	case storage.BatchCreate:
+		event, err := a.newEvent(ctx, userID, op.Event)
+		if err != nil {
+			return storage.Event{}, storage.Event{}, err
+		}
+		return storage.Event{ID: event.ID}, event, nil
+	case storage.BatchUpdate:
+		current, err := a.writableEvent(ctx, userID, op.ID)
+		if err != nil {
+			return storage.Event{}, storage.Event{}, err
+		}
+		event, err := a.updatedEvent(ctx, current, op.Event)
+		return current, event, err
+	case storage.BatchDelete:
+		current, err := a.writableEvent(ctx, userID, op.ID)
+		if err != nil {
+			return storage.Event{}, storage.Event{}, err
+		}
+		trashed := current
+		trashed.DeletedAt = a.now()
+		return current, trashed, nil
+	default:
+		return storage.Event{}, storage.Event{}, fmt.Errorf("%w: unknown operation %q", ErrInvalidBatch, op.Kind)
+	}
+}
+
+func abortResults(results []BatchResult, failed int) []BatchResult {
+	for i := range results {
+		if i != failed {
+			results[i] = BatchResult{Err: storage.ErrBatchAborted}
+		}
+	}
+	return results
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyBatch(t *testing.T) {
+	a := newApp()
+	at := func(hours int) storage.Event {
+		startAt := start.Add(time.Duration(hours) * time.Hour)
+		return storage.Event{Title: "meeting", StartAt: startAt, EndAt: startAt.Add(time.Hour)}
+	}
+
+	existing, err := a.CreateEvent(asUser("alice"), at(0))
+	require.NoError(t, err)
+
+	_, err = a.ApplyBatch(asUser("alice"), nil, storage.BatchAtomic)
+	require.ErrorIs(t, err, ErrInvalidBatch)
+	_, err = a.ApplyBatch(asUser("alice"), []BatchOp{{Kind: storage.BatchCreate, Event: at(1)}}, "sometimes")
+	require.ErrorIs(t, err, ErrInvalidBatch)
+
+	t.Run("atomic", func(t *testing.T) {
+		results, err := a.ApplyBatch(asUser("alice"), []BatchOp{
+			{Kind: storage.BatchCreate, Event: at(1)},
+			{Kind: storage.BatchCreate, Event: at(1)},
+		}, storage.BatchAtomic)
+		require.NoError(t, err)
+		require.ErrorIs(t, results[0].Err, storage.ErrBatchAborted)
+		require.ErrorIs(t, results[1].Err, storage.ErrDateBusy)
+
+		// Failed access checks abort the batch before it reaches the storage.
+		results, err = a.ApplyBatch(asUser("bob"), []BatchOp{
+			{Kind: storage.BatchCreate, Event: at(1)},
+			{Kind: storage.BatchDelete, ID: existing.ID},
+		}, storage.BatchAtomic)
+		require.NoError(t, err)
+		require.ErrorIs(t, results[0].Err, storage.ErrBatchAborted)
+		require.ErrorIs(t, results[1].Err, ErrForbidden)
+
+		events, err := a.ListDayEvents(asUser("alice"), start)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		events, err = a.ListDayEvents(asUser("bob"), start)
+		require.NoError(t, err)
+		require.Empty(t, events)
+	})
+
+	t.Run("best effort", func(t *testing.T) {
+		renamed := at(0)
+		renamed.Title = "renamed"
+		results, err := a.ApplyBatch(asUser("alice"), []BatchOp{
+			{Kind: storage.BatchCreate, Event: at(1)},
+			{Kind: storage.BatchCreate, Event: at(1)},
+			{Kind: storage.BatchUpdate, ID: existing.ID, Event: renamed},
+			{Kind: storage.BatchDelete, ID: existing.ID},
+			{Kind: storage.BatchDelete, ID: "missing"},
+		}, storage.BatchBestEffort)
+		require.NoError(t, err)
+		require.NoError(t, results[0].Err)
+		require.NotEmpty(t, results[0].Event.ID)
+		require.ErrorIs(t, results[1].Err, storage.ErrDateBusy)
+		require.NoError(t, results[2].Err)
+		require.Equal(t, "renamed", results[2].Event.Title)
+		require.ErrorIs(t, results[3].Err, ErrInvalidBatch)
+		require.ErrorIs(t, results[4].Err, storage.ErrEventNotFound)
+
+		events, err := a.ListDayEvents(asUser("alice"), start)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		require.Equal(t, "renamed", events[0].Title)
+
+		records, err := a.EventHistory(asUser("alice"), existing.ID)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		require.Equal(t, storage.AuditUpdate, records[1].Action)
+	})
+}
@@ -0,0 +1,53 @@
+package app
+
+import "context"
+
+type ctxKey int
+
+const (
+	userCtxKey ctxKey = iota
+	idempotencyKeyCtxKey
+	sharedCalendarsCtxKey
+	tagFilterCtxKey
+)
+
+// WithUser attaches the authenticated user the request is made on behalf of.
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userCtxKey, userID)
+}
+
+// UserFromContext returns the authenticated user of the request.
+func UserFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userCtxKey).(string)
+	return userID, ok && userID != ""
+}
+
+// WithIdempotencyKey attaches the client supplied key of a create request to the context.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey, key)
+}
+
+func idempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtxKey).(string)
+	return key
+}
+
+// WithSharedCalendars makes list queries include the events of calendars shared with the user.
+func WithSharedCalendars(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sharedCalendarsCtxKey, true)
+}
+
+func sharedCalendars(ctx context.Context) bool {
+	shared, _ := ctx.Value(sharedCalendarsCtxKey).(bool)
+	return shared
+}
+
+// WithTag makes list queries return only the events tagged with the tag.
+func WithTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, tagFilterCtxKey, tag)
+}
+
+func tagFilter(ctx context.Context) (string, bool) {
+	tag, ok := ctx.Value(tagFilterCtxKey).(string)
+	return tag, ok
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+)
+
+// HeaderFunc returns the value of a request header, it abstracts HTTP headers and gRPC metadata.
+type HeaderFunc func(name string) string
+
+// Authenticator resolves the user the request is made on behalf of.
+type Authenticator interface {
+	Authenticate(header HeaderFunc) (string, error)
+}
+
+// HeaderAuthenticator trusts the user ID passed in the header as is, it is meant for development
+// and for deployments behind a gateway that authenticates users itself.
+type HeaderAuthenticator struct {
+	header string
+}
+
+func NewHeaderAuthenticator(header string) *HeaderAuthenticator {
+	return &HeaderAuthenticator{header: header}
+}
+
+func (a *HeaderAuthenticator) Authenticate(header HeaderFunc) (string, error) {
+	userID := strings.TrimSpace(header(a.header))
+	if userID == "" {
+		return "", errors.New(a.header + " header is required")
+	}
+	return userID, nil
+}
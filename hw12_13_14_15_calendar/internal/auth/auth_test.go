@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func headers(kv ...string) HeaderFunc {
+	return func(name string) string {
+		for i := 0; i+1 < len(kv); i += 2 {
+			if kv[i] == name {
+				return kv[i+1]
+			}
+		}
+		return ""
+	}
+}
+
+func writeKey(t *testing.T, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, ioutil.WriteFile(path, data, 0o600))
+	return path
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.RegisteredClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return "Bearer " + token
+}
+
+func TestHeaderAuthenticator(t *testing.T) {
+	a := NewHeaderAuthenticator("X-User-ID")
+
+	userID, err := a.Authenticate(headers("X-User-ID", "alice"))
+	require.NoError(t, err)
+	require.Equal(t, "alice", userID)
+
+	_, err = a.Authenticate(headers())
+	require.Error(t, err)
+}
+
+func TestJWTAuthenticatorHS256(t *testing.T) {
+	secret := []byte("secret")
+	a, err := NewJWTAuthenticator("HS256", writeKey(t, append(secret, '\n')), "calendar", "api")
+	require.NoError(t, err)
+
+	valid := jwt.RegisteredClaims{
+		Subject:   "alice",
+		Issuer:    "calendar",
+		Audience:  jwt.ClaimStrings{"api"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+	userID, err := a.Authenticate(headers("Authorization", sign(t, jwt.SigningMethodHS256, secret, valid)))
+	require.NoError(t, err)
+	require.Equal(t, "alice", userID)
+
+	invalid := map[string]string{
+		"no token":     "",
+		"not a bearer": "Basic YWxpY2U6cGFzcw==",
+		"wrong secret": sign(t, jwt.SigningMethodHS256, []byte("other"), valid),
+		"expired": sign(t, jwt.SigningMethodHS256, secret, jwt.RegisteredClaims{
+			Subject: "alice", Issuer: "calendar", Audience: jwt.ClaimStrings{"api"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		}),
+		"wrong issuer": sign(t, jwt.SigningMethodHS256, secret, jwt.RegisteredClaims{
+			Subject: "alice", Issuer: "other", Audience: jwt.ClaimStrings{"api"},
+		}),
+		"wrong audience": sign(t, jwt.SigningMethodHS256, secret, jwt.RegisteredClaims{
+			Subject: "alice", Issuer: "calendar", Audience: jwt.ClaimStrings{"web"},
+		}),
+		"no subject": sign(t, jwt.SigningMethodHS256, secret, jwt.RegisteredClaims{
+			Issuer: "calendar", Audience: jwt.ClaimStrings{"api"},
+		}),
+	}
+	for name, header := range invalid {
+		_, err := a.Authenticate(headers("Authorization", header))
+		require.Error(t, err, name)
+	}
+}
+
+func TestJWTAuthenticatorRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	a, err := NewJWTAuthenticator("RS256", writeKey(t, public), "", "")
+	require.NoError(t, err)
+
+	userID, err := a.Authenticate(headers("Authorization",
+		sign(t, jwt.SigningMethodRS256, key, jwt.RegisteredClaims{Subject: "bob"})))
+	require.NoError(t, err)
+	require.Equal(t, "bob", userID)
+
+	// HS256 token signed with the public key as a secret must not pass.
+	_, err = a.Authenticate(headers("Authorization",
+		sign(t, jwt.SigningMethodHS256, public, jwt.RegisteredClaims{Subject: "bob"})))
+	require.Error(t, err)
+
+	_, err = NewJWTAuthenticator("RS256", writeKey(t, []byte("not a pem")), "", "")
+	require.Error(t, err)
+	_, err = NewJWTAuthenticator("ES256", writeKey(t, public), "", "")
+	require.Error(t, err)
+}
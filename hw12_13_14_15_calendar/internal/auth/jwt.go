@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const bearerPrefix = "Bearer "
+
+// JWTAuthenticator takes the user ID from the subject of the bearer token in the Authorization header.
+type JWTAuthenticator struct {
+	method   jwt.SigningMethod
+	key      interface{}
+	issuer   string
+	audience string
+}
+
+// NewJWTAuthenticator loads the verification key: the shared secret for HS256
+// or the PEM encoded public key for RS256. Empty issuer and audience are not checked.
+func NewJWTAuthenticator(algorithm, keyFile, issuer, audience string) (*JWTAuthenticator, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read jwt key: %w", err)
+	}
+
+	a := &JWTAuthenticator{issuer: issuer, audience: audience}
+	switch algorithm {
+	case jwt.SigningMethodHS256.Alg():
+		a.method = jwt.SigningMethodHS256
+		a.key = []byte(strings.TrimSpace(string(data)))
+	case jwt.SigningMethodRS256.Alg():
+		a.method = jwt.SigningMethodRS256
+		if a.key, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("parse jwt public key: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", algorithm)
+	}
+	return a, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(header HeaderFunc) (string, error) {
+	value := header("Authorization")
+	if !strings.HasPrefix(value, bearerPrefix) {
+		return "", errors.New("bearer token is required")
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(value, bearerPrefix), &claims,
+		func(token *jwt.Token) (interface{}, error) {
+			if token.Method.Alg() != a.method.Alg() {
+				return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+			}
+			return a.key, nil
+		})
+	if err != nil {
+		return "", fmt.Errorf("invalid token: %w", err)
+	}
+
+	switch {
+	case a.issuer != "" && !claims.VerifyIssuer(a.issuer, true):
+		return "", errors.New("invalid token issuer")
+	case a.audience != "" && !claims.VerifyAudience(a.audience, true):
+		return "", errors.New("invalid token audience")
+	case claims.Subject == "":
+		return "", errors.New("token subject is empty")
+	}
+	return claims.Subject, nil
+}
@@ -0,0 +1,375 @@
+// Package backup dumps the events of a calendar installation to a gzip compressed JSON Lines archive
+// and loads them back into any storage backend.
+//
+// The first line of an archive is the header with its version, the user settings and tags follow, then the events:
+// the trashed ones before the others, so that restoring a trashed event never conflicts with an event
+// which took its time after it was deleted. Version 1 archives have no tags, they are restored as they are.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+const (
+	format = "calendar-backup"
+	// Version is the version of the archives written, archives of newer versions can't be restored.
+	Version = 2
+
+	pageSize = 500
+)
+
+var ErrBadArchive = errors.New("bad backup archive")
+
+// Storage is backed up from a snapshot, so the archive is consistent even if the calendar keeps running,
+// and restored within a single import, so a failed restore leaves it as it was.
+type Storage interface {
+	Snapshot(ctx context.Context, fn func(e storage.Exporter) error) error
+	Import(ctx context.Context, fn func(im storage.Importer) error) error
+}
+
+// Stats counts the records written to or read from an archive.
+type Stats struct {
+	Settings int
+	Tags     int
+	Events   int
+}
+
+type header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// record holds either the settings of a user, a tag or an event.
+type record struct {
+	Settings *settingsRecord `json:"settings,omitempty"`
+	Tag      *tagRecord      `json:"tag,omitempty"`
+	Event    *eventRecord    `json:"event,omitempty"`
+}
+
+type tagRecord struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	Color  string `json:"color,omitempty"`
+}
+
+// settingsRecord keeps the durations as strings like "1h30m" and the weekdays as numbers, Sunday is 0.
+type settingsRecord struct {
+	UserID           string   `json:"user_id"`
+	ConflictPolicy   string   `json:"conflict_policy"`
+	DefaultReminders []string `json:"default_reminders,omitempty"`
+	WorkingDays      []int    `json:"working_days,omitempty"`
+	WorkingStart     string   `json:"working_start,omitempty"`
+	WorkingEnd       string   `json:"working_end,omitempty"`
+	TimeZone         string   `json:"time_zone,omitempty"`
+	DigestEnabled    bool     `json:"digest_enabled,omitempty"`
+	DigestTimeZone   string   `json:"digest_time_zone,omitempty"`
+}
+
+type eventRecord struct {
+	ID          string           `json:"id"`
+	Title       string           `json:"title"`
+	StartAt     time.Time        `json:"start_at"`
+	EndAt       time.Time        `json:"end_at"`
+	Description string           `json:"description,omitempty"`
+	UserID      string           `json:"user_id"`
+	Kind        string           `json:"kind"`
+	Category    string           `json:"category,omitempty"`
+	Color       string           `json:"color,omitempty"`
+	Tags        []string         `json:"tags,omitempty"`
+	Tentative   bool             `json:"tentative,omitempty"`
+	Reminders   []string         `json:"reminders,omitempty"`
+	Attendees   []attendeeRecord `json:"attendees,omitempty"`
+	DeletedAt   *time.Time       `json:"deleted_at,omitempty"`
+}
+
+type attendeeRecord struct {
+	UserID string `json:"user_id"`
+	Status string `json:"status"`
+}
+
+// Backup writes the archive of all the user settings, tags and events of the storage, read from a single snapshot.
+func Backup(ctx context.Context, s Storage, w io.Writer, now time.Time) (Stats, error) {
+	var stats Stats
+	err := s.Snapshot(ctx, func(e storage.Exporter) error {
+		var err error
+		stats, err = backup(ctx, e, w, now)
+		return err
+	})
+	return stats, err
+}
+
+func backup(ctx context.Context, s storage.Exporter, w io.Writer, now time.Time) (Stats, error) {
+	var stats Stats
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	if err := enc.Encode(header{Format: format, Version: Version, CreatedAt: now.UTC()}); err != nil {
+		return stats, fmt.Errorf("write header: %w", err)
+	}
+
+	settings, err := s.ExportUserSettings(ctx)
+	if err != nil {
+		return stats, err
+	}
+	for _, userSettings := range settings {
+		if err := enc.Encode(record{Settings: toSettingsRecord(userSettings)}); err != nil {
+			return stats, fmt.Errorf("write settings: %w", err)
+		}
+		stats.Settings++
+	}
+
+	tags, err := s.ExportTags(ctx)
+	if err != nil {
+		return stats, err
+	}
+	for _, tag := range tags {
+		if err := enc.Encode(record{Tag: &tagRecord{UserID: tag.UserID, Name: tag.Name, Color: tag.Color}}); err != nil {
+			return stats, fmt.Errorf("write tag: %w", err)
+		}
+		stats.Tags++
+	}
+
+	for _, trashed := range []bool{true, false} {
+		afterID := ""
+		for {
+			events, err := s.ExportEvents(ctx, trashed, afterID, pageSize)
+			if err != nil {
+				return stats, err
+			}
+			for _, event := range events {
+				if err := enc.Encode(record{Event: toEventRecord(event)}); err != nil {
+					return stats, fmt.Errorf("write event: %w", err)
+				}
+				stats.Events++
+			}
+			if len(events) < pageSize {
+				break
+			}
+			afterID = events[len(events)-1].ID
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return stats, fmt.Errorf("compress archive: %w", err)
+	}
+	return stats, nil
+}
+
+// Restore loads the archive into the storage, which is expected to be empty. It stops at the first record
+// that fails to restore, e.g. with storage.ErrEventExists, and then nothing of the archive is left in the storage.
+func Restore(ctx context.Context, s Storage, r io.Reader) (Stats, error) {
+	var stats Stats
+	zr, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return stats, fmt.Errorf("%w: %v", ErrBadArchive, err)
+	}
+	defer zr.Close()
+	dec := json.NewDecoder(zr)
+
+	var h header
+	if err := dec.Decode(&h); err != nil {
+		return stats, fmt.Errorf("%w: header: %v", ErrBadArchive, err)
+	}
+	if h.Format != format {
+		return stats, fmt.Errorf("%w: unknown format %q", ErrBadArchive, h.Format)
+	}
+	if h.Version < 1 || h.Version > Version {
+		return stats, fmt.Errorf("%w: unsupported version %d", ErrBadArchive, h.Version)
+	}
+
+	err = s.Import(ctx, func(im storage.Importer) error {
+		var err error
+		stats, err = restoreRecords(ctx, im, dec)
+		return err
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	return stats, nil
+}
+
+// restoreRecords restores the records following the header.
+func restoreRecords(ctx context.Context, im storage.Importer, dec *json.Decoder) (Stats, error) {
+	var stats Stats
+	for line := 2; ; line++ {
+		var rec record
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("%w: line %d: %v", ErrBadArchive, line, err)
+		}
+		switch {
+		case rec.Settings != nil:
+			settings, err := rec.Settings.toUserSettings()
+			if err != nil {
+				return stats, fmt.Errorf("%w: line %d: %v", ErrBadArchive, line, err)
+			}
+			if err := im.SaveUserSettings(ctx, settings); err != nil {
+				return stats, fmt.Errorf("line %d: restore settings of %s: %w", line, settings.UserID, err)
+			}
+			stats.Settings++
+		case rec.Tag != nil:
+			tag := storage.Tag{UserID: rec.Tag.UserID, Name: rec.Tag.Name, Color: rec.Tag.Color}
+			if err := im.SaveTag(ctx, tag); err != nil {
+				return stats, fmt.Errorf("line %d: restore tag %s of %s: %w", line, tag.Name, tag.UserID, err)
+			}
+			stats.Tags++
+		case rec.Event != nil:
+			event, err := rec.Event.toEvent()
+			if err != nil {
+				return stats, fmt.Errorf("%w: line %d: %v", ErrBadArchive, line, err)
+			}
+			if err := restoreEvent(ctx, im, event); err != nil {
+				return stats, fmt.Errorf("line %d: restore event %s: %w", line, event.ID, err)
+			}
+			stats.Events++
+		default:
+			return stats, fmt.Errorf("%w: line %d: empty record", ErrBadArchive, line)
+		}
+	}
+}
+
+// restoreEvent creates the event and moves it to the trash if it was deleted.
+func restoreEvent(ctx context.Context, im storage.Importer, event storage.Event) error {
+	deletedAt := event.DeletedAt
+	event.DeletedAt = time.Time{}
+	if err := im.CreateEvent(ctx, event); err != nil {
+		return err
+	}
+	if deletedAt.IsZero() {
+		return nil
+	}
+	return im.TrashEvent(ctx, event.ID, deletedAt)
+}
+
+func toSettingsRecord(settings storage.UserSettings) *settingsRecord {
+	r := &settingsRecord{
+		UserID:           settings.UserID,
+		ConflictPolicy:   string(settings.ConflictPolicy),
+		DefaultReminders: formatDurations(settings.DefaultReminders),
+		TimeZone:         settings.WorkingHours.TimeZone,
+		DigestEnabled:    settings.Digest.Enabled,
+		DigestTimeZone:   settings.Digest.TimeZone,
+	}
+	if !settings.WorkingHours.IsZero() {
+		r.WorkingStart = settings.WorkingHours.Start.String()
+		r.WorkingEnd = settings.WorkingHours.End.String()
+	}
+	for _, day := range settings.WorkingHours.Days {
+		r.WorkingDays = append(r.WorkingDays, int(day))
+	}
+	return r
+}
+
+func (r settingsRecord) toUserSettings() (storage.UserSettings, error) {
+	settings := storage.UserSettings{
+		UserID:         r.UserID,
+		ConflictPolicy: storage.ConflictPolicy(r.ConflictPolicy),
+		Digest:         storage.DigestSettings{Enabled: r.DigestEnabled, TimeZone: r.DigestTimeZone},
+	}
+	var err error
+	if settings.DefaultReminders, err = parseDurations(r.DefaultReminders); err != nil {
+		return storage.UserSettings{}, err
+	}
+	settings.WorkingHours.TimeZone = r.TimeZone
+	for _, day := range r.WorkingDays {
+		settings.WorkingHours.Days = append(settings.WorkingHours.Days, time.Weekday(day))
+	}
+	if settings.WorkingHours.Start, err = parseDuration(r.WorkingStart); err != nil {
+		return storage.UserSettings{}, err
+	}
+	if settings.WorkingHours.End, err = parseDuration(r.WorkingEnd); err != nil {
+		return storage.UserSettings{}, err
+	}
+	return settings, nil
+}
+
+func toEventRecord(event storage.Event) *eventRecord {
+	r := &eventRecord{
+		ID:          event.ID,
+		Title:       event.Title,
+		StartAt:     event.StartAt.UTC(),
+		EndAt:       event.EndAt.UTC(),
+		Description: event.Description,
+		UserID:      event.UserID,
+		Kind:        string(event.Kind),
+		Category:    event.Category,
+		Color:       event.Color,
+		Tags:        event.Tags,
+		Tentative:   event.Tentative,
+		Reminders:   formatDurations(event.Reminders),
+	}
+	for _, a := range event.Attendees {
+		r.Attendees = append(r.Attendees, attendeeRecord{UserID: a.UserID, Status: string(a.Status)})
+	}
+	if event.Trashed() {
+		deletedAt := event.DeletedAt.UTC()
+		r.DeletedAt = &deletedAt
+	}
+	return r
+}
+
+func (r eventRecord) toEvent() (storage.Event, error) {
+	event := storage.Event{
+		ID:          r.ID,
+		Title:       r.Title,
+		StartAt:     r.StartAt,
+		EndAt:       r.EndAt,
+		Description: r.Description,
+		UserID:      r.UserID,
+		Kind:        storage.EventKind(r.Kind),
+		Category:    r.Category,
+		Color:       r.Color,
+		Tags:        r.Tags,
+		Tentative:   r.Tentative,
+	}
+	var err error
+	if event.Reminders, err = parseDurations(r.Reminders); err != nil {
+		return storage.Event{}, err
+	}
+	for _, a := range r.Attendees {
+		event.Attendees = append(event.Attendees, storage.Attendee{UserID: a.UserID, Status: storage.RSVPStatus(a.Status)})
+	}
+	if r.DeletedAt != nil {
+		event.DeletedAt = *r.DeletedAt
+	}
+	return event, nil
+}
+
+func formatDurations(durations []time.Duration) []string {
+	var formatted []string
+	for _, d := range durations {
+		formatted = append(formatted, d.String())
+	}
+	return formatted
+}
+
+func parseDurations(formatted []string) ([]time.Duration, error) {
+	var durations []time.Duration
+	for _, s := range formatted {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		durations = append(durations, d)
+	}
+	return durations, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
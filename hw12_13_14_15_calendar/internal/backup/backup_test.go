@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var day = time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+func newEvent(id, userID string, start time.Time) storage.Event {
+	return storage.Event{
+		ID:      id,
+		Title:   "event " + id,
+		StartAt: start,
+		EndAt:   start.Add(time.Hour),
+		UserID:  userID,
+		Kind:    storage.EventRegular,
+	}
+}
+
+func export(t *testing.T, s storage.Exporter) ([]storage.UserSettings, []storage.Event) {
+	t.Helper()
+	ctx := context.Background()
+	settings, err := s.ExportUserSettings(ctx)
+	require.NoError(t, err)
+	trashed, err := s.ExportEvents(ctx, true, "", 100)
+	require.NoError(t, err)
+	events, err := s.ExportEvents(ctx, false, "", 100)
+	require.NoError(t, err)
+	return settings, append(trashed, events...)
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	s := memorystorage.New()
+
+	// Alice's events overlap, which her settings allow.
+	require.NoError(t, s.SaveUserSettings(ctx, storage.UserSettings{
+		UserID:           "alice",
+		ConflictPolicy:   storage.ConflictAllow,
+		DefaultReminders: []time.Duration{15 * time.Minute},
+		WorkingHours: storage.WorkingHours{
+			Days:     []time.Weekday{time.Monday, time.Tuesday},
+			Start:    9 * time.Hour,
+			End:      17*time.Hour + 30*time.Minute,
+			TimeZone: "Europe/Moscow",
+		},
+		Digest: storage.DigestSettings{Enabled: true, TimeZone: "Europe/Moscow"},
+	}))
+	meeting := newEvent("1", "alice", day.Add(10*time.Hour))
+	meeting.Description = "planning"
+	meeting.Reminders = []time.Duration{time.Hour, 5 * time.Minute}
+	meeting.Attendees = []storage.Attendee{{UserID: "bob", Status: storage.RSVPAccepted}}
+	meeting.Category = "work"
+	meeting.Color = "#336699"
+	meeting.Tags = []string{"planning", "team"}
+	require.NoError(t, s.SaveTag(ctx, storage.Tag{UserID: "alice", Name: "planning"}))
+	require.NoError(t, s.SaveTag(ctx, storage.Tag{UserID: "alice", Name: "team", Color: "#00aa00"}))
+	require.NoError(t, s.CreateEvent(ctx, meeting))
+	require.NoError(t, s.CreateEvent(ctx, newEvent("2", "alice", day.Add(10*time.Hour))))
+
+	// Bob's deleted event took the time of the new one.
+	require.NoError(t, s.CreateEvent(ctx, newEvent("3", "bob", day.Add(12*time.Hour))))
+	require.NoError(t, s.TrashEvent(ctx, "3", day))
+	require.NoError(t, s.CreateEvent(ctx, newEvent("4", "bob", day.Add(12*time.Hour))))
+
+	var archive bytes.Buffer
+	stats, err := Backup(ctx, s, &archive, day)
+	require.NoError(t, err)
+	require.Equal(t, Stats{Settings: 1, Tags: 2, Events: 4}, stats)
+
+	restored := memorystorage.New()
+	stats, err = Restore(ctx, restored, bytes.NewReader(archive.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, Stats{Settings: 1, Tags: 2, Events: 4}, stats)
+
+	wantSettings, wantEvents := export(t, s)
+	gotSettings, gotEvents := export(t, restored)
+	require.Equal(t, wantSettings, gotSettings)
+	require.Equal(t, wantEvents, gotEvents)
+	wantTags, err := s.ExportTags(ctx)
+	require.NoError(t, err)
+	gotTags, err := restored.ExportTags(ctx)
+	require.NoError(t, err)
+	require.Equal(t, wantTags, gotTags)
+
+	// Restoring into a storage with the same events fails.
+	_, err = Restore(ctx, restored, bytes.NewReader(archive.Bytes()))
+	require.ErrorIs(t, err, storage.ErrEventExists)
+
+	// A failed restore leaves nothing of the archive, though the last event is the one failing.
+	partial := memorystorage.New()
+	require.NoError(t, partial.CreateEvent(ctx, newEvent("4", "carol", day)))
+	wantSettings, wantEvents = export(t, partial)
+	stats, err = Restore(ctx, partial, bytes.NewReader(archive.Bytes()))
+	require.ErrorIs(t, err, storage.ErrEventExists)
+	require.Equal(t, Stats{}, stats)
+	gotSettings, gotEvents = export(t, partial)
+	require.Equal(t, wantSettings, gotSettings)
+	require.Equal(t, wantEvents, gotEvents)
+	gotTags, err = partial.ExportTags(ctx)
+	require.NoError(t, err)
+	require.Empty(t, gotTags)
+}
+
+func TestRestoreBadArchive(t *testing.T) {
+	compressed := func(s string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte(s))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		return &buf
+	}
+
+	for name, archive := range map[string]*bytes.Buffer{
+		"not compressed": bytes.NewBufferString(`{"format":"calendar-backup","version":1}`),
+		"unknown format": compressed(`{"format":"ics","version":1}`),
+		"newer version":  compressed(`{"format":"calendar-backup","version":3}`),
+		"empty record":   compressed("{\"format\":\"calendar-backup\",\"version\":1}\n{}\n"),
+		"bad reminder": compressed(strings.Join([]string{
+			`{"format":"calendar-backup","version":1}`,
+			`{"event":{"id":"1","user_id":"alice","reminders":["soon"]}}`,
+		}, "\n")),
+		"bad record after good ones": compressed(strings.Join([]string{
+			`{"format":"calendar-backup","version":2}`,
+			`{"settings":{"user_id":"alice","conflict_policy":"allow"}}`,
+			`{"tag":{"user_id":"alice","name":"team"}}`,
+			`{"event":{"id":"1","title":"event 1","start_at":"2021-05-10T10:00:00Z","end_at":"2021-05-10T11:00:00Z",` +
+				`"user_id":"alice","kind":"regular"}}`,
+			`{}`,
+		}, "\n")),
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := memorystorage.New()
+			_, err := Restore(context.Background(), s, archive)
+			require.ErrorIs(t, err, ErrBadArchive)
+
+			settings, events := export(t, s)
+			require.Empty(t, settings)
+			require.Empty(t, events)
+			tags, err := s.ExportTags(context.Background())
+			require.NoError(t, err)
+			require.Empty(t, tags)
+		})
+	}
+}
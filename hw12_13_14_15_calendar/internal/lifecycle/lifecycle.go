@@ -0,0 +1,155 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Component is a long-running part of a process: a server, the scheduler or the sender.
+// Start blocks until the component is stopped. Stop makes it refuse new work and waits for the work
+// in progress to finish, giving up when the context is done.
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// CloseFunc releases a resource used by the components, e.g. the storage or the queue connection.
+type CloseFunc func(ctx context.Context) error
+
+type Logger interface {
+	Info(msg string)
+	Error(msg string)
+}
+
+// Lifecycle runs the components of a process until it is told to shut down, then drains them
+// and releases the resources.
+type Lifecycle struct {
+	logger       Logger
+	drainTimeout time.Duration
+	closeTimeout time.Duration
+	components   []namedComponent
+	closers      []namedCloser
+}
+
+type namedComponent struct {
+	name string
+	Component
+}
+
+type namedCloser struct {
+	name  string
+	close CloseFunc
+}
+
+// New creates the lifecycle. Components get drainTimeout to finish the work in progress,
+// then resources get closeTimeout to be closed.
+func New(logger Logger, drainTimeout, closeTimeout time.Duration) *Lifecycle {
+	return &Lifecycle{
+		logger:       logger,
+		drainTimeout: drainTimeout,
+		closeTimeout: closeTimeout,
+	}
+}
+
+// Add registers the component to be started by Run.
+func (l *Lifecycle) Add(name string, component Component) {
+	l.components = append(l.components, namedComponent{name: name, Component: component})
+}
+
+// AddCloser registers the resource to be closed once the components are stopped.
+// Resources are closed in the reverse order, the one added first is closed last.
+func (l *Lifecycle) AddCloser(name string, closeFunc CloseFunc) {
+	l.closers = append(l.closers, namedCloser{name: name, close: closeFunc})
+}
+
+// Run starts the components and blocks until the context is done or any component fails, then shuts
+// everything down. The components run with their own context, which is canceled only if they don't
+// drain in time, so the shutdown signal doesn't interrupt the requests in flight.
+// The error of the failed component is returned.
+func (l *Lifecycle) Run(ctx context.Context) error {
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
+
+	var wg sync.WaitGroup
+	failed := make(chan error, len(l.components))
+	for _, c := range l.components {
+		wg.Add(1)
+		go func(c namedComponent) {
+			defer wg.Done()
+			if err := c.Start(runCtx); err != nil {
+				failed <- fmt.Errorf("%s: %w", c.name, err)
+			}
+		}(c)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		l.logger.Info("shutting down...")
+	case err = <-failed:
+		l.logger.Error("shutting down after failure: " + err.Error())
+	}
+
+	if !l.drain() {
+		l.logger.Error("components did not drain in time, aborting the work in progress")
+		cancelRun()
+	}
+	if !waitTimeout(&wg, l.closeTimeout) {
+		l.logger.Error("components did not stop")
+	}
+	l.close()
+	return err
+}
+
+// drain stops the components concurrently and reports whether all of them stopped in time.
+func (l *Lifecycle) drain() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), l.drainTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ok := true
+	for _, c := range l.components {
+		wg.Add(1)
+		go func(c namedComponent) {
+			defer wg.Done()
+			if err := c.Stop(ctx); err != nil {
+				l.logger.Error("failed to stop " + c.name + ": " + err.Error())
+				mu.Lock()
+				ok = false
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	return ok
+}
+
+func (l *Lifecycle) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), l.closeTimeout)
+	defer cancel()
+
+	for i := len(l.closers) - 1; i >= 0; i-- {
+		c := l.closers[i]
+		if err := c.close(ctx); err != nil {
+			l.logger.Error("failed to close " + c.name + ": " + err.Error())
+		}
+	}
+}
+
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,118 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// component works until it is stopped, then spends drain time finishing the work in progress.
+type component struct {
+	drain    time.Duration
+	startErr error
+	stop     chan struct{}
+	done     chan struct{}
+	aborted  bool
+}
+
+func newComponent(drain time.Duration) *component {
+	return &component{drain: drain, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (c *component) Start(ctx context.Context) error {
+	defer close(c.done)
+	if c.startErr != nil {
+		return c.startErr
+	}
+
+	select {
+	case <-c.stop:
+	case <-ctx.Done():
+	}
+	select {
+	case <-time.After(c.drain):
+	case <-ctx.Done():
+		c.aborted = true
+	}
+	return nil
+}
+
+func (c *component) Stop(ctx context.Context) error {
+	close(c.stop)
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type closeLog struct {
+	mu     sync.Mutex
+	closed []string
+}
+
+func (l *closeLog) closer(name string) CloseFunc {
+	return func(ctx context.Context) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.closed = append(l.closed, name)
+		return nil
+	}
+}
+
+func TestRun(t *testing.T) {
+	logg := logger.NewWithWriter("error", io.Discard)
+
+	t.Run("drains components then closes resources", func(t *testing.T) {
+		var closed closeLog
+		fast, slow := newComponent(0), newComponent(50*time.Millisecond)
+		lc := New(logg, time.Second, time.Second)
+		lc.Add("fast", fast)
+		lc.Add("slow", slow)
+		lc.AddCloser("storage", closed.closer("storage"))
+		lc.AddCloser("queue", closed.closer("queue"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.NoError(t, lc.Run(ctx))
+		require.False(t, fast.aborted)
+		require.False(t, slow.aborted)
+		require.Equal(t, []string{"queue", "storage"}, closed.closed)
+	})
+
+	t.Run("aborts components not drained in time", func(t *testing.T) {
+		var closed closeLog
+		slow := newComponent(time.Minute)
+		lc := New(logg, 50*time.Millisecond, time.Second)
+		lc.Add("slow", slow)
+		lc.AddCloser("storage", closed.closer("storage"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.NoError(t, lc.Run(ctx))
+		require.True(t, slow.aborted)
+		require.Equal(t, []string{"storage"}, closed.closed)
+	})
+
+	t.Run("shuts down after failure", func(t *testing.T) {
+		var closed closeLog
+		failing, other := newComponent(0), newComponent(0)
+		failing.startErr = errors.New("address in use")
+		lc := New(logg, time.Second, time.Second)
+		lc.Add("failing", failing)
+		lc.Add("other", other)
+		lc.AddCloser("storage", closed.closer("storage"))
+
+		err := lc.Run(context.Background())
+		require.EqualError(t, err, "failing: address in use")
+		require.False(t, other.aborted)
+		require.Equal(t, []string{"storage"}, closed.closed)
+	})
+}
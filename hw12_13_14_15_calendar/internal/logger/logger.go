@@ -1,20 +1,107 @@
 package logger
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
-type Logger struct { // TODO
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/requestid"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+type Logger struct {
+	mu    sync.Mutex
+	level Level
+	out   io.Writer
 }
 
 func New(level string) *Logger {
-	return &Logger{}
+	return NewWithWriter(level, os.Stdout)
+}
+
+func NewWithWriter(level string, out io.Writer) *Logger {
+	return &Logger{
+		level: ParseLevel(level),
+		out:   out,
+	}
+}
+
+// ParseLevel converts level name from config, falling back to INFO for unknown names.
+func ParseLevel(level string) Level {
+	for l, name := range levelNames {
+		if strings.EqualFold(level, name) {
+			return l
+		}
+	}
+	return LevelInfo
+}
+
+func (l *Logger) Debug(msg string) {
+	l.log(LevelDebug, msg)
+}
+
+func (l *Logger) Info(msg string) {
+	l.log(LevelInfo, msg)
 }
 
-func (l Logger) Info(msg string) {
-	fmt.Println(msg)
+func (l *Logger) Warn(msg string) {
+	l.log(LevelWarn, msg)
 }
 
-func (l Logger) Error(msg string) {
-	// TODO
+func (l *Logger) Error(msg string) {
+	l.log(LevelError, msg)
 }
 
-// TODO
+// DebugContext, InfoContext, WarnContext and ErrorContext add the request ID of the context to the line.
+func (l *Logger) DebugContext(ctx context.Context, msg string) {
+	l.log(LevelDebug, withRequestID(ctx, msg))
+}
+
+func (l *Logger) InfoContext(ctx context.Context, msg string) {
+	l.log(LevelInfo, withRequestID(ctx, msg))
+}
+
+func (l *Logger) WarnContext(ctx context.Context, msg string) {
+	l.log(LevelWarn, withRequestID(ctx, msg))
+}
+
+func (l *Logger) ErrorContext(ctx context.Context, msg string) {
+	l.log(LevelError, withRequestID(ctx, msg))
+}
+
+func withRequestID(ctx context.Context, msg string) string {
+	if id, ok := requestid.FromContext(ctx); ok {
+		return msg + " request_id=" + id
+	}
+	return msg
+}
+
+func (l *Logger) log(level Level, msg string) {
+	if level < l.level {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fmt.Fprintf(l.out, "%s %s %s\n", time.Now().Format(time.RFC3339), levelNames[level], msg)
+}
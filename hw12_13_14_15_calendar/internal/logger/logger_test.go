@@ -1,7 +1,52 @@
 package logger
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/requestid"
+	"github.com/stretchr/testify/require"
+)
 
 func TestLogger(t *testing.T) {
-	// TODO
+	t.Run("level filtering", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		l := NewWithWriter("warn", buf)
+
+		l.Debug("debug message")
+		l.Info("info message")
+		l.Warn("warn message")
+		l.Error("error message")
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+		require.Contains(t, lines[0], "WARN warn message")
+		require.Contains(t, lines[1], "ERROR error message")
+	})
+
+	t.Run("unknown level falls back to info", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		l := NewWithWriter("verbose", buf)
+
+		l.Debug("debug message")
+		l.Info("info message")
+
+		require.NotContains(t, buf.String(), "debug message")
+		require.Contains(t, buf.String(), "INFO info message")
+	})
+
+	t.Run("request id from context", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		l := NewWithWriter("debug", buf)
+
+		l.InfoContext(requestid.WithID(context.Background(), "abc-123"), "event created")
+		l.ErrorContext(context.Background(), "request failed")
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+		require.Contains(t, lines[0], "INFO event created request_id=abc-123")
+		require.True(t, strings.HasSuffix(lines[1], "ERROR request failed"))
+	})
 }
@@ -0,0 +1,52 @@
+package memoryqueue
+
+import (
+	"context"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+)
+
+// Queue passes messages between the calendar processes running in one process, e.g. in tests.
+type Queue struct {
+	messages chan queue.Message
+}
+
+func New(size int) *Queue {
+	return &Queue{messages: make(chan queue.Message, size)}
+}
+
+// Publish blocks while the queue is full.
+func (q *Queue) Publish(ctx context.Context, msg queue.Message) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case q.messages <- msg:
+		return nil
+	}
+}
+
+// Consume passes the messages to handle until the context is done, the message being handled is finished
+// first. A message that failed is put back to the end of the queue, unless the queue is full.
+func (q *Queue) Consume(ctx context.Context, handle func(ctx context.Context, msg queue.Message) error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-q.messages:
+			// The message may be picked even if the context is done already.
+			if ctx.Err() != nil {
+				select {
+				case q.messages <- msg:
+				default:
+				}
+				return nil
+			}
+			if err := handle(ctx, msg); err != nil {
+				select {
+				case q.messages <- msg:
+				default:
+				}
+			}
+		}
+	}
+}
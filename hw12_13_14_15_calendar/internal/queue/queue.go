@@ -0,0 +1,7 @@
+package queue
+
+// Message is what the calendar processes exchange through the queue, independent of the broker client.
+type Message struct {
+	Body    []byte
+	Headers map[string]string // E.g. the request ID the message is sent within.
+}
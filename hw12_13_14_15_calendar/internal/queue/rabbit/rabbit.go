@@ -0,0 +1,116 @@
+package rabbit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Client publishes to and consumes from the durable RabbitMQ queue through the default exchange.
+type Client struct {
+	uri     string
+	queue   string
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+func New(uri, queue string) *Client {
+	return &Client{
+		uri:   uri,
+		queue: queue,
+	}
+}
+
+// Connect dials the broker and declares the queue, so the processes need no manual broker setup.
+func (c *Client) Connect(ctx context.Context) error {
+	conn, err := amqp.Dial(c.uri)
+	if err != nil {
+		return fmt.Errorf("dial rabbitmq: %w", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("open channel: %w", err)
+	}
+	if _, err := channel.QueueDeclare(c.queue, true, false, false, false, nil); err != nil {
+		conn.Close()
+		return fmt.Errorf("declare queue %s: %w", c.queue, err)
+	}
+
+	c.conn = conn
+	c.channel = channel
+	return nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) Publish(ctx context.Context, msg queue.Message) error {
+	err := c.channel.PublishWithContext(ctx, "", c.queue, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Headers:      toTable(msg.Headers),
+		Body:         msg.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("publish to %s: %w", c.queue, err)
+	}
+	return nil
+}
+
+// Consume passes the messages to handle until the context is done, the message being handled is finished
+// first. Handled messages are acknowledged, the ones that failed are requeued.
+func (c *Client) Consume(ctx context.Context, handle func(ctx context.Context, msg queue.Message) error) error {
+	deliveries, err := c.channel.Consume(c.queue, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("consume from %s: %w", c.queue, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return fmt.Errorf("consume from %s: %w", c.queue, amqp.ErrClosed)
+			}
+			// The delivery may be picked even if the context is done already.
+			if ctx.Err() != nil {
+				return delivery.Nack(false, true)
+			}
+			if err := handle(ctx, queue.Message{Body: delivery.Body, Headers: fromTable(delivery.Headers)}); err != nil {
+				err = delivery.Nack(false, true)
+			} else {
+				err = delivery.Ack(false)
+			}
+			if err != nil {
+				return fmt.Errorf("acknowledge delivery: %w", err)
+			}
+		}
+	}
+}
+
+func toTable(headers map[string]string) amqp.Table {
+	if len(headers) == 0 {
+		return nil
+	}
+	table := make(amqp.Table, len(headers))
+	for k, v := range headers {
+		table[k] = v
+	}
+	return table
+}
+
+// fromTable keeps the string headers only, the calendar doesn't send others.
+func fromTable(table amqp.Table) map[string]string {
+	headers := make(map[string]string, len(table))
+	for k, v := range table {
+		if s, ok := v.(string); ok {
+			headers[k] = s
+		}
+	}
+	return headers
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets refilled up to the burst are dropped, so idle clients do not pile up.
+const sweepInterval = time.Minute
+
+// Limiter throttles requests with token buckets kept separately per user ID and per client IP.
+type Limiter struct {
+	byUser *buckets
+	byIP   *buckets
+}
+
+// New creates the limiter, a zero rate disables the corresponding dimension.
+func New(userRate float64, userBurst int, ipRate float64, ipBurst int) *Limiter {
+	return &Limiter{
+		byUser: newBuckets(userRate, userBurst),
+		byIP:   newBuckets(ipRate, ipBurst),
+	}
+}
+
+// AllowIP takes a token from the bucket of the client IP. It is checked before authentication,
+// so that requests with missing or invalid credentials are limited too. When the request is rejected
+// it returns how long the client should wait before retrying.
+func (l *Limiter) AllowIP(ip string) (bool, time.Duration) {
+	return l.byIP.take(ip)
+}
+
+// AllowUser takes a token from the bucket of the authenticated user, like AllowIP does.
+func (l *Limiter) AllowUser(userID string) (bool, time.Duration) {
+	return l.byUser.take(userID)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type buckets struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	items     map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newBuckets(rate float64, burst int) *buckets {
+	if burst < 1 {
+		burst = 1
+	}
+	return &buckets{
+		rate:  rate,
+		burst: float64(burst),
+		items: make(map[string]*bucket),
+		now:   time.Now,
+	}
+}
+
+func (b *buckets) take(key string) (bool, time.Duration) {
+	if b.rate <= 0 {
+		return true, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.sweep(now)
+
+	item, ok := b.items[key]
+	if !ok {
+		item = &bucket{tokens: b.burst, updated: now}
+		b.items[key] = item
+	}
+	item.tokens = math.Min(b.burst, item.tokens+now.Sub(item.updated).Seconds()*b.rate)
+	item.updated = now
+
+	if item.tokens < 1 {
+		wait := (1 - item.tokens) / b.rate
+		return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+	}
+	item.tokens--
+	return true, 0
+}
+
+func (b *buckets) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < sweepInterval {
+		return
+	}
+	b.lastSweep = now
+
+	for key, item := range b.items {
+		if item.tokens+now.Sub(item.updated).Seconds()*b.rate >= b.burst {
+			delete(b.items, key)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Run("by user", func(t *testing.T) {
+		l := New(1, 2, 0, 0)
+		now := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+		l.byUser.now = func() time.Time { return now }
+
+		for i := 0; i < 2; i++ {
+			ok, _ := l.AllowUser("alice")
+			require.True(t, ok)
+		}
+		ok, retryAfter := l.AllowUser("alice")
+		require.False(t, ok)
+		require.Equal(t, time.Second, retryAfter)
+
+		// Other users have their own buckets.
+		ok, _ = l.AllowUser("bob")
+		require.True(t, ok)
+
+		now = now.Add(500 * time.Millisecond)
+		ok, retryAfter = l.AllowUser("alice")
+		require.False(t, ok)
+		require.Equal(t, 500*time.Millisecond, retryAfter)
+
+		now = now.Add(500 * time.Millisecond)
+		ok, _ = l.AllowUser("alice")
+		require.True(t, ok)
+	})
+
+	t.Run("by ip", func(t *testing.T) {
+		l := New(0, 0, 1, 1)
+		now := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+		l.byIP.now = func() time.Time { return now }
+
+		ok, _ := l.AllowIP("10.0.0.1")
+		require.True(t, ok)
+		ok, _ = l.AllowIP("10.0.0.1")
+		require.False(t, ok)
+		ok, _ = l.AllowIP("10.0.0.2")
+		require.True(t, ok)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		l := New(0, 0, 0, 0)
+
+		for i := 0; i < 100; i++ {
+			ok, _ := l.AllowIP("10.0.0.1")
+			require.True(t, ok)
+			ok, _ = l.AllowUser("alice")
+			require.True(t, ok)
+		}
+	})
+
+	t.Run("idle buckets are dropped", func(t *testing.T) {
+		l := New(1, 1, 0, 0)
+		now := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+		l.byUser.now = func() time.Time { return now }
+
+		l.AllowUser("alice")
+		l.AllowUser("bob")
+		require.Len(t, l.byUser.items, 2)
+
+		now = now.Add(sweepInterval)
+		l.AllowUser("carol")
+		require.Len(t, l.byUser.items, 1)
+	})
+}
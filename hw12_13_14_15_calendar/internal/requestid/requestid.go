@@ -0,0 +1,53 @@
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Header carries the request ID between the client, the calendar processes and the queue.
+const Header = "X-Request-ID"
+
+// MaxLength limits the length of an ID accepted from a client.
+const MaxLength = 128
+
+type ctxKey struct{}
+
+// New generates a new request ID.
+func New() string {
+	return uuid.New().String()
+}
+
+// Valid reports whether the client supplied ID can be used as is: not empty, not too long
+// and made of printable ASCII characters only, so it can't break the log lines.
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Ensure returns id if it's valid, otherwise a newly generated one.
+func Ensure(id string) string {
+	if Valid(id) {
+		return id
+	}
+	return New()
+}
+
+// WithID attaches the request ID to the context.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID of the context.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok && id != ""
+}
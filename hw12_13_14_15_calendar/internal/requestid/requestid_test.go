@@ -0,0 +1,28 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsure(t *testing.T) {
+	require.Equal(t, "abc-123", Ensure("abc-123"))
+
+	for _, id := range []string{"", "with space", "line\nbreak", strings.Repeat("a", MaxLength+1)} {
+		generated := Ensure(id)
+		require.NotEqual(t, id, generated)
+		require.True(t, Valid(generated))
+	}
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	require.False(t, ok)
+
+	id, ok := FromContext(WithID(context.Background(), "abc-123"))
+	require.True(t, ok)
+	require.Equal(t, "abc-123", id)
+}
@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/requestid"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Scheduler periodically sends reminders of upcoming events and daily digests to the queue
+// and cleans up the storage.
+type Scheduler struct {
+	logger         Logger
+	storage        Storage
+	publisher      Publisher
+	interval       time.Duration
+	eventRetention time.Duration
+	trashRetention time.Duration
+	digestAt       time.Duration
+	now            func() time.Time
+	stopOnce       sync.Once
+	stop           chan struct{}
+	done           chan struct{}
+}
+
+type Logger interface {
+	DebugContext(ctx context.Context, msg string)
+	InfoContext(ctx context.Context, msg string)
+	ErrorContext(ctx context.Context, msg string)
+}
+
+type Storage interface {
+	ListRemindersDue(ctx context.Context, from, to time.Time) ([]storage.Reminder, error)
+	ListDigestSettings(ctx context.Context) ([]storage.UserSettings, error)
+	ListEvents(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error)
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+	DeleteOldEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, msg queue.Message) error
+}
+
+// New creates the scheduler. Events finished more than eventRetention ago are deleted,
+// events deleted by users are purged from the trash after trashRetention. The users opted in
+// get the digest of their day at digestAt since the midnight of their time zone.
+func New(
+	logger Logger, storage Storage, publisher Publisher,
+	interval, eventRetention, trashRetention, digestAt time.Duration,
+) *Scheduler {
+	return &Scheduler{
+		logger:         logger,
+		storage:        storage,
+		publisher:      publisher,
+		interval:       interval,
+		eventRetention: eventRetention,
+		trashRetention: trashRetention,
+		digestAt:       digestAt,
+		now:            time.Now,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+}
+
+// Start ticks until the scheduler is stopped or the context is done. Every tick notifies about events
+// whose reminder time has come since the previous tick and sends the digests due since then.
+// The context is passed to the storage and the queue, so canceling it interrupts the current tick.
+// Each tick gets its own request ID for the log lines, each notification gets another one,
+// passed to the sender in the message headers.
+func (s *Scheduler) Start(ctx context.Context) error {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	from := s.now()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.stop:
+			return nil
+		case <-ticker.C:
+			to := s.now()
+			tickCtx := requestid.WithID(ctx, requestid.New())
+			s.notify(tickCtx, from, to)
+			s.digest(tickCtx, from, to)
+			s.cleanup(tickCtx, to)
+			from = to
+		}
+	}
+}
+
+// Stop waits for the current tick to finish, giving up when the context is done.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) notify(ctx context.Context, from, to time.Time) {
+	reminders, err := s.storage.ListRemindersDue(ctx, from, to)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to list reminders due: "+err.Error())
+		return
+	}
+
+	for _, reminder := range reminders {
+		event := reminder.Event
+		for _, notification := range reminder.Notifications() {
+			ctx := requestid.WithID(ctx, requestid.New())
+			if err := s.publish(ctx, notification); err != nil {
+				s.logger.ErrorContext(ctx, fmt.Sprintf("failed to notify %s about %s: %s",
+					notification.UserID, notification.Subject(), err))
+				continue
+			}
+			s.logger.DebugContext(ctx, fmt.Sprintf("%s reminder about event %s queued for %s",
+				reminder.Before, event.ID, notification.UserID))
+		}
+	}
+}
+
+// digest sends the users their events of the day whose digest time has come. Days without
+// events are skipped.
+func (s *Scheduler) digest(ctx context.Context, from, to time.Time) {
+	settings, err := s.storage.ListDigestSettings(ctx)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to list digest settings: "+err.Error())
+		return
+	}
+
+	for _, userSettings := range settings {
+		day, ok := userSettings.Digest.Due(from, to, s.digestAt)
+		if !ok {
+			continue
+		}
+		ctx := requestid.WithID(ctx, requestid.New())
+		events, err := s.storage.ListEvents(ctx, userSettings.UserID, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			s.logger.ErrorContext(ctx, fmt.Sprintf("failed to list events of %s for digest: %s",
+				userSettings.UserID, err))
+			continue
+		}
+		notification := storage.Digest(userSettings.UserID, day, events)
+		if len(notification.Agenda) == 0 {
+			continue
+		}
+		if err := s.publish(ctx, notification); err != nil {
+			s.logger.ErrorContext(ctx, fmt.Sprintf("failed to notify %s about %s: %s",
+				notification.UserID, notification.Subject(), err))
+			continue
+		}
+		s.logger.DebugContext(ctx, fmt.Sprintf("%s queued for %s", notification.Subject(), notification.UserID))
+	}
+}
+
+func (s *Scheduler) publish(ctx context.Context, notification storage.Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	}
+	id, _ := requestid.FromContext(ctx)
+	return s.publisher.Publish(ctx, queue.Message{Body: body, Headers: map[string]string{requestid.Header: id}})
+}
+
+func (s *Scheduler) cleanup(ctx context.Context, now time.Time) {
+	if s.trashRetention > 0 {
+		purged, err := s.storage.PurgeTrash(ctx, now.Add(-s.trashRetention))
+		if err != nil {
+			s.logger.ErrorContext(ctx, "failed to purge trash: "+err.Error())
+		} else if purged > 0 {
+			s.logger.InfoContext(ctx, fmt.Sprintf("%d events purged from trash", purged))
+		}
+	}
+
+	if s.eventRetention > 0 {
+		deleted, err := s.storage.DeleteOldEvents(ctx, now.Add(-s.eventRetention))
+		if err != nil {
+			s.logger.ErrorContext(ctx, "failed to delete old events: "+err.Error())
+		} else if deleted > 0 {
+			s.logger.InfoContext(ctx, fmt.Sprintf("%d old events deleted", deleted))
+		}
+	}
+}
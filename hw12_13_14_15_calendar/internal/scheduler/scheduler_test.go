@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/requestid"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+
+type publisher struct {
+	notifications []storage.Notification
+	requestIDs    []string
+	err           error
+}
+
+func (p *publisher) Publish(ctx context.Context, msg queue.Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	var notification storage.Notification
+	if err := json.Unmarshal(msg.Body, &notification); err != nil {
+		return err
+	}
+	p.notifications = append(p.notifications, notification)
+	p.requestIDs = append(p.requestIDs, msg.Headers[requestid.Header])
+	return nil
+}
+
+func TestNotify(t *testing.T) {
+	ctx := context.Background()
+	s := memorystorage.New()
+	events := []storage.Event{
+		{ID: "1", Title: "soon", StartAt: now.Add(time.Hour), EndAt: now.Add(2 * time.Hour), UserID: "alice",
+			Reminders: []time.Duration{2 * time.Hour, time.Hour}, Attendees: []storage.Attendee{
+				{UserID: "bob", Status: storage.RSVPAccepted},
+				{UserID: "carol", Status: storage.RSVPDeclined},
+			}},
+		{ID: "2", Title: "later", StartAt: now.Add(3 * time.Hour), EndAt: now.Add(4 * time.Hour), UserID: "alice",
+			Reminders: []time.Duration{3 * time.Hour, time.Hour}},
+		{ID: "3", Title: "silent", StartAt: now.Add(time.Hour), EndAt: now.Add(2 * time.Hour), UserID: "bob"},
+		{ID: "4", Title: "trashed", StartAt: now.Add(time.Hour), EndAt: now.Add(2 * time.Hour), UserID: "dave",
+			Reminders: []time.Duration{time.Hour}},
+	}
+	for _, event := range events {
+		require.NoError(t, s.CreateEvent(ctx, event))
+	}
+	require.NoError(t, s.TrashEvent(ctx, "4", now))
+
+	p := &publisher{}
+	New(logger.New("error"), s, p, time.Minute, 0, 0, 0).notify(ctx, now.Add(-time.Minute), now.Add(time.Minute))
+
+	require.Equal(t, []storage.Notification{
+		{EventID: "1", Title: "soon", StartAt: now.Add(time.Hour), UserID: "alice", Before: time.Hour},
+		{EventID: "1", Title: "soon", StartAt: now.Add(time.Hour), UserID: "bob", Before: time.Hour},
+		{EventID: "2", Title: "later", StartAt: now.Add(3 * time.Hour), UserID: "alice", Before: 3 * time.Hour},
+	}, p.notifications)
+	// Every notification is traced separately.
+	require.Len(t, p.requestIDs, 3)
+	require.NotEmpty(t, p.requestIDs[0])
+	require.NotEqual(t, p.requestIDs[0], p.requestIDs[1])
+
+	// Publishing errors are logged and don't stop the scheduler.
+	p.err = errors.New("queue is down")
+	New(logger.New("error"), s, p, time.Minute, 0, 0, 0).notify(ctx, now.Add(-time.Minute), now.Add(time.Minute))
+}
+
+func TestCleanup(t *testing.T) {
+	ctx := context.Background()
+	s := memorystorage.New()
+	events := []storage.Event{
+		{ID: "old", StartAt: now.AddDate(-2, 0, 0), EndAt: now.AddDate(-2, 0, 0).Add(time.Hour), UserID: "alice"},
+		{ID: "recent", StartAt: now.AddDate(0, -1, 0), EndAt: now.AddDate(0, -1, 0).Add(time.Hour), UserID: "alice"},
+		{ID: "long trashed", StartAt: now.Add(time.Hour), EndAt: now.Add(2 * time.Hour), UserID: "alice"},
+		{ID: "just trashed", StartAt: now.Add(3 * time.Hour), EndAt: now.Add(4 * time.Hour), UserID: "alice"},
+	}
+	for _, event := range events {
+		require.NoError(t, s.CreateEvent(ctx, event))
+	}
+	require.NoError(t, s.TrashEvent(ctx, "long trashed", now.AddDate(0, 0, -31)))
+	require.NoError(t, s.TrashEvent(ctx, "just trashed", now.Add(-time.Hour)))
+
+	New(logger.New("error"), s, &publisher{}, time.Minute, 365*24*time.Hour, 30*24*time.Hour, 0).cleanup(ctx, now)
+
+	for id, exists := range map[string]bool{
+		"old": false, "recent": true, "long trashed": false, "just trashed": true,
+	} {
+		_, err := s.GetEvent(ctx, id)
+		if exists {
+			require.NoError(t, err, id)
+		} else {
+			require.ErrorIs(t, err, storage.ErrEventNotFound, id)
+		}
+	}
+
+	// Zero retention keeps everything.
+	New(logger.New("error"), s, &publisher{}, time.Minute, 0, 0, 0).cleanup(ctx, now.AddDate(10, 0, 0))
+	_, err := s.GetEvent(ctx, "recent")
+	require.NoError(t, err)
+}
+
+func TestDigest(t *testing.T) {
+	ctx := context.Background()
+	s := memorystorage.New()
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	// Alice's digest is due at 13:00 in Moscow, which is now, Bob's is due at 13:00 UTC.
+	for userID, digest := range map[string]storage.DigestSettings{
+		"alice": {Enabled: true, TimeZone: "Europe/Moscow"},
+		"bob":   {Enabled: true},
+		"carol": {Enabled: true, TimeZone: "Europe/Moscow"},
+		"dave":  {TimeZone: "Europe/Moscow"},
+	} {
+		settings := storage.DefaultUserSettings(userID)
+		settings.Digest = digest
+		require.NoError(t, s.SaveUserSettings(ctx, settings))
+	}
+	invite := func(status storage.RSVPStatus) []storage.Attendee {
+		return []storage.Attendee{{UserID: "alice", Status: status}}
+	}
+	events := []storage.Event{
+		{ID: "1", Title: "review", StartAt: now.Add(2 * time.Hour), EndAt: now.Add(3 * time.Hour), UserID: "alice"},
+		{ID: "2", Title: "lunch", StartAt: now.Add(5 * time.Hour), EndAt: now.Add(6 * time.Hour), UserID: "erin",
+			Attendees: invite(storage.RSVPAccepted)},
+		{ID: "3", Title: "declined", StartAt: now.Add(6 * time.Hour), EndAt: now.Add(7 * time.Hour), UserID: "erin",
+			Attendees: invite(storage.RSVPDeclined)},
+		// Starts after the midnight in Moscow, the next day.
+		{ID: "4", Title: "tomorrow", StartAt: now.Add(12 * time.Hour), EndAt: now.Add(13 * time.Hour), UserID: "alice"},
+		{ID: "5", Title: "bob's", StartAt: now.Add(time.Hour), EndAt: now.Add(2 * time.Hour), UserID: "bob"},
+		{ID: "6", Title: "dave's", StartAt: now.Add(time.Hour), EndAt: now.Add(2 * time.Hour), UserID: "dave"},
+	}
+	for _, event := range events {
+		require.NoError(t, s.CreateEvent(ctx, event))
+	}
+
+	p := &publisher{}
+	New(logger.New("error"), s, p, time.Minute, 0, 0, 13*time.Hour).
+		digest(ctx, now.Add(-time.Minute), now.Add(time.Minute))
+
+	require.Len(t, p.notifications, 1)
+	got := p.notifications[0]
+	require.Equal(t, storage.NotificationDigest, got.Kind)
+	require.Equal(t, "alice", got.UserID)
+	require.True(t, time.Date(2022, time.June, 1, 0, 0, 0, 0, moscow).Equal(got.StartAt), got.StartAt)
+	require.Equal(t, []storage.AgendaItem{
+		{EventID: "1", Title: "review", StartAt: now.Add(2 * time.Hour), EndAt: now.Add(3 * time.Hour)},
+		{EventID: "2", Title: "lunch", StartAt: now.Add(5 * time.Hour), EndAt: now.Add(6 * time.Hour)},
+	}, got.Agenda)
+	require.NotEmpty(t, p.requestIDs[0])
+
+	// The next tick doesn't repeat the digest.
+	p = &publisher{}
+	New(logger.New("error"), s, p, time.Minute, 0, 0, 13*time.Hour).
+		digest(ctx, now.Add(time.Minute), now.Add(2*time.Minute))
+	require.Empty(t, p.notifications)
+}
@@ -0,0 +1,127 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/requestid"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Sender delivers the reminders and digests queued by the scheduler.
+type Sender struct {
+	logger   Logger
+	consumer Consumer
+	notifier Notifier
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+type Logger interface {
+	InfoContext(ctx context.Context, msg string)
+	ErrorContext(ctx context.Context, msg string)
+}
+
+type Consumer interface {
+	Consume(ctx context.Context, handle func(ctx context.Context, msg queue.Message) error) error
+}
+
+// Notifier delivers the notification to the user.
+type Notifier interface {
+	Notify(ctx context.Context, notification storage.Notification) error
+}
+
+func New(logger Logger, consumer Consumer, notifier Notifier) *Sender {
+	return &Sender{
+		logger:   logger,
+		consumer: consumer,
+		notifier: notifier,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start consumes the queue until the sender is stopped or the context is done. Messages are delivered
+// with the context, so canceling it interrupts the current delivery, while Stop lets it finish.
+func (s *Sender) Start(ctx context.Context) error {
+	defer close(s.done)
+
+	consumeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stop:
+			cancel()
+		case <-consumeCtx.Done():
+		}
+	}()
+
+	return s.consumer.Consume(consumeCtx, func(_ context.Context, msg queue.Message) error {
+		return s.handle(ctx, msg)
+	})
+}
+
+// Stop stops consuming and waits for the current message to be handled, giving up when the context is done.
+func (s *Sender) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handle drops messages it can't decode, a failed delivery is returned to be retried.
+// The request ID the scheduler sent the message within is passed on to the log lines and the notifier.
+func (s *Sender) handle(ctx context.Context, msg queue.Message) error {
+	ctx = requestid.WithID(ctx, requestid.Ensure(msg.Headers[requestid.Header]))
+
+	var notification storage.Notification
+	if err := json.Unmarshal(msg.Body, &notification); err != nil {
+		s.logger.ErrorContext(ctx, "dropped malformed notification: "+err.Error())
+		return nil
+	}
+
+	if err := s.notifier.Notify(ctx, notification); err != nil {
+		s.logger.ErrorContext(ctx, fmt.Sprintf("failed to notify %s about %s: %s",
+			notification.UserID, notification.Subject(), err))
+		return err
+	}
+	return nil
+}
+
+// LogNotifier writes notifications to the log, it stands in for a real delivery channel.
+type LogNotifier struct {
+	logger Logger
+}
+
+func NewLogNotifier(logger Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, notification storage.Notification) error {
+	if notification.Kind == storage.NotificationDigest {
+		// The day starts at the local midnight of the user, the events are listed in that offset.
+		loc := notification.StartAt.Location()
+		items := make([]string, 0, len(notification.Agenda))
+		for _, item := range notification.Agenda {
+			items = append(items, fmt.Sprintf("%s-%s %q",
+				item.StartAt.In(loc).Format("15:04"), item.EndAt.In(loc).Format("15:04"), item.Title))
+		}
+		n.logger.InfoContext(ctx, fmt.Sprintf("digest for %s on %s: %s",
+			notification.UserID, notification.StartAt.Format("2006-01-02"), strings.Join(items, ", ")))
+		return nil
+	}
+
+	n.logger.InfoContext(ctx, fmt.Sprintf("notification for %s: %q starts in %s at %s",
+		notification.UserID, notification.Title, notification.Before,
+		notification.StartAt.Format("2006-01-02 15:04 MST")))
+	return nil
+}
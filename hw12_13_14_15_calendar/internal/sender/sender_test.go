@@ -0,0 +1,110 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	memoryqueue "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/requestid"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type notifier struct {
+	notifications chan storage.Notification
+	requestIDs    []string
+	failures      int
+}
+
+func (n *notifier) Notify(ctx context.Context, notification storage.Notification) error {
+	if n.failures > 0 {
+		n.failures--
+		return errors.New("delivery failed")
+	}
+	id, _ := requestid.FromContext(ctx)
+	n.requestIDs = append(n.requestIDs, id)
+	n.notifications <- notification
+	return nil
+}
+
+func TestSender(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := memoryqueue.New(10)
+	n := &notifier{notifications: make(chan storage.Notification, 10), failures: 1}
+	s := New(logger.New("error"), q, n)
+	done := make(chan error)
+	go func() {
+		done <- s.Start(ctx)
+	}()
+
+	notification := storage.Notification{
+		EventID: "1",
+		Title:   "standup",
+		StartAt: time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC),
+		UserID:  "alice",
+	}
+	body, err := json.Marshal(notification)
+	require.NoError(t, err)
+
+	// The malformed message is dropped, the failed delivery is retried.
+	require.NoError(t, q.Publish(ctx, queue.Message{Body: []byte("not json")}))
+	headers := map[string]string{requestid.Header: "abc-123"}
+	require.NoError(t, q.Publish(ctx, queue.Message{Body: body, Headers: headers}))
+
+	select {
+	case got := <-n.notifications:
+		require.Equal(t, notification, got)
+		require.Equal(t, []string{"abc-123"}, n.requestIDs)
+	case <-time.After(time.Second):
+		require.Fail(t, "notification is not delivered")
+	}
+
+	require.NoError(t, s.Stop(ctx))
+	require.NoError(t, <-done)
+}
+
+type blockingNotifier struct {
+	started  chan struct{}
+	release  chan struct{}
+	canceled bool
+}
+
+func (n *blockingNotifier) Notify(ctx context.Context, notification storage.Notification) error {
+	close(n.started)
+	<-n.release
+	n.canceled = ctx.Err() != nil
+	return nil
+}
+
+func TestSenderStopDrains(t *testing.T) {
+	ctx := context.Background()
+	q := memoryqueue.New(10)
+	n := &blockingNotifier{started: make(chan struct{}), release: make(chan struct{})}
+	s := New(logger.New("error"), q, n)
+	done := make(chan error)
+	go func() {
+		done <- s.Start(ctx)
+	}()
+
+	body, err := json.Marshal(storage.Notification{EventID: "1"})
+	require.NoError(t, err)
+	require.NoError(t, q.Publish(ctx, queue.Message{Body: body}))
+	<-n.started
+
+	// Stop waits for the delivery in progress, which isn't interrupted.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Stop(timeoutCtx), context.DeadlineExceeded)
+
+	close(n.release)
+	require.NoError(t, s.Stop(ctx))
+	require.NoError(t, <-done)
+	require.False(t, n.canceled)
+}
@@ -0,0 +1,97 @@
+// Package internaldebug serves the runtime diagnostics of a calendar process: pprof profiles,
+// goroutine dumps, the build info and the expvar variables, e.g. the storage cache stats.
+// The listener is separate from the API ones and has no authentication, so it should be bound
+// to a loopback or otherwise private address.
+package internaldebug
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"time"
+)
+
+type Server struct {
+	logger Logger
+	info   BuildInfo
+	server *http.Server
+}
+
+type Logger interface {
+	Info(msg string)
+	Error(msg string)
+}
+
+// BuildInfo is the version of the binary set at build time, the one printed by the version command.
+type BuildInfo struct {
+	Release   string
+	BuildDate string
+	GitHash   string
+}
+
+func NewServer(logger Logger, addr string, info BuildInfo) *Server {
+	s := &Server{
+		logger: logger,
+		info:   info,
+	}
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	s.logger.Info("debug server is listening on " + s.server.Addr)
+	if err := s.server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop closes the connections right away, a profile being recorded is not worth delaying the shutdown.
+func (s *Server) Stop(ctx context.Context) error {
+	return s.server.Close()
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/goroutines", s.handleGoroutines)
+	mux.HandleFunc("/debug/version", s.handleVersion)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// handleGoroutines dumps the stacks of all goroutines in the format of an unrecovered panic.
+func (s *Server) handleGoroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := rpprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		s.logger.Error("failed to dump goroutines: " + err.Error())
+	}
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		BuildInfo
+		GoVersion  string
+		Goroutines int
+	}{
+		BuildInfo:  s.info,
+		GoVersion:  runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+	}); err != nil {
+		s.logger.Error("failed to write version: " + err.Error())
+	}
+}
@@ -0,0 +1,59 @@
+package internaldebug
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	info := BuildInfo{Release: "v1.2.3", BuildDate: "2022-07-20T12:00:00", GitHash: "abc123"}
+	s := NewServer(logger.NewWithWriter("error", &bytes.Buffer{}), "", info)
+	ts := httptest.NewServer(s.server.Handler)
+	defer ts.Close()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path) //nolint:noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := get("/debug/version")
+	require.Equal(t, http.StatusOK, code)
+	var version struct {
+		BuildInfo
+		GoVersion string
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &version))
+	require.Equal(t, info, version.BuildInfo)
+	require.Equal(t, runtime.Version(), version.GoVersion)
+
+	code, body = get("/debug/goroutines")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, "goroutine ")
+	require.Contains(t, body, "TestServer")
+
+	code, body = get("/debug/pprof/")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, "heap")
+	code, _ = get("/debug/pprof/heap")
+	require.Equal(t, http.StatusOK, code)
+
+	code, body = get("/debug/vars")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, `"memstats"`)
+
+	code, _ = get("/events")
+	require.Equal(t, http.StatusNotFound, code)
+}
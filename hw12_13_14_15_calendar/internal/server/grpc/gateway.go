@@ -0,0 +1,98 @@
+package internalgrpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/requestid"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/eventpb"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const gatewayBufferSize = 1024 * 1024
+
+// Gateway returns the handler serving the REST API transcoded from the HTTP bindings of EventService.proto.
+// The requests are passed to this server over an in-memory connection, so they go through the same
+// interceptors as gRPC calls. The headers are forwarded as the metadata of the same name.
+func (s *Server) Gateway(ctx context.Context, headers ...string) (http.Handler, error) {
+	s.gatewayListener = bufconn.Listen(gatewayBufferSize)
+	conn, err := grpc.DialContext(ctx, "gateway",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.gatewayListener.DialContext(ctx)
+		}),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.gatewayConn = conn
+
+	forwarded := map[string]bool{
+		textproto.CanonicalMIMEHeaderKey(idempotencyKeyMetadataKey): true,
+		textproto.CanonicalMIMEHeaderKey(batchModeMetadataKey):      true,
+	}
+	for _, h := range headers {
+		forwarded[textproto.CanonicalMIMEHeaderKey(h)] = true
+	}
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+			if forwarded[textproto.CanonicalMIMEHeaderKey(key)] {
+				return strings.ToLower(key), true
+			}
+			return runtime.DefaultHeaderMatcher(key)
+		}),
+		// The request ID and Retry-After are sent as they are by the HTTP server, the rest of the response
+		// metadata gets the Grpc-Metadata- prefix.
+		runtime.WithOutgoingHeaderMatcher(func(key string) (string, bool) {
+			switch key {
+			case requestIDMetadataKey:
+				return "", false
+			case "retry-after":
+				return "Retry-After", true
+			}
+			return runtime.MetadataHeaderPrefix + key, true
+		}),
+		runtime.WithMetadata(func(ctx context.Context, r *http.Request) metadata.MD {
+			id, _ := requestid.FromContext(ctx)
+			return metadata.Pairs(requestIDMetadataKey, id)
+		}),
+		runtime.WithErrorHandler(errorHandler),
+	)
+	if err := eventpb.RegisterEventServiceHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// errorHandler writes the status as the default handler does, but a busy date gets 409 Conflict rather than
+// 400 Bad Request, so REST clients tell it apart from invalid requests.
+func errorHandler(
+	ctx context.Context, mux *runtime.ServeMux, m runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error,
+) {
+	if status.Code(err) == codes.FailedPrecondition {
+		w = conflictWriter{w}
+	}
+	runtime.DefaultHTTPErrorHandler(ctx, mux, m, w, r, err)
+}
+
+type conflictWriter struct {
+	http.ResponseWriter
+}
+
+func (w conflictWriter) WriteHeader(int) {
+	w.ResponseWriter.WriteHeader(http.StatusConflict)
+}
+
+// isGateway reports whether the call came through the gateway, whose client address is forwarded
+// in the x-forwarded-for metadata.
+func isGateway(addr net.Addr) bool {
+	return addr.Network() == "bufconn"
+}
@@ -0,0 +1,156 @@
+package internalgrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ratelimit"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/requestid"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// newTestGateway serves the gateway with the request ID set by the HTTP server and returns the gRPC log.
+func newTestGateway(t *testing.T, limiter RateLimiter) (*httptest.Server, *bytes.Buffer) {
+	t.Helper()
+
+	log := &bytes.Buffer{}
+	logg := logger.NewWithWriter("info", log)
+	s := NewServer(logg, app.New(logg, memorystorage.New(), time.Hour), "",
+		auth.NewHeaderAuthenticator("X-User-ID"), limiter, nil)
+	gateway, err := s.Gateway(context.Background(), "X-User-ID")
+	require.NoError(t, err)
+	go func() {
+		_ = s.server.Serve(s.gatewayListener)
+	}()
+	t.Cleanup(s.server.Stop)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gateway.ServeHTTP(w, r.WithContext(requestid.WithID(r.Context(), "gateway-request")))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, log
+}
+
+func gatewayRequest(t *testing.T, ts *httptest.Server, method, path, userID, body string, headers ...string) (
+	*http.Response, map[string]interface{},
+) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body)) //nolint:noctx
+	require.NoError(t, err)
+	if userID != "" {
+		req.Header.Set("X-User-ID", userID)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	if len(data) > 0 {
+		require.NoError(t, json.Unmarshal(data, &decoded), string(data))
+	}
+	return resp, decoded
+}
+
+func TestGateway(t *testing.T) {
+	ts, log := newTestGateway(t, ratelimit.New(0, 0, 0, 0))
+	event := `{"title":"meeting","startAt":"2022-06-01T10:00:00Z","endAt":"2022-06-01T11:00:00Z",
+		"attendees":[{"userId":"bob"}]}`
+
+	resp, _ := gatewayRequest(t, ts, http.MethodGet, "/v1/events/day?date=2022-06-01T00:00:00Z", "", "")
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Contains(t, log.String(), "gateway-request")
+
+	resp, body := gatewayRequest(t, ts, http.MethodPost, "/v1/events", "alice", event, "Idempotency-Key", "retry-1")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	created := body["event"].(map[string]interface{})
+	require.Equal(t, "alice", created["userId"])
+	id := created["id"].(string)
+
+	// The metadata reaches the gRPC server as with gRPC calls.
+	_, body = gatewayRequest(t, ts, http.MethodPost, "/v1/events", "alice", event, "Idempotency-Key", "retry-1")
+	require.Equal(t, id, body["event"].(map[string]interface{})["id"])
+	resp, body = gatewayRequest(t, ts, http.MethodPost, "/v1/events", "alice", event)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	require.Contains(t, body["message"], "date is busy")
+	require.EqualValues(t, codes.FailedPrecondition, body["code"])
+
+	resp, _ = gatewayRequest(t, ts, http.MethodPost, "/v1/events", "alice", `{"title":"no time"}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = gatewayRequest(t, ts, http.MethodPost, "/v1/events/"+id+"/rsvp", "bob", `{"status":"accepted"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, body = gatewayRequest(t, ts, http.MethodGet, "/v1/events/week?date=2022-06-01T00:00:00Z", "bob", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	events := body["events"].([]interface{})
+	require.Len(t, events, 1)
+	attendee := events[0].(map[string]interface{})["attendees"].([]interface{})[0]
+	require.Equal(t, "accepted", attendee.(map[string]interface{})["status"])
+
+	resp, _ = gatewayRequest(t, ts, http.MethodDelete, "/v1/events/"+id, "bob", "")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = gatewayRequest(t, ts, http.MethodDelete, "/v1/events/"+id, "alice", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, body = gatewayRequest(t, ts, http.MethodGet, "/v1/events/trash", "alice", "")
+	require.Len(t, body["events"], 1)
+
+	t.Run("batch", func(t *testing.T) {
+		ops := strings.Join([]string{
+			`{"create":{"event":{"title":"a","startAt":"2022-06-02T10:00:00Z","endAt":"2022-06-02T11:00:00Z"}}}`,
+			`{"create":{"event":{"title":"b","startAt":"2022-06-02T10:00:00Z","endAt":"2022-06-02T11:00:00Z"}}}`,
+		}, "\n")
+		resp, body := gatewayRequest(t, ts, http.MethodPost, "/v1/events/batch", "carol", ops,
+			"Batch-Mode", "best_effort")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.EqualValues(t, 1, body["applied"])
+	})
+
+	t.Run("settings", func(t *testing.T) {
+		resp, body := gatewayRequest(t, ts, http.MethodPut, "/v1/settings", "alice",
+			`{"conflictPolicy":"allow","defaultReminders":["900s"]}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "allow", body["conflictPolicy"])
+		require.Equal(t, []interface{}{"900s"}, body["defaultReminders"])
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		resp, body := gatewayRequest(t, ts, http.MethodPut, "/v1/tags/Team", "alice", `{"color":"#00AA00"}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "team", body["name"])
+		_, body = gatewayRequest(t, ts, http.MethodGet, "/v1/tags", "alice", "")
+		require.Len(t, body["tags"], 1)
+		resp, _ = gatewayRequest(t, ts, http.MethodDelete, "/v1/tags/team", "alice", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		resp, _ = gatewayRequest(t, ts, http.MethodDelete, "/v1/tags/team", "alice", "")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestGatewayRateLimit(t *testing.T) {
+	ts, _ := newTestGateway(t, ratelimit.New(0, 0, 1, 1))
+
+	resp, _ := gatewayRequest(t, ts, http.MethodGet, "/v1/shares", "alice", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Another user from the same address is limited, a forged X-Forwarded-For doesn't help.
+	resp, _ = gatewayRequest(t, ts, http.MethodGet, "/v1/shares", "bob", "", "X-Forwarded-For", "10.0.0.1")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, "1", resp.Header.Get("Retry-After"))
+}
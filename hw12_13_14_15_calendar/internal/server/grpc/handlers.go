@@ -0,0 +1,464 @@
+package internalgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/eventpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *Server) CreateEvent(ctx context.Context, req *eventpb.CreateEventRequest) (*eventpb.EventResponse, error) {
+	if key := metadataValue(ctx, idempotencyKeyMetadataKey); key != "" {
+		ctx = app.WithIdempotencyKey(ctx, key)
+	}
+	event, err := s.app.CreateEvent(ctx, fromEventPB(req.GetEvent()))
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return &eventpb.EventResponse{Event: toEventPB(event)}, nil
+}
+
+func (s *Server) UpdateEvent(ctx context.Context, req *eventpb.UpdateEventRequest) (*eventpb.EventResponse, error) {
+	event, err := s.app.UpdateEvent(ctx, req.GetId(), fromEventPB(req.GetEvent()))
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return &eventpb.EventResponse{Event: toEventPB(event)}, nil
+}
+
+func (s *Server) DeleteEvent(ctx context.Context, req *eventpb.DeleteEventRequest) (*emptypb.Empty, error) {
+	if err := s.app.DeleteEvent(ctx, req.GetId()); err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) RestoreEvent(ctx context.Context, req *eventpb.RestoreEventRequest) (*eventpb.EventResponse, error) {
+	event, err := s.app.RestoreEvent(ctx, req.GetId())
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return &eventpb.EventResponse{Event: toEventPB(event)}, nil
+}
+
+func (s *Server) ListTrash(ctx context.Context, _ *emptypb.Empty) (*eventpb.ListEventsResponse, error) {
+	events, err := s.app.ListTrash(ctx)
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return toListEventsResponse(events), nil
+}
+
+func (s *Server) GetEventHistory(
+	ctx context.Context, req *eventpb.EventHistoryRequest,
+) (*eventpb.EventHistoryResponse, error) {
+	records, err := s.app.EventHistory(ctx, req.GetId())
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+
+	resp := &eventpb.EventHistoryResponse{Records: make([]*eventpb.AuditRecord, 0, len(records))}
+	for _, record := range records {
+		pb := &eventpb.AuditRecord{
+			EventId: record.EventID,
+			Action:  string(record.Action),
+			ActorId: record.ActorID,
+			At:      timestamppb.New(record.At),
+		}
+		for _, c := range record.Changes {
+			pb.Changes = append(pb.Changes, &eventpb.FieldChange{Field: c.Field, Old: c.Old, New: c.New})
+		}
+		resp.Records = append(resp.Records, pb)
+	}
+	return resp, nil
+}
+
+func (s *Server) RespondToEvent(ctx context.Context, req *eventpb.RespondToEventRequest) (*emptypb.Empty, error) {
+	if err := s.app.RespondToEvent(ctx, req.GetId(), storage.RSVPStatus(req.GetStatus())); err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) ListDayEvents(
+	ctx context.Context, req *eventpb.ListEventsRequest,
+) (*eventpb.ListEventsResponse, error) {
+	return s.listEvents(ctx, req, s.app.ListDayEvents)
+}
+
+func (s *Server) ListWeekEvents(
+	ctx context.Context, req *eventpb.ListEventsRequest,
+) (*eventpb.ListEventsResponse, error) {
+	return s.listEvents(ctx, req, s.app.ListWeekEvents)
+}
+
+func (s *Server) ListMonthEvents(
+	ctx context.Context, req *eventpb.ListEventsRequest,
+) (*eventpb.ListEventsResponse, error) {
+	return s.listEvents(ctx, req, s.app.ListMonthEvents)
+}
+
+type listFunc func(ctx context.Context, date time.Time) ([]storage.Event, error)
+
+func (s *Server) listEvents(
+	ctx context.Context, req *eventpb.ListEventsRequest, list listFunc,
+) (*eventpb.ListEventsResponse, error) {
+	if req.GetDate() == nil {
+		return nil, status.Error(codes.InvalidArgument, "date is required")
+	}
+
+	if req.GetIncludeShared() {
+		ctx = app.WithSharedCalendars(ctx)
+	}
+	if req.GetTag() != "" {
+		ctx = app.WithTag(ctx, req.GetTag())
+	}
+	events, err := list(ctx, req.GetDate().AsTime())
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return toListEventsResponse(events), nil
+}
+
+func (s *Server) ShareCalendar(ctx context.Context, req *eventpb.ShareCalendarRequest) (*eventpb.Share, error) {
+	share, err := s.app.ShareCalendar(ctx, req.GetUserId(), storage.AccessLevel(req.GetLevel()))
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return toSharePB(share), nil
+}
+
+func (s *Server) UnshareCalendar(ctx context.Context, req *eventpb.UnshareCalendarRequest) (*emptypb.Empty, error) {
+	if err := s.app.UnshareCalendar(ctx, req.GetUserId()); err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) ListShares(ctx context.Context, _ *emptypb.Empty) (*eventpb.ListSharesResponse, error) {
+	shares, err := s.app.ListShares(ctx)
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return toListSharesResponse(shares), nil
+}
+
+func (s *Server) ListSharedWithMe(ctx context.Context, _ *emptypb.Empty) (*eventpb.ListSharesResponse, error) {
+	shares, err := s.app.ListSharedWithMe(ctx)
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return toListSharesResponse(shares), nil
+}
+
+// BatchEvents collects the streamed operations and applies them as a single batch.
+func (s *Server) BatchEvents(stream eventpb.EventService_BatchEventsServer) error {
+	ctx := stream.Context()
+	var ops []app.BatchOp
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(ops) == app.MaxBatchSize {
+			return status.Errorf(codes.InvalidArgument, "batch exceeds %d operations", app.MaxBatchSize)
+		}
+		ops = append(ops, fromBatchOperationPB(req))
+	}
+
+	mode := storage.BatchMode(metadataValue(ctx, batchModeMetadataKey))
+	if mode == "" {
+		mode = storage.BatchAtomic
+	}
+	results, err := s.app.ApplyBatch(ctx, ops, mode)
+	if err != nil {
+		return s.toStatus(ctx, err)
+	}
+
+	resp := &eventpb.BatchEventsResponse{Results: make([]*eventpb.BatchResult, 0, len(results))}
+	for i, result := range results {
+		pb := &eventpb.BatchResult{Index: int32(i), Status: "applied", Code: codes.OK.String()}
+		if result.Err != nil {
+			code := s.statusCode(ctx, result.Err)
+			pb.Status, pb.Code, pb.Error = "failed", code.String(), result.Err.Error()
+			if errors.Is(result.Err, storage.ErrBatchAborted) {
+				pb.Status = "aborted"
+			}
+			if code == codes.Internal {
+				pb.Error = "internal error"
+			}
+		} else {
+			pb.Event = toEventPB(result.Event)
+			resp.Applied++
+		}
+		resp.Results = append(resp.Results, pb)
+	}
+	return stream.SendAndClose(resp)
+}
+
+func (s *Server) GetSettings(ctx context.Context, _ *emptypb.Empty) (*eventpb.Settings, error) {
+	settings, err := s.app.GetSettings(ctx)
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return toSettingsPB(settings), nil
+}
+
+func (s *Server) UpdateSettings(ctx context.Context, req *eventpb.Settings) (*eventpb.Settings, error) {
+	settings, err := fromSettingsPB(req)
+	if err != nil {
+		return nil, err
+	}
+	settings, err = s.app.UpdateSettings(ctx, settings)
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return toSettingsPB(settings), nil
+}
+
+func (s *Server) ListTags(ctx context.Context, _ *emptypb.Empty) (*eventpb.ListTagsResponse, error) {
+	tags, err := s.app.ListTags(ctx)
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	resp := &eventpb.ListTagsResponse{Tags: make([]*eventpb.Tag, 0, len(tags))}
+	for _, tag := range tags {
+		resp.Tags = append(resp.Tags, toTagPB(tag))
+	}
+	return resp, nil
+}
+
+func (s *Server) SaveTag(ctx context.Context, req *eventpb.Tag) (*eventpb.Tag, error) {
+	tag, err := s.app.SaveTag(ctx, storage.Tag{Name: req.GetName(), Color: req.GetColor()})
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return toTagPB(tag), nil
+}
+
+func (s *Server) DeleteTag(ctx context.Context, req *eventpb.DeleteTagRequest) (*emptypb.Empty, error) {
+	if err := s.app.DeleteTag(ctx, req.GetName()); err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) toStatus(ctx context.Context, err error) error {
+	code := s.statusCode(ctx, err)
+	if code == codes.Internal {
+		return status.Error(code, "internal error")
+	}
+	return status.Error(code, err.Error())
+}
+
+// statusCode maps the error to the status code, unexpected errors are logged.
+func (s *Server) statusCode(ctx context.Context, err error) codes.Code {
+	switch {
+	case errors.Is(err, app.ErrUnauthenticated):
+		return codes.Unauthenticated
+	case errors.Is(err, app.ErrInvalidEvent), errors.Is(err, app.ErrInvalidRSVP), errors.Is(err, app.ErrInvalidShare),
+		errors.Is(err, app.ErrInvalidSettings), errors.Is(err, app.ErrInvalidBatch), errors.Is(err, app.ErrInvalidTag):
+		return codes.InvalidArgument
+	case errors.Is(err, app.ErrForbidden), errors.Is(err, storage.ErrNotAttendee):
+		return codes.PermissionDenied
+	case errors.Is(err, storage.ErrEventNotFound), errors.Is(err, storage.ErrShareNotFound),
+		errors.Is(err, storage.ErrTagNotFound):
+		return codes.NotFound
+	case errors.Is(err, storage.ErrEventExists):
+		return codes.AlreadyExists
+	case errors.Is(err, storage.ErrDateBusy):
+		return codes.FailedPrecondition
+	case errors.Is(err, storage.ErrBatchAborted):
+		return codes.Aborted
+	default:
+		s.logger.ErrorContext(ctx, "grpc request failed: "+err.Error())
+		return codes.Internal
+	}
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func fromEventPB(pb *eventpb.Event) storage.Event {
+	event := storage.Event{
+		Title:       pb.GetTitle(),
+		Description: pb.GetDescription(),
+		UserID:      pb.GetUserId(),
+		Kind:        storage.EventKind(pb.GetKind()),
+		Category:    pb.GetCategory(),
+		Color:       pb.GetColor(),
+		Tags:        pb.GetTags(),
+		Reminders:   fromDurationsPB(pb.GetReminders()),
+		Tentative:   pb.GetTentative(),
+	}
+	// An empty list means the default reminders, unless the event is explicitly without reminders.
+	if event.Reminders == nil && pb.GetNoReminders() {
+		event.Reminders = []time.Duration{}
+	}
+	if pb.GetStartAt() != nil {
+		event.StartAt = pb.GetStartAt().AsTime()
+	}
+	if pb.GetEndAt() != nil {
+		event.EndAt = pb.GetEndAt().AsTime()
+	}
+	for _, a := range pb.GetAttendees() {
+		event.Attendees = append(event.Attendees, storage.Attendee{UserID: a.GetUserId()})
+	}
+	return event
+}
+
+func fromBatchOperationPB(pb *eventpb.BatchOperation) app.BatchOp {
+	switch op := pb.GetOp().(type) {
+	case *eventpb.BatchOperation_Create:
+		return app.BatchOp{Kind: storage.BatchCreate, Event: fromEventPB(op.Create.GetEvent())}
+	case *eventpb.BatchOperation_Update:
+		return app.BatchOp{Kind: storage.BatchUpdate, ID: op.Update.GetId(), Event: fromEventPB(op.Update.GetEvent())}
+	case *eventpb.BatchOperation_Delete:
+		return app.BatchOp{Kind: storage.BatchDelete, ID: op.Delete.GetId()}
+	default:
+		// The app rejects the operation of unknown kind.
+		return app.BatchOp{}
+	}
+}
+
+func toListEventsResponse(events []storage.Event) *eventpb.ListEventsResponse {
+	resp := &eventpb.ListEventsResponse{Events: make([]*eventpb.Event, 0, len(events))}
+	for _, event := range events {
+		resp.Events = append(resp.Events, toEventPB(event))
+	}
+	return resp
+}
+
+func toEventPB(event storage.Event) *eventpb.Event {
+	pb := &eventpb.Event{
+		Id:          event.ID,
+		Title:       event.Title,
+		StartAt:     timestamppb.New(event.StartAt),
+		EndAt:       timestamppb.New(event.EndAt),
+		Description: event.Description,
+		UserId:      event.UserID,
+		Reminders:   toDurationsPB(event.Reminders),
+		NoReminders: len(event.Reminders) == 0,
+		Tentative:   event.Tentative,
+		Kind:        string(event.Kind),
+		Category:    event.Category,
+		Color:       event.Color,
+		Tags:        event.Tags,
+
+		OutsideWorkingHours: event.OutsideWorkingHours,
+	}
+	if event.Trashed() {
+		pb.DeletedAt = timestamppb.New(event.DeletedAt)
+	}
+	for _, a := range event.Attendees {
+		pb.Attendees = append(pb.Attendees, &eventpb.Attendee{UserId: a.UserID, Status: string(a.Status)})
+	}
+	return pb
+}
+
+func toListSharesResponse(shares []storage.Share) *eventpb.ListSharesResponse {
+	resp := &eventpb.ListSharesResponse{Shares: make([]*eventpb.Share, 0, len(shares))}
+	for _, share := range shares {
+		resp.Shares = append(resp.Shares, toSharePB(share))
+	}
+	return resp
+}
+
+func toTagPB(tag storage.Tag) *eventpb.Tag {
+	return &eventpb.Tag{Name: tag.Name, Color: tag.Color}
+}
+
+func toSharePB(share storage.Share) *eventpb.Share {
+	return &eventpb.Share{OwnerId: share.OwnerID, UserId: share.UserID, Level: string(share.Level)}
+}
+
+// fromSettingsPB returns the InvalidArgument status for unknown working days.
+func fromSettingsPB(pb *eventpb.Settings) (storage.UserSettings, error) {
+	settings := storage.UserSettings{
+		ConflictPolicy:   storage.ConflictPolicy(pb.GetConflictPolicy()),
+		DefaultReminders: fromDurationsPB(pb.GetDefaultReminders()),
+		Digest: storage.DigestSettings{
+			Enabled:  pb.GetDigest().GetEnabled(),
+			TimeZone: pb.GetDigest().GetTimeZone(),
+		},
+	}
+	if pb.GetWorkingHours() == nil {
+		return settings, nil
+	}
+
+	hours := storage.WorkingHours{
+		Start:    pb.GetWorkingHours().GetStart().AsDuration(),
+		End:      pb.GetWorkingHours().GetEnd().AsDuration(),
+		TimeZone: pb.GetWorkingHours().GetTimeZone(),
+	}
+	for _, name := range pb.GetWorkingHours().GetDays() {
+		day, ok := storage.ParseWeekday(name)
+		if !ok {
+			return storage.UserSettings{}, status.Errorf(codes.InvalidArgument, "unknown working day %q", name)
+		}
+		hours.Days = append(hours.Days, day)
+	}
+	settings.WorkingHours = hours
+	return settings, nil
+}
+
+func toSettingsPB(settings storage.UserSettings) *eventpb.Settings {
+	pb := &eventpb.Settings{
+		ConflictPolicy:   string(settings.ConflictPolicy),
+		DefaultReminders: toDurationsPB(settings.DefaultReminders),
+	}
+	if hours := settings.WorkingHours; !hours.IsZero() {
+		pb.WorkingHours = &eventpb.WorkingHours{
+			Start:    durationpb.New(hours.Start),
+			End:      durationpb.New(hours.End),
+			TimeZone: hours.TimeZone,
+		}
+		for _, day := range hours.Days {
+			pb.WorkingHours.Days = append(pb.WorkingHours.Days, storage.FormatWeekday(day))
+		}
+	}
+	if digest := settings.Digest; digest.Enabled {
+		pb.Digest = &eventpb.Digest{Enabled: true, TimeZone: digest.TimeZone}
+	}
+	return pb
+}
+
+func fromDurationsPB(pbs []*durationpb.Duration) []time.Duration {
+	if len(pbs) == 0 {
+		return nil
+	}
+	durations := make([]time.Duration, 0, len(pbs))
+	for _, pb := range pbs {
+		durations = append(durations, pb.AsDuration())
+	}
+	return durations
+}
+
+func toDurationsPB(durations []time.Duration) []*durationpb.Duration {
+	pbs := make([]*durationpb.Duration, 0, len(durations))
+	for _, d := range durations {
+		pbs = append(pbs, durationpb.New(d))
+	}
+	return pbs
+}
@@ -0,0 +1,203 @@
+package internalgrpc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/requestid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// requestIDInterceptor takes the request ID from the client metadata or generates a new one.
+// The ID is sent back in the response header and follows the call through the context.
+func requestIDInterceptor(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	return handler(withRequestID(ctx), req)
+}
+
+func streamRequestIDInterceptor(
+	srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	return handler(srv, &serverStream{ServerStream: ss, ctx: withRequestID(ss.Context())})
+}
+
+func withRequestID(ctx context.Context) context.Context {
+	id := requestid.Ensure(metadataValue(ctx, requestIDMetadataKey))
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadataKey, id))
+	return requestid.WithID(ctx, id)
+}
+
+func loggingInterceptor(logger Logger) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, logger, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+func streamLoggingInterceptor(logger Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(ss.Context(), logger, info.FullMethod, start, err)
+		return err
+	}
+}
+
+func logCall(ctx context.Context, logger Logger, method string, start time.Time, err error) {
+	logger.InfoContext(ctx, fmt.Sprintf("%s [%s] %s %s %d %q",
+		clientIP(ctx),
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		method,
+		status.Code(err),
+		time.Since(start).Milliseconds(),
+		metadataValue(ctx, "user-agent"),
+	))
+}
+
+// authInterceptor puts the authenticated user into the call context, the app takes it from there.
+func authInterceptor(authenticator Authenticator) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, err := authenticate(ctx, authenticator)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamAuthInterceptor(authenticator Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), authenticator)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authenticate(ctx context.Context, authenticator Authenticator) (context.Context, error) {
+	userID, err := authenticator.Authenticate(func(name string) string {
+		return metadataValue(ctx, strings.ToLower(name))
+	})
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return app.WithUser(ctx, userID), nil
+}
+
+// ipRateLimitInterceptor rejects calls exceeding the limit of the client IP. It runs before authentication,
+// so that calls failing it are counted too.
+func ipRateLimitInterceptor(limiter RateLimiter) grpc.UnaryServerInterceptor {
+	return rateLimitInterceptor(func(ctx context.Context) (bool, time.Duration) {
+		return limiter.AllowIP(clientIP(ctx))
+	})
+}
+
+// userRateLimitInterceptor rejects calls exceeding the limit of the authenticated user.
+func userRateLimitInterceptor(limiter RateLimiter) grpc.UnaryServerInterceptor {
+	return rateLimitInterceptor(allowUser(limiter))
+}
+
+// streamIPRateLimitInterceptor counts a stream as a single call, however many messages it carries.
+func streamIPRateLimitInterceptor(limiter RateLimiter) grpc.StreamServerInterceptor {
+	return streamRateLimitInterceptor(func(ctx context.Context) (bool, time.Duration) {
+		return limiter.AllowIP(clientIP(ctx))
+	})
+}
+
+func streamUserRateLimitInterceptor(limiter RateLimiter) grpc.StreamServerInterceptor {
+	return streamRateLimitInterceptor(allowUser(limiter))
+}
+
+type allowFunc func(ctx context.Context) (bool, time.Duration)
+
+func allowUser(limiter RateLimiter) allowFunc {
+	return func(ctx context.Context) (bool, time.Duration) {
+		userID, _ := app.UserFromContext(ctx)
+		return limiter.AllowUser(userID)
+	}
+}
+
+func rateLimitInterceptor(allow allowFunc) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if err := checkRateLimit(ctx, allow); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamRateLimitInterceptor(allow allowFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkRateLimit(ss.Context(), allow); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func checkRateLimit(ctx context.Context, allow allowFunc) error {
+	ok, retryAfter := allow(ctx)
+	if ok {
+		return nil
+	}
+
+	seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", seconds))
+	st, err := status.New(codes.ResourceExhausted, "rate limit exceeded, retry after "+retryAfter.String()).
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return st.Err()
+}
+
+// serverStream overrides the context of the stream, as interceptors do for unary calls.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// clientIP takes the address of a gateway client from the last x-forwarded-for entry, which the gateway
+// appends, the entries before it come from the client.
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if forwarded := md.Get("x-forwarded-for"); isGateway(p.Addr) && len(forwarded) > 0 {
+		entries := strings.Split(forwarded[len(forwarded)-1], ",")
+		return strings.TrimSpace(entries[len(entries)-1])
+	}
+	ip, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return ip
+}
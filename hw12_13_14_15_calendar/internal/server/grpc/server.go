@@ -0,0 +1,148 @@
+package internalgrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/eventpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	idempotencyKeyMetadataKey = "idempotency-key"
+	batchModeMetadataKey      = "batch-mode"
+	requestIDMetadataKey      = "x-request-id"
+)
+
+type Server struct {
+	eventpb.UnimplementedEventServiceServer
+
+	logger Logger
+	app    Application
+	addr   string
+	tls    *tls.Config
+	server *grpc.Server
+
+	gatewayListener *bufconn.Listener
+	gatewayConn     *grpc.ClientConn
+}
+
+type Logger interface {
+	Info(msg string)
+	InfoContext(ctx context.Context, msg string)
+	ErrorContext(ctx context.Context, msg string)
+}
+
+type Authenticator interface {
+	Authenticate(header auth.HeaderFunc) (string, error)
+}
+
+type RateLimiter interface {
+	AllowIP(ip string) (bool, time.Duration)
+	AllowUser(userID string) (bool, time.Duration)
+}
+
+type Application interface {
+	CreateEvent(ctx context.Context, event storage.Event) (storage.Event, error)
+	UpdateEvent(ctx context.Context, id string, event storage.Event) (storage.Event, error)
+	DeleteEvent(ctx context.Context, id string) error
+	RestoreEvent(ctx context.Context, id string) (storage.Event, error)
+	ListTrash(ctx context.Context) ([]storage.Event, error)
+	EventHistory(ctx context.Context, id string) ([]storage.AuditRecord, error)
+	ShareCalendar(ctx context.Context, userID string, level storage.AccessLevel) (storage.Share, error)
+	UnshareCalendar(ctx context.Context, userID string) error
+	ListShares(ctx context.Context) ([]storage.Share, error)
+	ListSharedWithMe(ctx context.Context) ([]storage.Share, error)
+	GetSettings(ctx context.Context) (storage.UserSettings, error)
+	UpdateSettings(ctx context.Context, settings storage.UserSettings) (storage.UserSettings, error)
+	ApplyBatch(ctx context.Context, ops []app.BatchOp, mode storage.BatchMode) ([]app.BatchResult, error)
+	RespondToEvent(ctx context.Context, id string, status storage.RSVPStatus) error
+	ListDayEvents(ctx context.Context, date time.Time) ([]storage.Event, error)
+	ListWeekEvents(ctx context.Context, date time.Time) ([]storage.Event, error)
+	ListMonthEvents(ctx context.Context, date time.Time) ([]storage.Event, error)
+	ListTags(ctx context.Context) ([]storage.Tag, error)
+	SaveTag(ctx context.Context, tag storage.Tag) (storage.Tag, error)
+	DeleteTag(ctx context.Context, name string) error
+}
+
+// NewServer creates the server listening on addr, with TLS if tlsConfig is set.
+func NewServer(
+	logger Logger, app Application, addr string, authenticator Authenticator, limiter RateLimiter,
+	tlsConfig *tls.Config,
+) *Server {
+	s := &Server{
+		logger: logger,
+		app:    app,
+		addr:   addr,
+		tls:    tlsConfig,
+	}
+	s.server = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			requestIDInterceptor,
+			loggingInterceptor(logger),
+			ipRateLimitInterceptor(limiter),
+			authInterceptor(authenticator),
+			userRateLimitInterceptor(limiter),
+		),
+		grpc.ChainStreamInterceptor(
+			streamRequestIDInterceptor,
+			streamLoggingInterceptor(logger),
+			streamIPRateLimitInterceptor(limiter),
+			streamAuthInterceptor(authenticator),
+			streamUserRateLimitInterceptor(limiter),
+		),
+	)
+	eventpb.RegisterEventServiceServer(s.server, s)
+	return s
+}
+
+// Start serves the network listener and the in-memory one of the gateway. TLS is terminated by the network
+// listener rather than by the server credentials, so the gateway calls the server in plaintext.
+func (s *Server) Start(ctx context.Context) error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if s.tls != nil {
+		cfg := s.tls
+		if len(cfg.NextProtos) == 0 {
+			// gRPC clients require HTTP/2 to be negotiated. The configs made by calendartls offer it already,
+			// and are used as they are, since their per-connection copies wouldn't get the changes of a clone.
+			cfg = cfg.Clone()
+			cfg.NextProtos = []string{"h2"}
+		}
+		lis = tls.NewListener(lis, cfg)
+	}
+	if s.gatewayListener != nil {
+		go func() {
+			_ = s.server.Serve(s.gatewayListener)
+		}()
+	}
+	s.logger.Info("grpc server is listening on " + s.addr)
+	return s.server.Serve(lis)
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	if s.gatewayConn != nil {
+		defer s.gatewayConn.Close()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
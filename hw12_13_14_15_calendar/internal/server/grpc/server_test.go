@@ -0,0 +1,523 @@
+package internalgrpc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ratelimit"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tlstest"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/calendartls"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/eventpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const userIDMetadataKey = "x-user-id"
+
+func newTestClient(t *testing.T, limiter RateLimiter) eventpb.EventServiceClient {
+	t.Helper()
+
+	logg := logger.NewWithWriter("error", &bytes.Buffer{})
+	s := NewServer(logg, app.New(logg, memorystorage.New(), time.Hour), "",
+		auth.NewHeaderAuthenticator("X-User-ID"), limiter, nil)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = s.server.Serve(lis)
+	}()
+	t.Cleanup(s.server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return eventpb.NewEventServiceClient(conn)
+}
+
+func asUser(userID string, kv ...string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), append([]string{userIDMetadataKey, userID}, kv...)...)
+}
+
+func TestServer(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(0, 0, 0, 0))
+	start := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+
+	newEvent := func(title string, at time.Time) *eventpb.Event {
+		return &eventpb.Event{
+			Title:     title,
+			StartAt:   timestamppb.New(at),
+			EndAt:     timestamppb.New(at.Add(time.Hour)),
+			Attendees: []*eventpb.Attendee{{UserId: "bob"}},
+		}
+	}
+
+	_, err := client.ListDayEvents(context.Background(), &eventpb.ListEventsRequest{Date: timestamppb.New(start)})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	created, err := client.CreateEvent(asUser("alice"), &eventpb.CreateEventRequest{Event: newEvent("meeting", start)})
+	require.NoError(t, err)
+	require.Equal(t, "alice", created.GetEvent().GetUserId())
+	require.Equal(t, "pending", created.GetEvent().GetAttendees()[0].GetStatus())
+	id := created.GetEvent().GetId()
+
+	_, err = client.CreateEvent(asUser("alice"), &eventpb.CreateEventRequest{Event: newEvent("overlap", start)})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	t.Run("idempotency key", func(t *testing.T) {
+		ctx := asUser("alice", idempotencyKeyMetadataKey, "retry-1")
+		req := &eventpb.CreateEventRequest{Event: newEvent("retried", start.AddDate(0, 0, 1))}
+
+		first, err := client.CreateEvent(ctx, req)
+		require.NoError(t, err)
+		second, err := client.CreateEvent(ctx, req)
+		require.NoError(t, err)
+		require.Equal(t, first.GetEvent().GetId(), second.GetEvent().GetId())
+	})
+
+	t.Run("rsvp", func(t *testing.T) {
+		_, err := client.RespondToEvent(asUser("bob"), &eventpb.RespondToEventRequest{Id: id, Status: "accepted"})
+		require.NoError(t, err)
+
+		_, err = client.RespondToEvent(asUser("carol"), &eventpb.RespondToEventRequest{Id: id, Status: "accepted"})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		resp, err := client.ListWeekEvents(asUser("bob"), &eventpb.ListEventsRequest{Date: timestamppb.New(start)})
+		require.NoError(t, err)
+		require.Len(t, resp.GetEvents(), 2)
+		require.Equal(t, "accepted", resp.GetEvents()[0].GetAttendees()[0].GetStatus())
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		_, err := client.UpdateEvent(asUser("bob"), &eventpb.UpdateEventRequest{Id: id, Event: newEvent("renamed", start)})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		updated, err := client.UpdateEvent(asUser("alice"),
+			&eventpb.UpdateEventRequest{Id: id, Event: newEvent("renamed", start)})
+		require.NoError(t, err)
+		require.Equal(t, "renamed", updated.GetEvent().GetTitle())
+
+		_, err = client.DeleteEvent(asUser("alice"), &eventpb.DeleteEventRequest{Id: id})
+		require.NoError(t, err)
+		_, err = client.DeleteEvent(asUser("alice"), &eventpb.DeleteEventRequest{Id: id})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("trash and restore", func(t *testing.T) {
+		trash, err := client.ListTrash(asUser("alice"), &emptypb.Empty{})
+		require.NoError(t, err)
+		require.Len(t, trash.GetEvents(), 1)
+		require.Equal(t, id, trash.GetEvents()[0].GetId())
+		require.NotNil(t, trash.GetEvents()[0].GetDeletedAt())
+
+		_, err = client.RestoreEvent(asUser("bob"), &eventpb.RestoreEventRequest{Id: id})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		restored, err := client.RestoreEvent(asUser("alice"), &eventpb.RestoreEventRequest{Id: id})
+		require.NoError(t, err)
+		require.Nil(t, restored.GetEvent().GetDeletedAt())
+
+		_, err = client.RestoreEvent(asUser("alice"), &eventpb.RestoreEventRequest{Id: id})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("history", func(t *testing.T) {
+		_, err := client.GetEventHistory(asUser("carol"), &eventpb.EventHistoryRequest{Id: id})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		resp, err := client.GetEventHistory(asUser("alice"), &eventpb.EventHistoryRequest{Id: id})
+		require.NoError(t, err)
+		actions := make([]string, 0, len(resp.GetRecords()))
+		for _, record := range resp.GetRecords() {
+			actions = append(actions, record.GetAction())
+		}
+		require.Equal(t, []string{"create", "update", "delete", "restore"}, actions)
+	})
+}
+
+func TestSharing(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(0, 0, 0, 0))
+	start := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+
+	_, err := client.ShareCalendar(asUser("alice"), &eventpb.ShareCalendarRequest{UserId: "alice", Level: "read"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	share, err := client.ShareCalendar(asUser("alice"), &eventpb.ShareCalendarRequest{UserId: "bob", Level: "read"})
+	require.NoError(t, err)
+	require.Equal(t, "alice", share.GetOwnerId())
+
+	shares, err := client.ListSharedWithMe(asUser("bob"), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Len(t, shares.GetShares(), 1)
+
+	event := &eventpb.Event{
+		Title: "delegated", UserId: "alice", StartAt: timestamppb.New(start), EndAt: timestamppb.New(start.Add(time.Hour)),
+	}
+	_, err = client.CreateEvent(asUser("bob"), &eventpb.CreateEventRequest{Event: event})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.CreateEvent(asUser("alice"), &eventpb.CreateEventRequest{Event: event})
+	require.NoError(t, err)
+
+	resp, err := client.ListDayEvents(asUser("bob"),
+		&eventpb.ListEventsRequest{Date: timestamppb.New(start), IncludeShared: true})
+	require.NoError(t, err)
+	require.Len(t, resp.GetEvents(), 1)
+
+	_, err = client.UnshareCalendar(asUser("alice"), &eventpb.UnshareCalendarRequest{UserId: "bob"})
+	require.NoError(t, err)
+	shares, err = client.ListShares(asUser("alice"), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Empty(t, shares.GetShares())
+	_, err = client.UnshareCalendar(asUser("alice"), &eventpb.UnshareCalendarRequest{UserId: "bob"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestTags(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(0, 0, 0, 0))
+	start := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+
+	_, err := client.SaveTag(asUser("alice"), &eventpb.Tag{Name: "team", Color: "green"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	tag, err := client.SaveTag(asUser("alice"), &eventpb.Tag{Name: "Team", Color: "#00AA00"})
+	require.NoError(t, err)
+	require.Equal(t, "team", tag.GetName())
+	require.Equal(t, "#00aa00", tag.GetColor())
+
+	for i, tags := range [][]string{{"team"}, nil} {
+		at := start.Add(time.Duration(i) * time.Hour)
+		_, err = client.CreateEvent(asUser("alice"), &eventpb.CreateEventRequest{Event: &eventpb.Event{
+			Title: "event", StartAt: timestamppb.New(at), EndAt: timestamppb.New(at.Add(time.Hour)),
+			Category: "work", Tags: tags,
+		}})
+		require.NoError(t, err)
+	}
+
+	resp, err := client.ListDayEvents(asUser("alice"),
+		&eventpb.ListEventsRequest{Date: timestamppb.New(start), Tag: "team"})
+	require.NoError(t, err)
+	require.Len(t, resp.GetEvents(), 1)
+	require.Equal(t, []string{"team"}, resp.GetEvents()[0].GetTags())
+	require.Equal(t, "work", resp.GetEvents()[0].GetCategory())
+
+	tags, err := client.ListTags(asUser("alice"), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Len(t, tags.GetTags(), 1)
+
+	_, err = client.DeleteTag(asUser("alice"), &eventpb.DeleteTagRequest{Name: "team"})
+	require.NoError(t, err)
+	_, err = client.DeleteTag(asUser("alice"), &eventpb.DeleteTagRequest{Name: "team"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestSettings(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(0, 0, 0, 0))
+	start := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+	newEvent := func(title string, tentative bool) *eventpb.CreateEventRequest {
+		return &eventpb.CreateEventRequest{Event: &eventpb.Event{
+			Title: title, StartAt: timestamppb.New(start), EndAt: timestamppb.New(start.Add(time.Hour)), Tentative: tentative,
+		}}
+	}
+
+	settings, err := client.GetSettings(asUser("alice"), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Equal(t, "reject", settings.GetConflictPolicy())
+
+	_, err = client.UpdateSettings(asUser("alice"), &eventpb.Settings{ConflictPolicy: "never"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.UpdateSettings(asUser("alice"), &eventpb.Settings{ConflictPolicy: "allow_tentative"})
+	require.NoError(t, err)
+
+	_, err = client.CreateEvent(asUser("alice"), newEvent("meeting", false))
+	require.NoError(t, err)
+	created, err := client.CreateEvent(asUser("alice"), newEvent("maybe", true))
+	require.NoError(t, err)
+	require.True(t, created.GetEvent().GetTentative())
+	_, err = client.CreateEvent(asUser("alice"), newEvent("overlap", false))
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.UpdateSettings(asUser("alice"), &eventpb.Settings{ConflictPolicy: "reject"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestDefaultReminders(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(0, 0, 0, 0))
+	newEvent := func(day int, reminders []*durationpb.Duration, none bool) *eventpb.CreateEventRequest {
+		start := time.Date(2022, time.June, day, 10, 0, 0, 0, time.UTC)
+		return &eventpb.CreateEventRequest{Event: &eventpb.Event{
+			Title: "meeting", StartAt: timestamppb.New(start), EndAt: timestamppb.New(start.Add(time.Hour)),
+			Reminders: reminders, NoReminders: none,
+		}}
+	}
+	durations := func(pbs []*durationpb.Duration) []time.Duration {
+		ds := make([]time.Duration, 0, len(pbs))
+		for _, pb := range pbs {
+			ds = append(ds, pb.AsDuration())
+		}
+		return ds
+	}
+
+	_, err := client.UpdateSettings(asUser("alice"), &eventpb.Settings{
+		ConflictPolicy:   "reject",
+		DefaultReminders: []*durationpb.Duration{durationpb.New(-time.Hour)},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	settings, err := client.UpdateSettings(asUser("alice"), &eventpb.Settings{
+		ConflictPolicy:   "reject",
+		DefaultReminders: []*durationpb.Duration{durationpb.New(10 * time.Minute), durationpb.New(24 * time.Hour)},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{24 * time.Hour, 10 * time.Minute}, durations(settings.GetDefaultReminders()))
+
+	created, err := client.CreateEvent(asUser("alice"), newEvent(1, nil, false))
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{24 * time.Hour, 10 * time.Minute}, durations(created.GetEvent().GetReminders()))
+
+	created, err = client.CreateEvent(asUser("alice"), newEvent(2, nil, true))
+	require.NoError(t, err)
+	require.Empty(t, created.GetEvent().GetReminders())
+	require.True(t, created.GetEvent().GetNoReminders())
+
+	created, err = client.CreateEvent(asUser("alice"),
+		newEvent(3, []*durationpb.Duration{durationpb.New(time.Hour)}, false))
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{time.Hour}, durations(created.GetEvent().GetReminders()))
+}
+
+func TestWorkingHours(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(0, 0, 0, 0))
+	hours := func(days ...string) *eventpb.Settings {
+		return &eventpb.Settings{ConflictPolicy: "reject", WorkingHours: &eventpb.WorkingHours{
+			Days: days, Start: durationpb.New(9 * time.Hour), End: durationpb.New(18 * time.Hour),
+			TimeZone: "Europe/Moscow",
+		}}
+	}
+
+	_, err := client.UpdateSettings(asUser("alice"), hours("funday"))
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	settings, err := client.UpdateSettings(asUser("alice"), hours("monday", "wednesday"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"monday", "wednesday"}, settings.GetWorkingHours().GetDays())
+	require.Equal(t, "Europe/Moscow", settings.GetWorkingHours().GetTimeZone())
+
+	// 10:00 UTC is 13:00 in Moscow, 16:00 UTC is 19:00.
+	start := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+	for _, at := range []time.Time{start, start.Add(6 * time.Hour)} {
+		_, err := client.CreateEvent(asUser("alice"), &eventpb.CreateEventRequest{Event: &eventpb.Event{
+			Title: "meeting", StartAt: timestamppb.New(at), EndAt: timestamppb.New(at.Add(30 * time.Minute)),
+		}})
+		require.NoError(t, err)
+	}
+	resp, err := client.ListDayEvents(asUser("alice"), &eventpb.ListEventsRequest{Date: timestamppb.New(start)})
+	require.NoError(t, err)
+	require.Len(t, resp.GetEvents(), 2)
+	require.False(t, resp.GetEvents()[0].GetOutsideWorkingHours())
+	require.True(t, resp.GetEvents()[1].GetOutsideWorkingHours())
+}
+
+func TestDigestSettings(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(0, 0, 0, 0))
+
+	_, err := client.UpdateSettings(asUser("alice"), &eventpb.Settings{
+		ConflictPolicy: "reject", Digest: &eventpb.Digest{Enabled: true, TimeZone: "Mars/Olympus"},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.UpdateSettings(asUser("alice"), &eventpb.Settings{
+		ConflictPolicy: "reject", Digest: &eventpb.Digest{Enabled: true, TimeZone: "Europe/Moscow"},
+	})
+	require.NoError(t, err)
+
+	settings, err := client.GetSettings(asUser("alice"), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.True(t, settings.GetDigest().GetEnabled())
+	require.Equal(t, "Europe/Moscow", settings.GetDigest().GetTimeZone())
+}
+
+func TestOutOfOffice(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(0, 0, 0, 0))
+	start := time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	review := start.Add(10 * time.Hour)
+	_, err := client.CreateEvent(asUser("alice"), &eventpb.CreateEventRequest{Event: &eventpb.Event{
+		Title: "review", StartAt: timestamppb.New(review), EndAt: timestamppb.New(review.Add(time.Hour)),
+		Attendees: []*eventpb.Attendee{{UserId: "bob"}},
+	}})
+	require.NoError(t, err)
+
+	away, err := client.CreateEvent(asUser("bob"), &eventpb.CreateEventRequest{Event: &eventpb.Event{
+		Title: "vacation", StartAt: timestamppb.New(start), EndAt: timestamppb.New(start.AddDate(0, 0, 1)),
+		Kind: "out_of_office",
+	}})
+	require.NoError(t, err)
+	require.Equal(t, "out_of_office", away.GetEvent().GetKind())
+
+	resp, err := client.ListDayEvents(asUser("alice"), &eventpb.ListEventsRequest{Date: timestamppb.New(start)})
+	require.NoError(t, err)
+	require.Len(t, resp.GetEvents(), 1)
+	require.Equal(t, "declined", resp.GetEvents()[0].GetAttendees()[0].GetStatus())
+}
+
+func TestBatchEvents(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(0, 0, 0, 0))
+	start := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+	create := func(title string) *eventpb.BatchOperation {
+		return &eventpb.BatchOperation{Op: &eventpb.BatchOperation_Create{Create: &eventpb.CreateEventRequest{
+			Event: &eventpb.Event{Title: title, StartAt: timestamppb.New(start), EndAt: timestamppb.New(start.Add(time.Hour))},
+		}}}
+	}
+	batch := func(ctx context.Context, ops ...*eventpb.BatchOperation) (*eventpb.BatchEventsResponse, error) {
+		stream, err := client.BatchEvents(ctx)
+		require.NoError(t, err)
+		for _, op := range ops {
+			require.NoError(t, stream.Send(op))
+		}
+		return stream.CloseAndRecv()
+	}
+	statuses := func(resp *eventpb.BatchEventsResponse) []string {
+		statuses := make([]string, 0, len(resp.GetResults()))
+		for _, result := range resp.GetResults() {
+			statuses = append(statuses, result.GetStatus())
+		}
+		return statuses
+	}
+
+	_, err := batch(context.Background(), create("a"))
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = batch(asUser("alice"))
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	resp, err := batch(asUser("alice"), create("a"), create("b"))
+	require.NoError(t, err)
+	require.EqualValues(t, 0, resp.GetApplied())
+	require.Equal(t, []string{"aborted", "failed"}, statuses(resp))
+	require.Equal(t, codes.FailedPrecondition.String(), resp.GetResults()[1].GetCode())
+
+	resp, err = batch(asUser("alice", batchModeMetadataKey, "best_effort"), create("a"), create("b"),
+		&eventpb.BatchOperation{Op: &eventpb.BatchOperation_Delete{Delete: &eventpb.DeleteEventRequest{Id: "missing"}}})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, resp.GetApplied())
+	require.Equal(t, []string{"applied", "failed", "failed"}, statuses(resp))
+	require.Equal(t, "a", resp.GetResults()[0].GetEvent().GetTitle())
+	require.Equal(t, codes.NotFound.String(), resp.GetResults()[2].GetCode())
+}
+
+func TestRateLimit(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(1, 1, 0, 0))
+	req := &eventpb.ListEventsRequest{Date: timestamppb.Now()}
+
+	_, err := client.ListDayEvents(asUser("alice"), req)
+	require.NoError(t, err)
+
+	var header metadata.MD
+	_, err = client.ListDayEvents(asUser("alice"), req, grpc.Header(&header))
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Equal(t, []string{"1"}, header.Get("retry-after"))
+	require.Len(t, st.Details(), 1)
+	retryInfo, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	require.InDelta(t, time.Second, retryInfo.GetRetryDelay().AsDuration(), float64(100*time.Millisecond))
+
+	_, err = client.ListDayEvents(asUser("bob"), req)
+	require.NoError(t, err)
+}
+
+func TestRateLimitBeforeAuth(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(0, 0, 1, 1))
+	req := &eventpb.ListEventsRequest{Date: timestamppb.Now()}
+
+	// The call failing authentication takes the only token of the address.
+	_, err := client.ListDayEvents(context.Background(), req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.ListDayEvents(asUser("alice"), req)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestRequestID(t *testing.T) {
+	client := newTestClient(t, ratelimit.New(0, 0, 0, 0))
+	req := &eventpb.ListEventsRequest{Date: timestamppb.Now()}
+
+	var header metadata.MD
+	_, err := client.ListDayEvents(asUser("alice", requestIDMetadataKey, "abc-123"), req, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Equal(t, []string{"abc-123"}, header.Get(requestIDMetadataKey))
+
+	_, err = client.ListDayEvents(asUser("alice", requestIDMetadataKey, "not valid"), req, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, header.Get(requestIDMetadataKey), 1)
+	require.NotEqual(t, "not valid", header.Get(requestIDMetadataKey)[0])
+}
+
+func TestTLS(t *testing.T) {
+	_, files := tlstest.WriteFiles(t, t.TempDir())
+	serverCfg, err := calendartls.ServerConfig{
+		CertFile: files.ServerCert, KeyFile: files.ServerKey, ClientCAFile: files.CA,
+	}.TLSConfig()
+	require.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	logg := logger.NewWithWriter("error", &bytes.Buffer{})
+	s := NewServer(logg, app.New(logg, memorystorage.New(), time.Hour), addr,
+		auth.NewHeaderAuthenticator("X-User-ID"), ratelimit.New(0, 0, 0, 0), serverCfg)
+	gateway, err := s.Gateway(context.Background(), "X-User-ID")
+	require.NoError(t, err)
+	go func() {
+		_ = s.Start(context.Background())
+	}()
+	t.Cleanup(func() { _ = s.Stop(context.Background()) })
+
+	listShares := func(cfg calendartls.ClientConfig, opts ...grpc.DialOption) error {
+		tlsCfg, err := cfg.TLSConfig()
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn, err := grpc.DialContext(ctx, addr,
+			append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))...)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = eventpb.NewEventServiceClient(conn).ListShares(asUser("alice"), &emptypb.Empty{})
+		return err
+	}
+
+	// The first call waits for the server to start listening.
+	require.NoError(t, listShares(calendartls.ClientConfig{
+		CAFile: files.CA, CertFile: files.ClientCert, KeyFile: files.ClientKey, ServerName: "localhost",
+	}, grpc.WithBlock()))
+	// Without the client certificate the handshake fails.
+	require.Error(t, listShares(calendartls.ClientConfig{CAFile: files.CA, ServerName: "localhost"}))
+
+	// The gateway calls the server in memory, past the TLS listener.
+	req := httptest.NewRequest(http.MethodGet, "/v1/shares", nil)
+	req.Header.Set("X-User-ID", "alice")
+	rec := httptest.NewRecorder()
+	gateway.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,26 @@
+package internalhttp
+
+import (
+	_ "embed" // Embed the OpenAPI document.
+	"net/http"
+)
+
+// The description is generated from the HTTP bindings of EventService.proto by protoc-gen-openapiv2 and
+// converted to OpenAPI 3. The google/api and protoc-gen-openapiv2 annotations are copied into the api directory.
+//go:generate protoc -I ../../../api --openapiv2_out=. --openapiv2_opt=allow_merge=true,merge_file_name=openapi ../../../api/EventService.proto
+//go:generate go run openapi_gen.go
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// handleOpenAPI serves GET /openapi.json, the OpenAPI 3 description of the REST API.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(openAPISpec); err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to write response: "+err.Error())
+	}
+}
@@ -0,0 +1,121 @@
+//go:build ignore
+// +build ignore
+
+// This program converts the OpenAPI 2 document made by protoc-gen-openapiv2 into the OpenAPI 3 one
+// served by the server. It's run by go generate and removes the OpenAPI 2 document when done.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+)
+
+const (
+	source = "openapi.swagger.json"
+	target = "openapi.json"
+
+	contentType = "application/json"
+)
+
+type object = map[string]interface{}
+
+func main() {
+	data, err := os.ReadFile(source)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var doc object
+	if err := json.Unmarshal(data, &doc); err != nil {
+		log.Fatal(err)
+	}
+
+	paths := object{}
+	for path, item := range doc["paths"].(object) {
+		ops := object{}
+		for method, op := range item.(object) {
+			ops[method] = convertOperation(op.(object))
+		}
+		paths[path] = ops
+	}
+	converted := object{
+		"openapi": "3.0.3",
+		"info":    doc["info"],
+		"tags":    doc["tags"],
+		"paths":   paths,
+		"components": object{
+			"schemas": doc["definitions"],
+		},
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(converted); err != nil {
+		log.Fatal(err)
+	}
+	// The definitions become the component schemas.
+	out := bytes.ReplaceAll(buf.Bytes(), []byte(`"#/definitions/`), []byte(`"#/components/schemas/`))
+	if err := os.WriteFile(target, out, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Remove(source); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// convertOperation moves the body parameter to the request body and the types of the other parameters
+// and the response schemas under the media type, as OpenAPI 3 has it.
+func convertOperation(op object) object {
+	converted := object{}
+	for key, value := range op {
+		converted[key] = value
+	}
+
+	var params []interface{}
+	list, _ := op["parameters"].([]interface{})
+	for _, p := range list {
+		param := p.(object)
+		if param["in"] == "body" {
+			body := object{
+				"required": param["required"],
+				"content":  object{contentType: object{"schema": param["schema"]}},
+			}
+			if description, ok := param["description"]; ok {
+				body["description"] = description
+			}
+			converted["requestBody"] = body
+			continue
+		}
+
+		schema := object{}
+		result := object{"schema": schema}
+		for key, value := range param {
+			switch key {
+			case "type", "format", "items", "enum", "default":
+				schema[key] = value
+			default:
+				result[key] = value
+			}
+		}
+		params = append(params, result)
+	}
+	if len(params) > 0 {
+		converted["parameters"] = params
+	} else {
+		delete(converted, "parameters")
+	}
+
+	responses := object{}
+	for code, r := range op["responses"].(object) {
+		response := object{"description": r.(object)["description"]}
+		if schema, ok := r.(object)["schema"]; ok {
+			response["content"] = object{contentType: object{"schema": schema}}
+		}
+		responses[code] = response
+	}
+	converted["responses"] = responses
+	return converted
+}
@@ -2,30 +2,65 @@ package internalhttp
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
 )
 
-type Server struct { // TODO
+type Server struct {
+	logger Logger
+	server *http.Server
 }
 
-type Logger interface { // TODO
+type Logger interface {
+	Info(msg string)
+	InfoContext(ctx context.Context, msg string)
+	ErrorContext(ctx context.Context, msg string)
 }
 
-type Application interface { // TODO
-}
+// NewServer serves the API description under /openapi.json and the REST API under /v1/. The API is
+// the gateway transcoding the requests to the gRPC server, which authenticates and limits them the way
+// it does gRPC calls. With tlsConfig set the server listens with TLS.
+func NewServer(logger Logger, addr string, gateway http.Handler, tlsConfig *tls.Config) *Server {
+	s := &Server{
+		logger: logger,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openapi.json", s.handleOpenAPI)
+	mux.Handle("/v1/", gateway)
 
-func NewServer(logger Logger, app Application) *Server {
-	return &Server{}
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           requestIDMiddleware(loggingMiddleware(logger, mux)),
+		ReadHeaderTimeout: 5 * time.Second,
+		TLSConfig:         tlsConfig,
+	}
+	return s
 }
 
 func (s *Server) Start(ctx context.Context) error {
-	// TODO
-	<-ctx.Done()
+	var err error
+	if s.server.TLSConfig != nil {
+		s.logger.Info("https server is listening on " + s.server.Addr)
+		// The certificate comes from the TLS config.
+		err = s.server.ListenAndServeTLS("", "")
+	} else {
+		s.logger.Info("http server is listening on " + s.server.Addr)
+		err = s.server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
 	return nil
 }
 
+// Stop waits for the requests in flight to finish. When the context is done first,
+// the remaining connections are closed.
 func (s *Server) Stop(ctx context.Context) error {
-	// TODO
+	if err := s.server.Shutdown(ctx); err != nil {
+		_ = s.server.Close()
+		return err
+	}
 	return nil
 }
-
-// TODO
@@ -0,0 +1,155 @@
+package internalhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/requestid"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/eventpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestServer serves the server with the gateway replaced by a handler echoing the path.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	gateway := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := requestid.FromContext(r.Context())
+		_, _ = w.Write([]byte(r.URL.Path + " " + id))
+	})
+	s := NewServer(logger.NewWithWriter("error", &bytes.Buffer{}), "", gateway, nil)
+	ts := httptest.NewServer(s.server.Handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func get(t *testing.T, url string, headers ...string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil) //nolint:noctx
+	require.NoError(t, err)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestServer(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, body := get(t, ts.URL+"/v1/events/day", requestid.Header, "abc-123")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "/v1/events/day abc-123", body)
+	require.Equal(t, "abc-123", resp.Header.Get(requestid.Header))
+
+	// The API is served by the gateway only.
+	resp, _ = get(t, ts.URL+"/events/day")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := loggingMiddleware(logger.NewWithWriter("info", buf),
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/hello?q=1", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Contains(t, buf.String(), `GET /hello?q=1 HTTP/1.1 418`)
+	require.Contains(t, buf.String(), `"Mozilla/5.0"`)
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logg := logger.NewWithWriter("info", buf)
+	h := requestIDMiddleware(loggingMiddleware(logg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := requestid.FromContext(r.Context())
+		require.True(t, ok)
+		_, _ = w.Write([]byte(id))
+	})))
+
+	request := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/events/day", nil)
+		if id != "" {
+			req.Header.Set(requestid.Header, id)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("abc-123")
+	require.Equal(t, "abc-123", rec.Header().Get(requestid.Header))
+	require.Equal(t, "abc-123", rec.Body.String())
+	require.Contains(t, buf.String(), "request_id=abc-123")
+
+	rec = request("")
+	require.NotEmpty(t, rec.Header().Get(requestid.Header))
+	require.Equal(t, rec.Header().Get(requestid.Header), rec.Body.String())
+	require.Contains(t, buf.String(), "request_id="+rec.Body.String())
+}
+
+func TestOpenAPI(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, body := get(t, ts.URL+"/openapi.json")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title   string `json:"title"`
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &spec))
+	require.Equal(t, "3.0.3", spec.OpenAPI)
+	require.Equal(t, "Calendar API", spec.Info.Title)
+	require.Equal(t, "1.0", spec.Info.Version)
+
+	// The document is generated from the HTTP bindings, run "make generate" when they change.
+	// Path parameters are spelled with the JSON names of the fields.
+	param := regexp.MustCompile(`_([a-z])`)
+	methods := eventpb.File_EventService_proto.Services().ByName("EventService").Methods()
+	paths := make(map[string]bool)
+	for i := 0; i < methods.Len(); i++ {
+		rule := proto.GetExtension(methods.Get(i).Options(), annotations.E_Http).(*annotations.HttpRule)
+		var method, path string
+		switch pattern := rule.GetPattern().(type) {
+		case *annotations.HttpRule_Get:
+			method, path = "get", pattern.Get
+		case *annotations.HttpRule_Post:
+			method, path = "post", pattern.Post
+		case *annotations.HttpRule_Put:
+			method, path = "put", pattern.Put
+		case *annotations.HttpRule_Delete:
+			method, path = "delete", pattern.Delete
+		default:
+			t.Fatalf("unexpected pattern of %s", methods.Get(i).Name())
+		}
+		path = param.ReplaceAllStringFunc(path, func(s string) string { return strings.ToUpper(s[1:]) })
+		require.Contains(t, spec.Paths, path)
+		require.Contains(t, spec.Paths[path], method, path)
+		paths[path] = true
+	}
+	require.Len(t, spec.Paths, len(paths))
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+)
+
+// AuditRecord is an entry of the append-only event history.
+type AuditRecord struct {
+	EventID string
+	Action  AuditAction
+	ActorID string
+	At      time.Time
+	Changes []FieldChange
+}
+
+// FieldChange holds the old and new value of an event field in its text form, empty when the field is not set.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// DiffEvents lists the fields that differ between the two versions of the event.
+// Attendee responses are not part of the history, only the invited users are.
+func DiffEvents(old, new Event) []FieldChange {
+	var changes []FieldChange
+	diff := func(field, oldValue, newValue string) {
+		if oldValue != newValue {
+			changes = append(changes, FieldChange{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+
+	diff("title", old.Title, new.Title)
+	diff("startAt", formatTime(old.StartAt), formatTime(new.StartAt))
+	diff("endAt", formatTime(old.EndAt), formatTime(new.EndAt))
+	diff("description", old.Description, new.Description)
+	diff("kind", string(old.Kind), string(new.Kind))
+	diff("category", old.Category, new.Category)
+	diff("color", old.Color, new.Color)
+	diff("tags", strings.Join(old.Tags, ","), strings.Join(new.Tags, ","))
+	diff("reminders", formatDurations(old.Reminders), formatDurations(new.Reminders))
+	diff("attendees", formatAttendees(old.Attendees), formatAttendees(new.Attendees))
+	diff("tentative", formatBool(old.Tentative), formatBool(new.Tentative))
+	diff("deletedAt", formatTime(old.DeletedAt), formatTime(new.DeletedAt))
+	return changes
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatDurations(durations []time.Duration) string {
+	values := make([]string, 0, len(durations))
+	for _, d := range durations {
+		values = append(values, d.String())
+	}
+	return strings.Join(values, ",")
+}
+
+func formatBool(b bool) string {
+	if !b {
+		return ""
+	}
+	return "true"
+}
+
+func formatAttendees(attendees []Attendee) string {
+	userIDs := make([]string, 0, len(attendees))
+	for _, a := range attendees {
+		userIDs = append(userIDs, a.UserID)
+	}
+	return strings.Join(userIDs, ",")
+}
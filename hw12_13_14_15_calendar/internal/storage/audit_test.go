@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffEvents(t *testing.T) {
+	start := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+	old := Event{
+		ID:        "1",
+		Title:     "standup",
+		StartAt:   start,
+		EndAt:     start.Add(time.Hour),
+		UserID:    "alice",
+		Attendees: []Attendee{{UserID: "bob", Status: RSVPAccepted}},
+	}
+
+	require.Empty(t, DiffEvents(old, old))
+
+	updated := old
+	updated.Title = "retro"
+	updated.EndAt = start.Add(2 * time.Hour)
+	updated.Reminders = []time.Duration{time.Hour, 15 * time.Minute}
+	updated.Attendees = []Attendee{{UserID: "bob", Status: RSVPDeclined}, {UserID: "carol"}}
+	require.Equal(t, []FieldChange{
+		{Field: "title", Old: "standup", New: "retro"},
+		{Field: "endAt", Old: "2022-06-01T11:00:00Z", New: "2022-06-01T12:00:00Z"},
+		{Field: "reminders", Old: "", New: "1h0m0s,15m0s"},
+		{Field: "attendees", Old: "bob", New: "bob,carol"},
+	}, DiffEvents(old, updated))
+
+	trashed := old
+	trashed.DeletedAt = start
+	require.Equal(t, []FieldChange{{Field: "deletedAt", Old: "", New: "2022-06-01T10:00:00Z"}},
+		DiffEvents(old, trashed))
+}
@@ -0,0 +1,37 @@
+package storage
+
+type BatchOpKind string
+
+const (
+	BatchCreate BatchOpKind = "create"
+	BatchUpdate BatchOpKind = "update"
+	BatchDelete BatchOpKind = "delete" // Moves Event.ID to the trash at Event.DeletedAt.
+)
+
+// BatchOp is a single change of a batch applied with ApplyBatch.
+type BatchOp struct {
+	Kind  BatchOpKind
+	Event Event
+}
+
+// BatchMode decides what happens to the rest of a batch when one of its operations fails.
+type BatchMode string
+
+const (
+	BatchAtomic     BatchMode = "atomic"      // Nothing is applied, the rest of operations fail with ErrBatchAborted.
+	BatchBestEffort BatchMode = "best_effort" // Only the failed operations are skipped.
+)
+
+func (m BatchMode) Valid() bool {
+	return m == BatchAtomic || m == BatchBestEffort
+}
+
+// AbortBatch fails all operations of the batch but the failed one with ErrBatchAborted.
+func AbortBatch(errs []error, failed int) []error {
+	for i := range errs {
+		if i != failed {
+			errs[i] = ErrBatchAborted
+		}
+	}
+	return errs
+}
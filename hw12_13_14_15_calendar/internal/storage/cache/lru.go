@@ -0,0 +1,91 @@
+package cachestorage
+
+import (
+	"container/list"
+	"sync"
+)
+
+type Key string
+
+// Cache is the LRU cache of the hw04_lru_cache homework: Set reports whether the key was already cached,
+// the least recently used item is evicted when the capacity is exceeded.
+type Cache interface {
+	Set(key Key, value interface{}) bool
+	Get(key Key) (interface{}, bool)
+	Clear()
+}
+
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int
+	queue    *list.List
+	items    map[Key]*list.Element
+	// onEvict is called with the cache locked for every item evicted or cleared, but not for the replaced values.
+	onEvict func(key Key, value interface{})
+}
+
+type cacheItem struct {
+	key   Key
+	value interface{}
+}
+
+func NewCache(capacity int) Cache {
+	return newCache(capacity, nil)
+}
+
+func newCache(capacity int, onEvict func(key Key, value interface{})) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		queue:    list.New(),
+		items:    make(map[Key]*list.Element, capacity),
+		onEvict:  onEvict,
+	}
+}
+
+func (c *lruCache) Set(key Key, value interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, ok := c.items[key]; ok {
+		item.Value.(*cacheItem).value = value
+		c.queue.MoveToFront(item)
+		return true
+	}
+	c.items[key] = c.queue.PushFront(&cacheItem{key: key, value: value})
+	if c.queue.Len() > c.capacity {
+		last := c.queue.Back()
+		c.queue.Remove(last)
+		delete(c.items, last.Value.(*cacheItem).key)
+		c.evicted(last.Value.(*cacheItem))
+	}
+	return false
+}
+
+func (c *lruCache) Get(key Key) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.queue.MoveToFront(item)
+	return item.Value.(*cacheItem).value, true
+}
+
+func (c *lruCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for item := c.queue.Front(); item != nil; item = item.Next() {
+		c.evicted(item.Value.(*cacheItem))
+	}
+	c.queue.Init()
+	c.items = make(map[Key]*list.Element, c.capacity)
+}
+
+func (c *lruCache) evicted(item *cacheItem) {
+	if c.onEvict != nil {
+		c.onEvict(item.key, item.value)
+	}
+}
@@ -0,0 +1,58 @@
+package cachestorage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("simple", func(t *testing.T) {
+		c := NewCache(5)
+
+		require.False(t, c.Set("aaa", 100))
+		require.False(t, c.Set("bbb", 200))
+		require.True(t, c.Set("aaa", 300))
+
+		val, ok := c.Get("aaa")
+		require.True(t, ok)
+		require.Equal(t, 300, val)
+		_, ok = c.Get("ccc")
+		require.False(t, ok)
+	})
+
+	t.Run("purge logic", func(t *testing.T) {
+		c := NewCache(2)
+		c.Set("aaa", 1)
+		c.Set("bbb", 2)
+
+		// Reading aaa makes bbb the least recently used.
+		c.Get("aaa")
+		c.Set("ccc", 3)
+		_, ok := c.Get("bbb")
+		require.False(t, ok)
+		_, ok = c.Get("aaa")
+		require.True(t, ok)
+
+		c.Clear()
+		_, ok = c.Get("aaa")
+		require.False(t, ok)
+		_, ok = c.Get("ccc")
+		require.False(t, ok)
+	})
+	t.Run("eviction", func(t *testing.T) {
+		var evicted []Key
+		c := newCache(2, func(key Key, _ interface{}) {
+			evicted = append(evicted, key)
+		})
+		c.Set("aaa", 1)
+		c.Set("bbb", 2)
+		c.Set("aaa", 3)
+		require.Empty(t, evicted)
+
+		c.Set("ccc", 4)
+		require.Equal(t, []Key{"bbb"}, evicted)
+		c.Clear()
+		require.ElementsMatch(t, []Key{"bbb", "aaa", "ccc"}, evicted)
+	})
+}
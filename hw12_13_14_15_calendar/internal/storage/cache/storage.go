@@ -0,0 +1,256 @@
+package cachestorage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Storage caches the events listed by user and window in front of another storage. The writes go through
+// and invalidate the lists of the owners and attendees of the changed events. Changes made past this process,
+// e.g. by the scheduler or another instance, are seen once the cached lists expire after the TTL.
+type Storage struct {
+	app.Storage
+	cache Cache
+	ttl   time.Duration
+	now   func() time.Time
+
+	// The lists are cached under the generation of the user, bumping it drops all the lists of the user at once.
+	// A list read before the bump is stored under the old generation and is never returned.
+	mu         sync.Mutex
+	generation uint64
+	users      map[string]*user
+
+	hits   uint64
+	misses uint64
+}
+
+// Stats counts the ListEvents calls answered from the cache and those passed to the storage.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// user counts the cached lists of the user and the reads which may cache one more. The user is forgotten
+// when both are gone, as no list is left to invalidate, so the users known are bounded by the cache capacity.
+type user struct {
+	generation uint64
+	lists      int
+	reads      int
+}
+
+type entry struct {
+	userID    string
+	events    []storage.Event
+	expiresAt time.Time
+}
+
+func New(next app.Storage, capacity int, ttl time.Duration) *Storage {
+	s := &Storage{
+		Storage: next,
+		ttl:     ttl,
+		now:     time.Now,
+		users:   make(map[string]*user),
+	}
+	s.cache = newCache(capacity, s.evicted)
+	return s
+}
+
+func (s *Storage) Stats() Stats {
+	return Stats{
+		Hits:   atomic.LoadUint64(&s.hits),
+		Misses: atomic.LoadUint64(&s.misses),
+	}
+}
+
+// Clear drops all the cached lists.
+func (s *Storage) Clear() {
+	s.cache.Clear()
+}
+
+// Close closes the underlying storage if it has to be closed.
+func (s *Storage) Close(ctx context.Context) error {
+	if closer, ok := s.Storage.(interface{ Close(context.Context) error }); ok {
+		return closer.Close(ctx)
+	}
+	return nil
+}
+
+func (s *Storage) ListEvents(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error) {
+	key := s.beginRead(userID, from, to)
+	defer s.endRead(userID)
+	if value, ok := s.cache.Get(key); ok {
+		if e := value.(entry); s.now().Before(e.expiresAt) {
+			atomic.AddUint64(&s.hits, 1)
+			return copyEvents(e.events), nil
+		}
+	}
+	atomic.AddUint64(&s.misses, 1)
+
+	events, err := s.Storage.ListEvents(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	s.store(key, entry{userID: userID, events: copyEvents(events), expiresAt: s.now().Add(s.ttl)})
+	return events, nil
+}
+
+func (s *Storage) CreateEvent(ctx context.Context, event storage.Event) error {
+	if err := s.Storage.CreateEvent(ctx, event); err != nil {
+		return err
+	}
+	s.invalidate(event)
+	return nil
+}
+
+func (s *Storage) UpdateEvent(ctx context.Context, event storage.Event) error {
+	current, _ := s.Storage.GetEvent(ctx, event.ID)
+	if err := s.Storage.UpdateEvent(ctx, event); err != nil {
+		return err
+	}
+	s.invalidate(current, event)
+	return nil
+}
+
+func (s *Storage) TrashEvent(ctx context.Context, id string, deletedAt time.Time) error {
+	return s.changeEvent(ctx, id, func() error {
+		return s.Storage.TrashEvent(ctx, id, deletedAt)
+	})
+}
+
+func (s *Storage) RestoreEvent(ctx context.Context, id string) error {
+	return s.changeEvent(ctx, id, func() error {
+		return s.Storage.RestoreEvent(ctx, id)
+	})
+}
+
+func (s *Storage) SetAttendeeStatus(ctx context.Context, eventID, userID string, status storage.RSVPStatus) error {
+	return s.changeEvent(ctx, eventID, func() error {
+		return s.Storage.SetAttendeeStatus(ctx, eventID, userID, status)
+	})
+}
+
+// ApplyBatch invalidates the lists touched by every operation, a best effort batch may apply some of them
+// even when it fails.
+func (s *Storage) ApplyBatch(ctx context.Context, ops []storage.BatchOp, mode storage.BatchMode) ([]error, error) {
+	events := make([]storage.Event, 0, 2*len(ops))
+	for _, op := range ops {
+		if current, err := s.Storage.GetEvent(ctx, op.Event.ID); err == nil {
+			events = append(events, current)
+		}
+		events = append(events, op.Event)
+	}
+	errs, err := s.Storage.ApplyBatch(ctx, ops, mode)
+	s.invalidate(events...)
+	return errs, err
+}
+
+// DeleteTag drops all the cached lists, as the tag is taken off the events of the user listed to the attendees too.
+func (s *Storage) DeleteTag(ctx context.Context, userID, name string) error {
+	if err := s.Storage.DeleteTag(ctx, userID, name); err != nil {
+		return err
+	}
+	s.cache.Clear()
+	return nil
+}
+
+// changeEvent applies the change to the stored event and invalidates the lists it appears in.
+func (s *Storage) changeEvent(ctx context.Context, id string, change func() error) error {
+	event, err := s.Storage.GetEvent(ctx, id)
+	if err != nil {
+		return change()
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	s.invalidate(event)
+	return nil
+}
+
+// beginRead returns the key of the list under the current generation of the user, who is kept known
+// until endRead, so a list read meanwhile can't be stored under a generation given out again.
+func (s *Storage) beginRead(userID string, from, to time.Time) Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		u = &user{}
+		s.users[userID] = u
+	}
+	u.reads++
+	return Key(fmt.Sprintf("%s/%d/%d/%d", userID, u.generation, from.UnixNano(), to.UnixNano()))
+}
+
+func (s *Storage) endRead(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.users[userID]
+	u.reads--
+	s.forget(userID, u)
+}
+
+// store caches the list, which is counted first, so its eviction never finds it uncounted.
+func (s *Storage) store(key Key, e entry) {
+	s.mu.Lock()
+	s.users[e.userID].lists++
+	s.mu.Unlock()
+
+	if s.cache.Set(key, e) {
+		// The list replaced another one, which stays counted.
+		s.mu.Lock()
+		s.users[e.userID].lists--
+		s.mu.Unlock()
+	}
+}
+
+// evicted is called by the cache for every list it evicts.
+func (s *Storage) evicted(_ Key, value interface{}) {
+	userID := value.(entry).userID
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.users[userID]
+	u.lists--
+	s.forget(userID, u)
+}
+
+func (s *Storage) forget(userID string, u *user) {
+	if u.lists == 0 && u.reads == 0 {
+		delete(s.users, userID)
+	}
+}
+
+// invalidate drops the lists of the owners and attendees of the events. The users unknown have no lists.
+func (s *Storage) invalidate(events ...storage.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		s.generation++
+		if u, ok := s.users[event.UserID]; ok {
+			u.generation = s.generation
+		}
+		for _, a := range event.Attendees {
+			if u, ok := s.users[a.UserID]; ok {
+				u.generation = s.generation
+			}
+		}
+	}
+}
+
+// copyEvents keeps the cached lists away from the callers, the app marks the listed events.
+func copyEvents(events []storage.Event) []storage.Event {
+	copies := make([]storage.Event, 0, len(events))
+	for _, event := range events {
+		copies = append(copies, event.Copy())
+	}
+	return copies
+}
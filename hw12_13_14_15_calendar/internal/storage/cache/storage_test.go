@@ -0,0 +1,139 @@
+package cachestorage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+var day = time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+// testStorage passes the methods the app doesn't use straight to the memory storage.
+type testStorage struct {
+	*Storage
+	uncached
+}
+
+type uncached interface {
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+	DeleteOldEvents(ctx context.Context, before time.Time) (int64, error)
+	ListRemindersDue(ctx context.Context, from, to time.Time) ([]storage.Reminder, error)
+	ListDigestSettings(ctx context.Context) ([]storage.UserSettings, error)
+	Snapshot(ctx context.Context, fn func(e storage.Exporter) error) error
+	Import(ctx context.Context, fn func(im storage.Importer) error) error
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		next := memorystorage.New()
+		return testStorage{Storage: New(next, 100, time.Minute), uncached: next}
+	})
+}
+
+func TestStorageInvalidation(t *testing.T) {
+	ctx := context.Background()
+	s := New(memorystorage.New(), 100, time.Minute)
+	now := day
+	s.now = func() time.Time { return now }
+
+	list := func(userID string) []string {
+		t.Helper()
+		events, err := s.ListEvents(ctx, userID, day, day.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		ids := make([]string, 0, len(events))
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		return ids
+	}
+
+	event := storage.Event{
+		ID:        "00000000-0000-0000-0000-000000000001",
+		Title:     "meeting",
+		StartAt:   day.Add(10 * time.Hour),
+		EndAt:     day.Add(11 * time.Hour),
+		UserID:    "alice",
+		Attendees: []storage.Attendee{{UserID: "bob", Status: storage.RSVPPending}},
+	}
+	require.Empty(t, list("alice"))
+	require.Empty(t, list("bob"))
+	require.Empty(t, list("alice"))
+	require.Equal(t, Stats{Hits: 1, Misses: 2}, s.Stats())
+
+	// Creating the event drops the lists of the owner and the attendees.
+	require.NoError(t, s.CreateEvent(ctx, event))
+	require.Equal(t, []string{event.ID}, list("alice"))
+	require.Equal(t, []string{event.ID}, list("bob"))
+	require.Equal(t, Stats{Hits: 1, Misses: 4}, s.Stats())
+
+	// Returned events can be changed without affecting the cache.
+	events, err := s.ListEvents(ctx, "alice", day, day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	events[0].Title = "changed"
+	cached, err := s.ListEvents(ctx, "alice", day, day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, "meeting", cached[0].Title)
+
+	// The attendee removed by the update doesn't see the event anymore.
+	event.Attendees = nil
+	require.NoError(t, s.UpdateEvent(ctx, event))
+	require.Empty(t, list("bob"))
+
+	require.NoError(t, s.TrashEvent(ctx, event.ID, day))
+	require.Empty(t, list("alice"))
+	require.NoError(t, s.RestoreEvent(ctx, event.ID))
+	require.Equal(t, []string{event.ID}, list("alice"))
+
+	// Deleting a tag takes it off the cached events.
+	require.NoError(t, s.SaveTag(ctx, storage.Tag{UserID: "alice", Name: "team"}))
+	event.Tags = []string{"team"}
+	require.NoError(t, s.UpdateEvent(ctx, event))
+	events, err = s.ListEvents(ctx, "alice", day, day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, []string{"team"}, events[0].Tags)
+	require.NoError(t, s.DeleteTag(ctx, "alice", "team"))
+	events, err = s.ListEvents(ctx, "alice", day, day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Empty(t, events[0].Tags)
+
+	// Changes made past the cache show up after the TTL.
+	require.NoError(t, s.Storage.TrashEvent(ctx, event.ID, day))
+	require.Equal(t, []string{event.ID}, list("alice"))
+	now = now.Add(time.Minute)
+	require.Empty(t, list("alice"))
+}
+
+func TestStorageForgetsUsers(t *testing.T) {
+	ctx := context.Background()
+	s := New(memorystorage.New(), 2, time.Minute)
+
+	// The users whose lists are evicted are forgotten, so are the attendees never listed.
+	for n := 1; n <= 10; n++ {
+		userID := fmt.Sprintf("user%d", n)
+		_, err := s.ListEvents(ctx, userID, day, day.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		require.NoError(t, s.CreateEvent(ctx, storage.Event{
+			ID:        fmt.Sprintf("00000000-0000-0000-0000-%012d", n),
+			Title:     "meeting",
+			StartAt:   day.Add(time.Duration(n) * time.Hour),
+			EndAt:     day.Add(time.Duration(n)*time.Hour + time.Minute),
+			UserID:    userID,
+			Attendees: []storage.Attendee{{UserID: "guest" + userID, Status: storage.RSVPPending}},
+		}))
+		require.LessOrEqual(t, len(s.users), 2)
+	}
+
+	// A user forgotten and listed again doesn't get the lists cached before.
+	events, err := s.ListEvents(ctx, "user1", day, day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	s.Clear()
+	require.Empty(t, s.users)
+}
@@ -0,0 +1,16 @@
+package storage
+
+import "errors"
+
+var (
+	ErrEventNotFound = errors.New("event not found")
+	ErrEventExists   = errors.New("event already exists")
+	ErrDateBusy      = errors.New("date is busy by another event")
+	ErrNotAttendee   = errors.New("user is not invited to the event")
+	ErrShareNotFound = errors.New("calendar is not shared with the user")
+	ErrBatchAborted  = errors.New("batch aborted by another failed operation")
+	ErrTagNotFound   = errors.New("tag not found")
+
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+	ErrIdempotencyKeyExists   = errors.New("idempotency key is already used")
+)
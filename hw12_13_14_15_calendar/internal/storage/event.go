@@ -1,7 +1,163 @@
 package storage
 
+import (
+	"sort"
+	"time"
+)
+
 type Event struct {
-	ID    string
-	Title string
-	// TODO
+	ID          string
+	Title       string
+	StartAt     time.Time
+	EndAt       time.Time
+	Description string
+	UserID      string
+	Kind        EventKind
+	Category    string          // Free-form grouping of the events like "work" or "family", empty when not set.
+	Color       string          // The #rrggbb color the event is shown with, empty for the default one.
+	Tags        []string        // Names from the tag vocabulary of the owner, see NormalizeTags.
+	Reminders   []time.Duration // How long before the start the reminders are sent, see NormalizeReminders.
+	Attendees   []Attendee
+	Tentative   bool      // Tentative events may overlap others under the ConflictAllowTentative policy.
+	DeletedAt   time.Time // Zero unless the event is in the trash.
+	// OutsideWorkingHours is set by the app on listed events that fall outside the working hours
+	// of the listing user, it is never stored.
+	OutsideWorkingHours bool
+}
+
+// EventKind tells regular events from the out-of-office ones.
+type EventKind string
+
+const (
+	EventRegular EventKind = "regular"
+	// EventOutOfOffice marks the owner as away: invitations overlapping it are declined and it never
+	// conflicts with other events.
+	EventOutOfOffice EventKind = "out_of_office"
+)
+
+func (k EventKind) Valid() bool {
+	return k == EventRegular || k == EventOutOfOffice
+}
+
+type RSVPStatus string
+
+const (
+	RSVPPending   RSVPStatus = "pending"
+	RSVPAccepted  RSVPStatus = "accepted"
+	RSVPDeclined  RSVPStatus = "declined"
+	RSVPTentative RSVPStatus = "tentative"
+)
+
+// IsResponse reports whether the status is one an invitee can respond with.
+func (s RSVPStatus) IsResponse() bool {
+	return s == RSVPAccepted || s == RSVPDeclined || s == RSVPTentative
+}
+
+type Attendee struct {
+	UserID string
+	Status RSVPStatus
+}
+
+// Attendee returns the attendee entry of the user, if the user is invited.
+func (e Event) Attendee(userID string) (Attendee, bool) {
+	for _, a := range e.Attendees {
+		if a.UserID == userID {
+			return a, true
+		}
+	}
+	return Attendee{}, false
+}
+
+// OutOfOffice reports whether the event marks its owner as away.
+func (e Event) OutOfOffice() bool {
+	return e.Kind == EventOutOfOffice
+}
+
+// Trashed reports whether the event was deleted and waits in the trash to be restored or purged.
+func (e Event) Trashed() bool {
+	return !e.DeletedAt.IsZero()
+}
+
+// Overlaps reports whether the event intersects the [from, to) interval.
+func (e Event) Overlaps(from, to time.Time) bool {
+	return e.StartAt.Before(to) && e.EndAt.After(from)
+}
+
+// RemindersDue returns the reminders of the event whose time falls into [from, to).
+func (e Event) RemindersDue(from, to time.Time) []Reminder {
+	var reminders []Reminder
+	for _, before := range e.Reminders {
+		at := e.StartAt.Add(-before)
+		if before > 0 && !at.Before(from) && at.Before(to) {
+			reminders = append(reminders, Reminder{Event: e, Before: before})
+		}
+	}
+	return reminders
+}
+
+// Reminder is a single reminder of the event, the scheduler sends each of them on its own.
+type Reminder struct {
+	Event  Event
+	Before time.Duration
+}
+
+// Notifications fans the reminder out to the owner and every accepted attendee.
+func (r Reminder) Notifications() []Notification {
+	recipients := []string{r.Event.UserID}
+	for _, a := range r.Event.Attendees {
+		if a.Status == RSVPAccepted && a.UserID != r.Event.UserID {
+			recipients = append(recipients, a.UserID)
+		}
+	}
+
+	notifications := make([]Notification, 0, len(recipients))
+	for _, userID := range recipients {
+		notifications = append(notifications, Notification{
+			EventID: r.Event.ID,
+			Title:   r.Event.Title,
+			StartAt: r.Event.StartAt,
+			Before:  r.Before,
+			UserID:  userID,
+		})
+	}
+	return notifications
+}
+
+// NormalizeReminders orders the reminders the earliest first and drops the duplicates.
+// Nil stays nil, as it means the reminders are not specified, unlike an empty list.
+func NormalizeReminders(reminders []time.Duration) []time.Duration {
+	if reminders == nil {
+		return nil
+	}
+	normalized := make([]time.Duration, 0, len(reminders))
+	for _, before := range reminders {
+		if !containsDuration(normalized, before) {
+			normalized = append(normalized, before)
+		}
+	}
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i] > normalized[j] })
+	return normalized
+}
+
+func containsDuration(durations []time.Duration, d time.Duration) bool {
+	for _, v := range durations {
+		if v == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy returns a deep copy of the event, so storages never share attendee, reminder or tag slices with callers.
+func (e Event) Copy() Event {
+	if e.Attendees != nil {
+		e.Attendees = append([]Attendee(nil), e.Attendees...)
+	}
+	if e.Reminders != nil {
+		e.Reminders = append([]time.Duration{}, e.Reminders...)
+	}
+	if e.Tags != nil {
+		e.Tags = append([]string{}, e.Tags...)
+	}
+	return e
 }
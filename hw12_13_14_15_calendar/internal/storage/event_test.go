@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReminderNotifications(t *testing.T) {
+	start := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+	event := Event{
+		ID:      "1",
+		Title:   "standup",
+		StartAt: start,
+		UserID:  "alice",
+		Attendees: []Attendee{
+			{UserID: "bob", Status: RSVPAccepted},
+			{UserID: "carol", Status: RSVPDeclined},
+			{UserID: "dave", Status: RSVPTentative},
+			{UserID: "erin", Status: RSVPPending},
+			{UserID: "frank", Status: RSVPAccepted},
+		},
+	}
+
+	notifications := Reminder{Event: event, Before: time.Hour}.Notifications()
+
+	recipients := make([]string, 0, len(notifications))
+	for _, n := range notifications {
+		require.Equal(t, "1", n.EventID)
+		require.Equal(t, "standup", n.Title)
+		require.Equal(t, start, n.StartAt)
+		require.Equal(t, time.Hour, n.Before)
+		recipients = append(recipients, n.UserID)
+	}
+	require.Equal(t, []string{"alice", "bob", "frank"}, recipients)
+}
+
+func TestEventRemindersDue(t *testing.T) {
+	start := time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+	event := Event{StartAt: start, Reminders: []time.Duration{24 * time.Hour, time.Hour, 10 * time.Minute}}
+
+	require.Empty(t, Event{StartAt: start}.RemindersDue(start.Add(-48*time.Hour), start))
+
+	due := event.RemindersDue(start.Add(-2*time.Hour), start.Add(-10*time.Minute))
+	require.Len(t, due, 1)
+	require.Equal(t, time.Hour, due[0].Before)
+
+	due = event.RemindersDue(start.Add(-48*time.Hour), start)
+	require.Len(t, due, 3)
+}
+
+func TestNormalizeReminders(t *testing.T) {
+	require.Nil(t, NormalizeReminders(nil))
+	require.Equal(t, []time.Duration{}, NormalizeReminders([]time.Duration{}))
+	require.Equal(t, []time.Duration{24 * time.Hour, time.Hour, 10 * time.Minute},
+		NormalizeReminders([]time.Duration{time.Hour, 10 * time.Minute, 24 * time.Hour, time.Hour}))
+}
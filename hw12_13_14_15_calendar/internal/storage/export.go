@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Exporter reads all the data of a storage for backups. The events are paged through in ID order,
+// either the trashed ones or the others.
+type Exporter interface {
+	ExportEvents(ctx context.Context, trashed bool, afterID string, limit int) ([]Event, error)
+	ExportUserSettings(ctx context.Context) ([]UserSettings, error)
+	ExportTags(ctx context.Context) ([]Tag, error)
+}
+
+// Importer writes the data of a backup into a storage, all of it or nothing.
+type Importer interface {
+	CreateEvent(ctx context.Context, event Event) error
+	TrashEvent(ctx context.Context, id string, deletedAt time.Time) error
+	SaveUserSettings(ctx context.Context, settings UserSettings) error
+	SaveTag(ctx context.Context, tag Tag) error
+}
@@ -0,0 +1,11 @@
+package storage
+
+import "time"
+
+// IdempotencyKey remembers which event was created by a request carrying the client supplied key.
+type IdempotencyKey struct {
+	UserID    string
+	Key       string
+	EventID   string
+	ExpiresAt time.Time
+}
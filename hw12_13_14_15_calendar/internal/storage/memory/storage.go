@@ -1,14 +1,642 @@
 package memorystorage
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
 
 type Storage struct {
-	// TODO
-	mu sync.RWMutex
+	mu              sync.RWMutex
+	events          map[string]storage.Event
+	idempotencyKeys map[idempotencyKeyID]storage.IdempotencyKey
+	auditRecords    map[string][]storage.AuditRecord
+	shares          map[shareID]storage.Share
+	settings        map[string]storage.UserSettings
+	tags            map[tagID]storage.Tag
+}
+
+type tagID struct {
+	userID string
+	name   string
+}
+
+type shareID struct {
+	ownerID string
+	userID  string
+}
+
+type idempotencyKeyID struct {
+	userID string
+	key    string
 }
 
 func New() *Storage {
-	return &Storage{}
+	return &Storage{
+		events:          make(map[string]storage.Event),
+		idempotencyKeys: make(map[idempotencyKeyID]storage.IdempotencyKey),
+		auditRecords:    make(map[string][]storage.AuditRecord),
+		shares:          make(map[shareID]storage.Share),
+		settings:        make(map[string]storage.UserSettings),
+		tags:            make(map[tagID]storage.Tag),
+	}
+}
+
+func (s *Storage) CreateEvent(ctx context.Context, event storage.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createEvent(event)
+}
+
+func (s *Storage) UpdateEvent(ctx context.Context, event storage.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateEvent(event)
+}
+
+func (s *Storage) TrashEvent(ctx context.Context, id string, deletedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.trashEvent(id, deletedAt)
+}
+
+// ApplyBatch applies the operations in order and returns the error of each of them. In the atomic mode the events
+// are restored to their state before the batch if any operation fails.
+func (s *Storage) ApplyBatch(ctx context.Context, ops []storage.BatchOp, mode storage.BatchMode) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var snapshot map[string]storage.Event
+	if mode == storage.BatchAtomic {
+		snapshot = make(map[string]storage.Event, len(s.events))
+		for id, event := range s.events {
+			snapshot[id] = event
+		}
+	}
+
+	errs := make([]error, len(ops))
+	for i, op := range ops {
+		errs[i] = s.applyBatchOp(op)
+		if errs[i] != nil && mode == storage.BatchAtomic {
+			s.events = snapshot
+			return storage.AbortBatch(errs, i), nil
+		}
+	}
+	return errs, nil
+}
+
+func (s *Storage) applyBatchOp(op storage.BatchOp) error {
+	switch op.Kind {
+	case storage.BatchCreate:
+		return s.createEvent(op.Event)
+	case storage.BatchUpdate:
+		return s.updateEvent(op.Event)
+	case storage.BatchDelete:
+		return s.trashEvent(op.Event.ID, op.Event.DeletedAt)
+	default:
+		return fmt.Errorf("unknown batch operation %q", op.Kind)
+	}
+}
+
+func (s *Storage) createEvent(event storage.Event) error {
+	if _, ok := s.events[event.ID]; ok {
+		return storage.ErrEventExists
+	}
+	if s.isBusy(event) {
+		return storage.ErrDateBusy
+	}
+	s.events[event.ID] = stored(event)
+	return nil
+}
+
+func (s *Storage) updateEvent(event storage.Event) error {
+	if current, ok := s.events[event.ID]; !ok || current.Trashed() {
+		return storage.ErrEventNotFound
+	}
+	if s.isBusy(event) {
+		return storage.ErrDateBusy
+	}
+	s.events[event.ID] = stored(event)
+	return nil
+}
+
+// stored copies the event with the attendees sorted by user and the tags sorted by name,
+// the way the SQL storages return them.
+func stored(event storage.Event) storage.Event {
+	event = event.Copy()
+	sort.Slice(event.Attendees, func(i, j int) bool {
+		return event.Attendees[i].UserID < event.Attendees[j].UserID
+	})
+	sort.Strings(event.Tags)
+	return event
+}
+
+func (s *Storage) trashEvent(id string, deletedAt time.Time) error {
+	event, ok := s.events[id]
+	if !ok || event.Trashed() {
+		return storage.ErrEventNotFound
+	}
+	event.DeletedAt = deletedAt
+	s.events[id] = event
+	return nil
+}
+
+func (s *Storage) RestoreEvent(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event, ok := s.events[id]
+	if !ok || !event.Trashed() {
+		return storage.ErrEventNotFound
+	}
+	if s.isBusy(event) {
+		return storage.ErrDateBusy
+	}
+	event.DeletedAt = time.Time{}
+	s.events[id] = event
+	return nil
+}
+
+func (s *Storage) ListTrash(ctx context.Context, userID string) ([]storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]storage.Event, 0)
+	for _, event := range s.events {
+		if event.Trashed() && event.UserID == userID {
+			events = append(events, event.Copy())
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].DeletedAt.After(events[j].DeletedAt)
+	})
+	return events, nil
+}
+
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for id, event := range s.events {
+		if event.Trashed() && event.DeletedAt.Before(before) {
+			delete(s.events, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *Storage) DeleteOldEvents(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, event := range s.events {
+		if event.EndAt.Before(before) {
+			delete(s.events, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Storage) GetEvent(ctx context.Context, id string) (storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	event, ok := s.events[id]
+	if !ok {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	return event.Copy(), nil
+}
+
+// Snapshot runs fn with a copy of the events, the user settings and the tags taken at once, so a backup
+// doesn't see the changes made meanwhile.
+func (s *Storage) Snapshot(ctx context.Context, fn func(e storage.Exporter) error) error {
+	snapshot := New()
+	s.mu.RLock()
+	for id, event := range s.events {
+		snapshot.events[id] = event.Copy()
+	}
+	for userID, settings := range s.settings {
+		snapshot.settings[userID] = settings.Copy()
+	}
+	for id, tag := range s.tags {
+		snapshot.tags[id] = tag
+	}
+	s.mu.RUnlock()
+	return fn(snapshot)
 }
 
-// TODO
+// Import runs fn with the storage locked and puts the events, the user settings and the tags back
+// as they were if it fails, so a failed restore leaves nothing behind.
+func (s *Storage) Import(ctx context.Context, fn func(im storage.Importer) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make(map[string]storage.Event, len(s.events))
+	for id, event := range s.events {
+		events[id] = event
+	}
+	settings := make(map[string]storage.UserSettings, len(s.settings))
+	for userID, userSettings := range s.settings {
+		settings[userID] = userSettings
+	}
+	tags := make(map[tagID]storage.Tag, len(s.tags))
+	for id, tag := range s.tags {
+		tags[id] = tag
+	}
+	if err := fn(importer{s: s}); err != nil {
+		s.events, s.settings, s.tags = events, settings, tags
+		return err
+	}
+	return nil
+}
+
+// importer writes into the storage locked by Import.
+type importer struct {
+	s *Storage
+}
+
+func (im importer) CreateEvent(ctx context.Context, event storage.Event) error {
+	return im.s.createEvent(event)
+}
+
+func (im importer) TrashEvent(ctx context.Context, id string, deletedAt time.Time) error {
+	return im.s.trashEvent(id, deletedAt)
+}
+
+func (im importer) SaveUserSettings(ctx context.Context, settings storage.UserSettings) error {
+	return im.s.saveUserSettings(settings)
+}
+
+func (im importer) SaveTag(ctx context.Context, tag storage.Tag) error {
+	im.s.saveTag(tag)
+	return nil
+}
+
+// ExportEvents returns up to limit events with IDs after afterID in ID order, either the trashed ones or the others.
+func (s *Storage) ExportEvents(ctx context.Context, trashed bool, afterID string, limit int) ([]storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]storage.Event, 0)
+	for id, event := range s.events {
+		if event.Trashed() == trashed && id > afterID {
+			events = append(events, event.Copy())
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (s *Storage) ListEvents(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]storage.Event, 0)
+	for _, event := range s.events {
+		if event.Trashed() || !event.Overlaps(from, to) {
+			continue
+		}
+		if _, invited := event.Attendee(userID); event.UserID == userID || invited {
+			events = append(events, event.Copy())
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].StartAt.Before(events[j].StartAt)
+	})
+	return events, nil
+}
+
+func (s *Storage) SetAttendeeStatus(ctx context.Context, eventID, userID string, status storage.RSVPStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event, ok := s.events[eventID]
+	if !ok || event.Trashed() {
+		return storage.ErrEventNotFound
+	}
+	for i, a := range event.Attendees {
+		if a.UserID == userID {
+			event.Attendees[i].Status = status
+			return nil
+		}
+	}
+	return storage.ErrNotAttendee
+}
+
+func (s *Storage) GetIdempotencyKey(ctx context.Context, userID, key string) (storage.IdempotencyKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, ok := s.idempotencyKeys[idempotencyKeyID{userID: userID, key: key}]
+	if !ok {
+		return storage.IdempotencyKey{}, storage.ErrIdempotencyKeyNotFound
+	}
+	return k, nil
+}
+
+// ReserveIdempotencyKey saves the key unless the same key of the user is saved and has not expired by now.
+func (s *Storage) ReserveIdempotencyKey(ctx context.Context, key storage.IdempotencyKey, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := idempotencyKeyID{userID: key.UserID, key: key.Key}
+	if k, ok := s.idempotencyKeys[id]; ok && k.ExpiresAt.After(now) {
+		return storage.ErrIdempotencyKeyExists
+	}
+	s.idempotencyKeys[id] = key
+	return nil
+}
+
+// DeleteIdempotencyKey deletes the key unless it has been reserved for another event meanwhile.
+func (s *Storage) DeleteIdempotencyKey(ctx context.Context, key storage.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := idempotencyKeyID{userID: key.UserID, key: key.Key}
+	if k, ok := s.idempotencyKeys[id]; ok && k.EventID == key.EventID {
+		delete(s.idempotencyKeys, id)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, k := range s.idempotencyKeys {
+		if !k.ExpiresAt.After(now) {
+			delete(s.idempotencyKeys, id)
+		}
+	}
+	return nil
+}
+
+// ListRemindersDue returns the reminders whose time falls into [from, to), the earliest first.
+func (s *Storage) ListRemindersDue(ctx context.Context, from, to time.Time) ([]storage.Reminder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reminders := make([]storage.Reminder, 0)
+	for _, event := range s.events {
+		if event.Trashed() {
+			continue
+		}
+		reminders = append(reminders, event.Copy().RemindersDue(from, to)...)
+	}
+	sort.Slice(reminders, func(i, j int) bool {
+		ri, rj := reminders[i], reminders[j]
+		ati, atj := ri.Event.StartAt.Add(-ri.Before), rj.Event.StartAt.Add(-rj.Before)
+		if !ati.Equal(atj) {
+			return ati.Before(atj)
+		}
+		return ri.Event.StartAt.Before(rj.Event.StartAt)
+	})
+	return reminders, nil
+}
+
+// isBusy reports whether the event conflicts with another event of its owner under the owner's policy.
+func (s *Storage) isBusy(event storage.Event) bool {
+	return s.conflicts(s.userSettings(event.UserID).ConflictPolicy, event)
+}
+
+func (s *Storage) conflicts(policy storage.ConflictPolicy, event storage.Event) bool {
+	if !policy.Exclusive(event) {
+		return false
+	}
+	for _, e := range s.events {
+		if e.ID != event.ID && e.UserID == event.UserID && !e.Trashed() && policy.Exclusive(e) &&
+			e.Overlaps(event.StartAt, event.EndAt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Storage) userSettings(userID string) storage.UserSettings {
+	if settings, ok := s.settings[userID]; ok {
+		return settings.Copy()
+	}
+	return storage.DefaultUserSettings(userID)
+}
+
+func (s *Storage) AddAuditRecord(ctx context.Context, record storage.AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record.Changes = append([]storage.FieldChange(nil), record.Changes...)
+	s.auditRecords[record.EventID] = append(s.auditRecords[record.EventID], record)
+	return nil
+}
+
+// ListAuditRecords returns the history of the event in the order it was recorded.
+func (s *Storage) ListAuditRecords(ctx context.Context, eventID string) ([]storage.AuditRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]storage.AuditRecord, 0, len(s.auditRecords[eventID]))
+	for _, record := range s.auditRecords[eventID] {
+		record.Changes = append([]storage.FieldChange(nil), record.Changes...)
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// SaveShare grants the access or changes the level of the existing share.
+func (s *Storage) SaveShare(ctx context.Context, share storage.Share) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shares[shareID{ownerID: share.OwnerID, userID: share.UserID}] = share
+	return nil
+}
+
+func (s *Storage) DeleteShare(ctx context.Context, ownerID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := shareID{ownerID: ownerID, userID: userID}
+	if _, ok := s.shares[id]; !ok {
+		return storage.ErrShareNotFound
+	}
+	delete(s.shares, id)
+	return nil
+}
+
+func (s *Storage) GetShare(ctx context.Context, ownerID, userID string) (storage.Share, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	share, ok := s.shares[shareID{ownerID: ownerID, userID: userID}]
+	if !ok {
+		return storage.Share{}, storage.ErrShareNotFound
+	}
+	return share, nil
+}
+
+// ListShares returns the shares of the owner's calendar sorted by user.
+func (s *Storage) ListShares(ctx context.Context, ownerID string) ([]storage.Share, error) {
+	return s.listShares(func(share storage.Share) bool { return share.OwnerID == ownerID }), nil
+}
+
+// ListSharedWith returns the shares of calendars shared with the user sorted by owner.
+func (s *Storage) ListSharedWith(ctx context.Context, userID string) ([]storage.Share, error) {
+	return s.listShares(func(share storage.Share) bool { return share.UserID == userID }), nil
+}
+
+func (s *Storage) listShares(match func(share storage.Share) bool) []storage.Share {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shares := make([]storage.Share, 0)
+	for _, share := range s.shares {
+		if match(share) {
+			shares = append(shares, share)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].OwnerID != shares[j].OwnerID {
+			return shares[i].OwnerID < shares[j].OwnerID
+		}
+		return shares[i].UserID < shares[j].UserID
+	})
+	return shares
+}
+
+// GetUserSettings returns the default settings if the user has not saved any.
+func (s *Storage) GetUserSettings(ctx context.Context, userID string) (storage.UserSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.userSettings(userID), nil
+}
+
+// ExportUserSettings returns the settings saved by the users sorted by user.
+func (s *Storage) ExportUserSettings(ctx context.Context) ([]storage.UserSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings := make([]storage.UserSettings, 0, len(s.settings))
+	for _, userSettings := range s.settings {
+		settings = append(settings, userSettings.Copy())
+	}
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].UserID < settings[j].UserID
+	})
+	return settings, nil
+}
+
+// ListDigestSettings returns the settings of the users opted in to the daily digest sorted by user.
+func (s *Storage) ListDigestSettings(ctx context.Context) ([]storage.UserSettings, error) {
+	settings, _ := s.ExportUserSettings(ctx)
+	digests := settings[:0]
+	for _, userSettings := range settings {
+		if userSettings.Digest.Enabled {
+			digests = append(digests, userSettings)
+		}
+	}
+	return digests, nil
+}
+
+// SaveUserSettings fails with ErrDateBusy if the existing events of the user conflict under the new policy.
+func (s *Storage) SaveUserSettings(ctx context.Context, settings storage.UserSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saveUserSettings(settings)
+}
+
+func (s *Storage) saveUserSettings(settings storage.UserSettings) error {
+	for _, e := range s.events {
+		if e.UserID == settings.UserID && !e.Trashed() && s.conflicts(settings.ConflictPolicy, e) {
+			return storage.ErrDateBusy
+		}
+	}
+	s.settings[settings.UserID] = settings.Copy()
+	return nil
+}
+
+// ListTags returns the tag vocabulary of the user sorted by name.
+func (s *Storage) ListTags(ctx context.Context, userID string) ([]storage.Tag, error) {
+	return s.listTags(func(tag storage.Tag) bool { return tag.UserID == userID }), nil
+}
+
+// ExportTags returns the tags of all the users sorted by user and name.
+func (s *Storage) ExportTags(ctx context.Context) ([]storage.Tag, error) {
+	return s.listTags(func(storage.Tag) bool { return true }), nil
+}
+
+func (s *Storage) listTags(match func(tag storage.Tag) bool) []storage.Tag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tags := make([]storage.Tag, 0)
+	for _, tag := range s.tags {
+		if match(tag) {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].UserID != tags[j].UserID {
+			return tags[i].UserID < tags[j].UserID
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return tags
+}
+
+// SaveTag adds the tag to the vocabulary of the user or changes the color of the existing one.
+func (s *Storage) SaveTag(ctx context.Context, tag storage.Tag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveTag(tag)
+	return nil
+}
+
+func (s *Storage) saveTag(tag storage.Tag) {
+	s.tags[tagID{userID: tag.UserID, name: tag.Name}] = tag
+}
+
+// DeleteTag removes the tag from the vocabulary of the user and from all the events of the user,
+// the trashed ones included.
+func (s *Storage) DeleteTag(ctx context.Context, userID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := tagID{userID: userID, name: name}
+	if _, ok := s.tags[id]; !ok {
+		return storage.ErrTagNotFound
+	}
+	delete(s.tags, id)
+	for eventID, event := range s.events {
+		if event.UserID != userID || !event.HasTag(name) {
+			continue
+		}
+		tags := make([]string, 0, len(event.Tags)-1)
+		for _, tag := range event.Tags {
+			if tag != name {
+				tags = append(tags, tag)
+			}
+		}
+		event.Tags = tags
+		s.events[eventID] = event
+	}
+	return nil
+}
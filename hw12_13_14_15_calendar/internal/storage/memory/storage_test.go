@@ -1,7 +1,18 @@
 package memorystorage
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/storagetest"
+)
 
 func TestStorage(t *testing.T) {
-	// TODO
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		return New()
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	s := New()
+	storagetest.RunSnapshot(t, s, s)
 }
@@ -0,0 +1,60 @@
+package storage
+
+import "time"
+
+// NotificationKind tells reminders from digests. Reminders leave it empty, as the messages
+// queued before digests were added do.
+type NotificationKind string
+
+const (
+	NotificationReminder NotificationKind = ""
+	NotificationDigest   NotificationKind = "digest"
+)
+
+// Notification is passed from the scheduler to the sender through the queue as JSON.
+// A digest has no event, it starts at the beginning of the day it lists the events of.
+type Notification struct {
+	Kind    NotificationKind `json:"kind,omitempty"`
+	EventID string           `json:"eventId"`
+	Title   string           `json:"title"`
+	StartAt time.Time        `json:"startAt"`
+	UserID  string           `json:"userId"`
+	Before  time.Duration    `json:"before"` // Which of the event reminders this is.
+	Agenda  []AgendaItem     `json:"agenda,omitempty"`
+}
+
+// AgendaItem is an event listed in a digest.
+type AgendaItem struct {
+	EventID string    `json:"eventId"`
+	Title   string    `json:"title"`
+	StartAt time.Time `json:"startAt"`
+	EndAt   time.Time `json:"endAt"`
+}
+
+// Digest lists the events of the user on the day starting at the given time. The events the user
+// declined or hasn't answered are left out, the way reminders go only to accepted attendees.
+func Digest(userID string, day time.Time, events []Event) Notification {
+	notification := Notification{Kind: NotificationDigest, StartAt: day, UserID: userID}
+	for _, event := range events {
+		if event.UserID != userID {
+			if a, ok := event.Attendee(userID); !ok || a.Status != RSVPAccepted {
+				continue
+			}
+		}
+		notification.Agenda = append(notification.Agenda, AgendaItem{
+			EventID: event.ID,
+			Title:   event.Title,
+			StartAt: event.StartAt,
+			EndAt:   event.EndAt,
+		})
+	}
+	return notification
+}
+
+// Subject names what the notification is about for the log lines.
+func (n Notification) Subject() string {
+	if n.Kind == NotificationDigest {
+		return "digest of " + n.StartAt.Format("2006-01-02")
+	}
+	return "event " + n.EventID
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+// ConflictPolicy decides whether events of the user may overlap.
+type ConflictPolicy string
+
+const (
+	ConflictReject         ConflictPolicy = "reject"          // No overlaps, ErrDateBusy is returned.
+	ConflictAllow          ConflictPolicy = "allow"           // Any events may overlap.
+	ConflictAllowTentative ConflictPolicy = "allow_tentative" // Only tentative events may overlap others.
+)
+
+func (p ConflictPolicy) Valid() bool {
+	return p == ConflictReject || p == ConflictAllow || p == ConflictAllowTentative
+}
+
+// Exclusive reports whether the event may not overlap other exclusive events of its owner under the policy.
+// Out-of-office events are never exclusive.
+func (p ConflictPolicy) Exclusive(event Event) bool {
+	if event.OutOfOffice() {
+		return false
+	}
+	switch p {
+	case ConflictAllow:
+		return false
+	case ConflictAllowTentative:
+		return !event.Tentative
+	default:
+		return true
+	}
+}
+
+// UserSettings are the preferences of the user, stored next to the user's events.
+type UserSettings struct {
+	UserID         string
+	ConflictPolicy ConflictPolicy
+	// DefaultReminders are given to the user's events created or updated without reminders.
+	DefaultReminders []time.Duration
+	WorkingHours     WorkingHours
+	Digest           DigestSettings
+}
+
+// WorkingHours are the hours of the working days the user is available at, in the user's time zone.
+// The zero value means the user is available at any time.
+type WorkingHours struct {
+	Days     []time.Weekday
+	Start    time.Duration // Since midnight.
+	End      time.Duration
+	TimeZone string // IANA name, UTC if empty.
+}
+
+func (h WorkingHours) IsZero() bool {
+	return len(h.Days) == 0
+}
+
+// Location returns the time zone of the working hours, UTC if it is unknown.
+func (h WorkingHours) Location() *time.Location {
+	return location(h.TimeZone)
+}
+
+// Contains reports whether the [from, to) interval lies within the working hours of a single working day.
+func (h WorkingHours) Contains(from, to time.Time) bool {
+	if h.IsZero() {
+		return true
+	}
+
+	from = from.In(h.Location())
+	if !h.isWorkingDay(from.Weekday()) {
+		return false
+	}
+	// Nanoseconds overflowing the day are normalized by time.Date into the wall clock time.
+	year, month, day := from.Date()
+	start := time.Date(year, month, day, 0, 0, 0, int(h.Start), from.Location())
+	end := time.Date(year, month, day, 0, 0, 0, int(h.End), from.Location())
+	return !from.Before(start) && !to.After(end)
+}
+
+// ParseWeekday parses the lowercase English name of the day, the way the APIs spell working days.
+func ParseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if FormatWeekday(day) == name {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+func FormatWeekday(day time.Weekday) string {
+	return strings.ToLower(day.String())
+}
+
+func (h WorkingHours) isWorkingDay(day time.Weekday) bool {
+	for _, d := range h.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// DigestSettings opt the user in to the daily digest of the day's events. The scheduler sends it
+// at the configured time of day in the time zone of the user.
+type DigestSettings struct {
+	Enabled  bool
+	TimeZone string // IANA name, UTC if empty.
+}
+
+// Location returns the time zone of the digest, UTC if it is unknown.
+func (d DigestSettings) Location() *time.Location {
+	return location(d.TimeZone)
+}
+
+// Due returns the start of the local day whose digest, sent at the given time since midnight,
+// falls into [from, to). Only the first such day is returned, the scheduler ticks more often than daily.
+func (d DigestSettings) Due(from, to time.Time, at time.Duration) (time.Time, bool) {
+	if !d.Enabled {
+		return time.Time{}, false
+	}
+
+	local := from.In(d.Location())
+	year, month, day := local.Date()
+	sendAt := time.Date(year, month, day, 0, 0, 0, int(at), local.Location())
+	if sendAt.Before(from) {
+		day++
+		sendAt = time.Date(year, month, day, 0, 0, 0, int(at), local.Location())
+	}
+	if !sendAt.Before(to) {
+		return time.Time{}, false
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, local.Location()), true
+}
+
+func location(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// DefaultUserSettings are used until the user saves own settings.
+func DefaultUserSettings(userID string) UserSettings {
+	return UserSettings{UserID: userID, ConflictPolicy: ConflictReject}
+}
+
+// Copy returns a deep copy of the settings.
+func (s UserSettings) Copy() UserSettings {
+	if s.DefaultReminders != nil {
+		s.DefaultReminders = append([]time.Duration{}, s.DefaultReminders...)
+	}
+	if s.WorkingHours.Days != nil {
+		s.WorkingHours.Days = append([]time.Weekday{}, s.WorkingHours.Days...)
+	}
+	return s
+}
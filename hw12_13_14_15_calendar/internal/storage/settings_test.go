@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkingHoursContains(t *testing.T) {
+	hours := WorkingHours{
+		Days:     []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Start:    9 * time.Hour,
+		End:      18 * time.Hour,
+		TimeZone: "Europe/Moscow",
+	}
+	// 2022-06-01 is Wednesday, Moscow is UTC+3.
+	at := func(day, hour int) time.Time {
+		return time.Date(2022, time.June, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		within   bool
+	}{
+		{name: "whole day", from: at(1, 6), to: at(1, 15), within: true},
+		{name: "early", from: at(1, 5), to: at(1, 7)},
+		{name: "late", from: at(1, 14), to: at(1, 16)},
+		{name: "weekend", from: at(4, 7), to: at(4, 8)},
+		{name: "two days", from: at(1, 7), to: at(2, 7)},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.within, hours.Contains(tc.from, tc.to), tc.name)
+	}
+
+	require.True(t, WorkingHours{}.Contains(at(4, 0), at(5, 0)))
+}
+
+func TestParseWeekday(t *testing.T) {
+	day, ok := ParseWeekday("sunday")
+	require.True(t, ok)
+	require.Equal(t, time.Sunday, day)
+	require.Equal(t, "sunday", FormatWeekday(day))
+
+	_, ok = ParseWeekday("Sunday")
+	require.False(t, ok)
+}
+
+func TestConflictPolicyOutOfOffice(t *testing.T) {
+	away := Event{Kind: EventOutOfOffice}
+	for _, policy := range []ConflictPolicy{ConflictReject, ConflictAllow, ConflictAllowTentative} {
+		require.False(t, policy.Exclusive(away), policy)
+	}
+	require.True(t, ConflictReject.Exclusive(Event{Kind: EventRegular}))
+}
+
+func TestDigestDue(t *testing.T) {
+	digest := DigestSettings{Enabled: true, TimeZone: "Europe/Moscow"}
+	moscow := digest.Location()
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2022, time.June, day, hour, minute, 0, 0, moscow)
+	}
+
+	day, ok := digest.Due(at(1, 7, 59), at(1, 8, 1), 8*time.Hour)
+	require.True(t, ok)
+	require.Equal(t, at(1, 0, 0), day)
+
+	// The window is half-open.
+	_, ok = digest.Due(at(1, 7, 58), at(1, 8, 0), 8*time.Hour)
+	require.False(t, ok)
+	_, ok = digest.Due(at(1, 8, 0), at(1, 8, 1), 8*time.Hour)
+	require.True(t, ok)
+
+	// The window crosses the midnight.
+	day, ok = digest.Due(at(1, 23, 59), at(2, 0, 1), 0)
+	require.True(t, ok)
+	require.Equal(t, at(2, 0, 0), day)
+
+	_, ok = DigestSettings{TimeZone: "Europe/Moscow"}.Due(at(1, 7, 59), at(1, 8, 1), 8*time.Hour)
+	require.False(t, ok)
+}
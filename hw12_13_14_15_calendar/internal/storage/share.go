@@ -0,0 +1,19 @@
+package storage
+
+type AccessLevel string
+
+const (
+	AccessRead  AccessLevel = "read"  // See the events of the calendar and their history.
+	AccessWrite AccessLevel = "write" // Also create, change, delete and restore events on behalf of the owner.
+)
+
+func (l AccessLevel) Valid() bool {
+	return l == AccessRead || l == AccessWrite
+}
+
+// Share grants the user access to the calendar of the owner.
+type Share struct {
+	OwnerID string
+	UserID  string
+	Level   AccessLevel
+}
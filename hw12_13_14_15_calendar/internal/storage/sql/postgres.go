@@ -0,0 +1,81 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/jackc/pgconn"
+	_ "github.com/jackc/pgx/v4/stdlib" // Register pgx driver for database/sql.
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	uniqueViolation    = "23505"
+	exclusionViolation = "23P01"
+)
+
+// New creates the storage of the Postgres database given by dsn, the migrations are applied by "make migrate".
+func New(dsn string) *Storage {
+	return NewWithDialect(dsn, postgres{})
+}
+
+// postgres keeps the exclusive events from overlapping with the events_no_overlap exclusion constraint.
+type postgres struct{}
+
+func (postgres) Connect(ctx context.Context, dsn string) (*sqlx.DB, error) {
+	return sqlx.ConnectContext(ctx, "pgx", dsn)
+}
+
+// Snapshot uses a repeatable read transaction, which reads the data as of its first query.
+func (postgres) Snapshot(ctx context.Context, db *sqlx.DB) (Queryer, func(), error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, func() { _ = tx.Rollback() }, nil // Nothing was written.
+}
+
+func (postgres) EncodeTime(t time.Time) interface{} {
+	return t
+}
+
+func (postgres) DecodeTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v, nil
+	default:
+		return time.Time{}, fmt.Errorf("decode time: unexpected %T", v)
+	}
+}
+
+// LockShared keeps the rows from being changed until the transaction ends. A missing settings row can't be
+// locked, so the first save of the settings doesn't wait for the writes that found the defaults.
+func (postgres) LockShared() string {
+	return ` FOR SHARE`
+}
+
+// ReminderAt converts the nanoseconds of the reminder to an interval, which has microsecond precision.
+func (postgres) ReminderAt() string {
+	return `e.start_at - r.before / 1000 * interval '1 microsecond'`
+}
+
+func (postgres) Violation(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+	switch pgErr.Code {
+	case uniqueViolation:
+		return storage.ErrEventExists
+	case exclusionViolation:
+		return storage.ErrDateBusy
+	default:
+		return nil
+	}
+}
@@ -1,20 +1,1101 @@
 package sqlstorage
 
-import "context"
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
-type Storage struct { // TODO
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// errBatchFailed rolls back the transaction of an atomic batch, the errors of operations are reported separately.
+var errBatchFailed = errors.New("batch failed")
+
+// Storage keeps the calendar in a SQL database. The queries are shared by the databases, what they differ in
+// is left to the dialect.
+type Storage struct {
+	dsn     string
+	dialect Dialect
+	db      *sqlx.DB
+}
+
+// Dialect adapts the storage to a database. The queries use $n placeholders, which the drivers of both
+// Postgres and SQLite take. The schema of the dialect keeps exclusive events of a user from overlapping,
+// with a constraint or otherwise.
+type Dialect interface {
+	// Connect opens the database of the DSN, ready to be used by the storage.
+	Connect(ctx context.Context, dsn string) (*sqlx.DB, error)
+	// Snapshot starts the read-only transaction backups export in and returns the function ending it.
+	Snapshot(ctx context.Context, db *sqlx.DB) (Queryer, func(), error)
+	// EncodeTime converts the time to the value of a time column, DecodeTime converts the scanned
+	// value back, NULL to the zero time.
+	EncodeTime(t time.Time) interface{}
+	DecodeTime(v interface{}) (time.Time, error)
+	// LockShared is the locking clause of the rows read by a write transaction that depends on them.
+	LockShared() string
+	// ReminderAt is the expression of the time the reminder r of the event e is due at.
+	ReminderAt() string
+	// Violation maps the error of a violated constraint to storage.ErrEventExists for a duplicate event and
+	// to storage.ErrDateBusy for overlapping exclusive events. It returns nil for the other errors.
+	Violation(err error) error
+}
+
+// Queryer runs the queries either on the database or within a transaction.
+type Queryer interface {
+	sqlx.QueryerContext
+	Rebind(query string) string
+}
+
+// The time columns are kept as the dialect encodes them.
+type eventRow struct {
+	ID          string      `db:"id"`
+	Title       string      `db:"title"`
+	StartAt     interface{} `db:"start_at"`
+	EndAt       interface{} `db:"end_at"`
+	Description string      `db:"description"`
+	UserID      string      `db:"user_id"`
+	Kind        string      `db:"kind"`
+	Category    string      `db:"category"`
+	Color       string      `db:"color"`
+	Tentative   bool        `db:"tentative"`
+	DeletedAt   interface{} `db:"deleted_at"`
+	// Exclusive is derived from the owner's conflict policy, no two exclusive events of a user overlap.
+	Exclusive bool `db:"exclusive"`
+}
+
+type idempotencyKeyRow struct {
+	UserID    string      `db:"user_id"`
+	Key       string      `db:"idempotency_key"`
+	EventID   string      `db:"event_id"`
+	ExpiresAt interface{} `db:"expires_at"`
+}
+
+// auditRecordRow keeps the field changes as a JSON array.
+type auditRecordRow struct {
+	EventID string      `db:"event_id"`
+	Action  string      `db:"action"`
+	ActorID string      `db:"actor_id"`
+	At      interface{} `db:"at"`
+	Changes string      `db:"changes"`
 }
 
-func New() *Storage {
-	return &Storage{}
+type shareRow struct {
+	OwnerID string `db:"owner_id"`
+	UserID  string `db:"user_id"`
+	Level   string `db:"level"`
+}
+
+type userSettingsRow struct {
+	UserID         string `db:"user_id"`
+	ConflictPolicy string `db:"conflict_policy"`
+	// WorkingDays is a bit mask of the working weekdays, bit 0 is Sunday.
+	WorkingDays  int64  `db:"working_days"`
+	WorkingStart int64  `db:"working_start"`
+	WorkingEnd   int64  `db:"working_end"`
+	TimeZone     string `db:"time_zone"`
+
+	DigestEnabled  bool   `db:"digest_enabled"`
+	DigestTimeZone string `db:"digest_time_zone"`
+}
+
+// reminderRow is a due reminder along with its event.
+type reminderRow struct {
+	eventRow
+	Before int64 `db:"before"`
+}
+
+type eventReminderRow struct {
+	EventID string `db:"event_id"`
+	Before  int64  `db:"before"`
+}
+
+type eventTagRow struct {
+	EventID string `db:"event_id"`
+	Tag     string `db:"tag"`
+}
+
+type tagRow struct {
+	UserID string `db:"user_id"`
+	Name   string `db:"name"`
+	Color  string `db:"color"`
+}
+
+type attendeeRow struct {
+	EventID string `db:"event_id"`
+	UserID  string `db:"user_id"`
+	Status  string `db:"status"`
+}
+
+// NewWithDialect creates the storage of the database given by dsn in the dialect.
+func NewWithDialect(dsn string, dialect Dialect) *Storage {
+	return &Storage{dsn: dsn, dialect: dialect}
 }
 
 func (s *Storage) Connect(ctx context.Context) error {
-	// TODO
+	db, err := s.dialect.Connect(ctx, s.dsn)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+	s.db = db
 	return nil
 }
 
 func (s *Storage) Close(ctx context.Context) error {
-	// TODO
+	return s.db.Close()
+}
+
+func (s *Storage) CreateEvent(ctx context.Context, event storage.Event) error {
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		return s.createEvent(ctx, tx, event)
+	})
+}
+
+func (s *Storage) UpdateEvent(ctx context.Context, event storage.Event) error {
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		return s.updateEvent(ctx, tx, event)
+	})
+}
+
+func (s *Storage) TrashEvent(ctx context.Context, id string, deletedAt time.Time) error {
+	return s.trashEvent(ctx, s.db, id, deletedAt)
+}
+
+// ApplyBatch applies the operations in a single transaction and returns the error of each of them.
+// In the best effort mode every operation runs in its own savepoint, so a failed one doesn't abort the rest.
+func (s *Storage) ApplyBatch(ctx context.Context, ops []storage.BatchOp, mode storage.BatchMode) ([]error, error) {
+	errs := make([]error, len(ops))
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		for i, op := range ops {
+			if mode == storage.BatchBestEffort {
+				if _, err := tx.ExecContext(ctx, `SAVEPOINT batch_op`); err != nil {
+					return fmt.Errorf("create savepoint: %w", err)
+				}
+			}
+
+			errs[i] = s.applyBatchOp(ctx, tx, op)
+			switch {
+			case errs[i] != nil && mode == storage.BatchAtomic:
+				storage.AbortBatch(errs, i)
+				return errBatchFailed
+			case errs[i] != nil:
+				if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT batch_op`); err != nil {
+					return fmt.Errorf("rollback to savepoint: %w", err)
+				}
+			case mode == storage.BatchBestEffort:
+				if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT batch_op`); err != nil {
+					return fmt.Errorf("release savepoint: %w", err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func (s *Storage) RestoreEvent(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE events SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	if violation := s.dialect.Violation(err); violation != nil {
+		return violation
+	}
+	if err != nil {
+		return fmt.Errorf("restore event: %w", err)
+	}
+	return checkAffected(res)
+}
+
+func (s *Storage) ListTrash(ctx context.Context, userID string) ([]storage.Event, error) {
+	var rows []eventRow
+	err := s.db.SelectContext(ctx, &rows, `
+		SELECT id, title, start_at, end_at, description, user_id, kind, category, color, tentative, deleted_at
+		FROM events
+		WHERE user_id = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("select trash: %w", err)
+	}
+	return withDetails(ctx, s.db, s.dialect, rows)
+}
+
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE deleted_at < $1`,
+		s.dialect.EncodeTime(before))
+	if err != nil {
+		return 0, fmt.Errorf("purge trash: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *Storage) DeleteOldEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE end_at < $1`,
+		s.dialect.EncodeTime(before))
+	if err != nil {
+		return 0, fmt.Errorf("delete old events: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ListRemindersDue returns the reminders whose time falls into [from, to), the earliest first.
+func (s *Storage) ListRemindersDue(ctx context.Context, from, to time.Time) ([]storage.Reminder, error) {
+	remindAt := s.dialect.ReminderAt()
+	var rows []reminderRow
+	err := s.db.SelectContext(ctx, &rows, `
+		SELECT e.id, e.title, e.start_at, e.end_at, e.description, e.user_id, e.kind, e.category, e.color, e.tentative,
+			e.deleted_at, r.before
+		FROM events e
+		JOIN event_reminders r ON r.event_id = e.id
+		WHERE e.deleted_at IS NULL AND `+remindAt+` >= $1 AND `+remindAt+` < $2
+		ORDER BY `+remindAt+`, e.start_at`, s.dialect.EncodeTime(from), s.dialect.EncodeTime(to))
+	if err != nil {
+		return nil, fmt.Errorf("select reminders due: %w", err)
+	}
+
+	eventRows := make([]eventRow, 0, len(rows))
+	for _, row := range rows {
+		eventRows = append(eventRows, row.eventRow)
+	}
+	events, err := withDetails(ctx, s.db, s.dialect, eventRows)
+	if err != nil {
+		return nil, err
+	}
+	reminders := make([]storage.Reminder, 0, len(rows))
+	for i, row := range rows {
+		reminders = append(reminders, storage.Reminder{Event: events[i], Before: time.Duration(row.Before)})
+	}
+	return reminders, nil
+}
+
+func (s *Storage) GetEvent(ctx context.Context, id string) (storage.Event, error) {
+	var row eventRow
+	err := s.db.GetContext(ctx, &row, `
+		SELECT id, title, start_at, end_at, description, user_id, kind, category, color, tentative, deleted_at
+		FROM events
+		WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	if err != nil {
+		return storage.Event{}, fmt.Errorf("select event: %w", err)
+	}
+
+	events, err := withDetails(ctx, s.db, s.dialect, []eventRow{row})
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return events[0], nil
+}
+
+func (s *Storage) ListEvents(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error) {
+	var rows []eventRow
+	err := s.db.SelectContext(ctx, &rows, `
+		SELECT e.id, e.title, e.start_at, e.end_at, e.description, e.user_id, e.kind, e.category, e.color, e.tentative,
+			e.deleted_at
+		FROM events e
+		WHERE e.deleted_at IS NULL AND e.start_at < $3 AND e.end_at > $2
+			AND (e.user_id = $1 OR EXISTS (
+				SELECT 1 FROM event_attendees a WHERE a.event_id = e.id AND a.user_id = $1
+			))
+		ORDER BY e.start_at`, userID, s.dialect.EncodeTime(from), s.dialect.EncodeTime(to))
+	if err != nil {
+		return nil, fmt.Errorf("select events: %w", err)
+	}
+	return withDetails(ctx, s.db, s.dialect, rows)
+}
+
+func (s *Storage) SetAttendeeStatus(ctx context.Context, eventID, userID string, status storage.RSVPStatus) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE event_attendees SET status = $3
+		WHERE event_id = $1 AND user_id = $2
+			AND EXISTS (SELECT 1 FROM events e WHERE e.id = event_id AND e.deleted_at IS NULL)`,
+		eventID, userID, string(status))
+	if err != nil {
+		return fmt.Errorf("update attendee: %w", err)
+	}
+	if err := checkAffected(res); !errors.Is(err, storage.ErrEventNotFound) {
+		return err
+	}
+
+	event, err := s.GetEvent(ctx, eventID)
+	if err != nil {
+		return err
+	}
+	if event.Trashed() {
+		return storage.ErrEventNotFound
+	}
+	return storage.ErrNotAttendee
+}
+
+func (s *Storage) GetIdempotencyKey(ctx context.Context, userID, key string) (storage.IdempotencyKey, error) {
+	var row idempotencyKeyRow
+	err := s.db.GetContext(ctx, &row, `
+		SELECT user_id, idempotency_key, event_id, expires_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2`, userID, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.IdempotencyKey{}, storage.ErrIdempotencyKeyNotFound
+	}
+	if err != nil {
+		return storage.IdempotencyKey{}, fmt.Errorf("select idempotency key: %w", err)
+	}
+	expiresAt, err := s.dialect.DecodeTime(row.ExpiresAt)
+	if err != nil {
+		return storage.IdempotencyKey{}, err
+	}
+	return storage.IdempotencyKey{
+		UserID:    row.UserID,
+		Key:       row.Key,
+		EventID:   row.EventID,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// ReserveIdempotencyKey inserts the key, or replaces it if it has expired by now. The primary key makes
+// concurrent reservations of the same key wait for each other, so only one of them succeeds.
+func (s *Storage) ReserveIdempotencyKey(ctx context.Context, key storage.IdempotencyKey, now time.Time) error {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, idempotency_key, event_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, idempotency_key) DO UPDATE
+		SET event_id = excluded.event_id, expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at <= $5`,
+		key.UserID, key.Key, key.EventID, s.dialect.EncodeTime(key.ExpiresAt), s.dialect.EncodeTime(now))
+	if err != nil {
+		return fmt.Errorf("reserve idempotency key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if n == 0 {
+		return storage.ErrIdempotencyKeyExists
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey deletes the key unless it has been reserved for another event meanwhile.
+func (s *Storage) DeleteIdempotencyKey(ctx context.Context, key storage.IdempotencyKey) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2 AND event_id = $3`,
+		key.UserID, key.Key, key.EventID)
+	if err != nil {
+		return fmt.Errorf("delete idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, s.dialect.EncodeTime(now))
+	if err != nil {
+		return fmt.Errorf("delete expired idempotency keys: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) AddAuditRecord(ctx context.Context, record storage.AuditRecord) error {
+	changes, err := json.Marshal(record.Changes)
+	if err != nil {
+		return fmt.Errorf("marshal audit changes: %w", err)
+	}
+	_, err = s.db.NamedExecContext(ctx, `
+		INSERT INTO audit_records (event_id, action, actor_id, at, changes)
+		VALUES (:event_id, :action, :actor_id, :at, :changes)`,
+		auditRecordRow{
+			EventID: record.EventID,
+			Action:  string(record.Action),
+			ActorID: record.ActorID,
+			At:      s.dialect.EncodeTime(record.At),
+			Changes: string(changes),
+		})
+	if err != nil {
+		return fmt.Errorf("insert audit record: %w", err)
+	}
+	return nil
+}
+
+// ListAuditRecords returns the history of the event in the order it was recorded.
+func (s *Storage) ListAuditRecords(ctx context.Context, eventID string) ([]storage.AuditRecord, error) {
+	var rows []auditRecordRow
+	err := s.db.SelectContext(ctx, &rows, `
+		SELECT event_id, action, actor_id, at, changes
+		FROM audit_records
+		WHERE event_id = $1
+		ORDER BY id`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("select audit records: %w", err)
+	}
+
+	records := make([]storage.AuditRecord, 0, len(rows))
+	for _, row := range rows {
+		at, err := s.dialect.DecodeTime(row.At)
+		if err != nil {
+			return nil, err
+		}
+		record := storage.AuditRecord{
+			EventID: row.EventID,
+			Action:  storage.AuditAction(row.Action),
+			ActorID: row.ActorID,
+			At:      at,
+		}
+		if err := json.Unmarshal([]byte(row.Changes), &record.Changes); err != nil {
+			return nil, fmt.Errorf("unmarshal audit changes: %w", err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// SaveShare grants the access or changes the level of the existing share.
+func (s *Storage) SaveShare(ctx context.Context, share storage.Share) error {
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO calendar_shares (owner_id, user_id, level)
+		VALUES (:owner_id, :user_id, :level)
+		ON CONFLICT (owner_id, user_id) DO UPDATE SET level = excluded.level`,
+		shareRow{OwnerID: share.OwnerID, UserID: share.UserID, Level: string(share.Level)})
+	if err != nil {
+		return fmt.Errorf("save share: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteShare(ctx context.Context, ownerID, userID string) error {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM calendar_shares WHERE owner_id = $1 AND user_id = $2`, ownerID, userID)
+	if err != nil {
+		return fmt.Errorf("delete share: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete share: %w", err)
+	}
+	if n == 0 {
+		return storage.ErrShareNotFound
+	}
 	return nil
 }
+
+func (s *Storage) GetShare(ctx context.Context, ownerID, userID string) (storage.Share, error) {
+	var row shareRow
+	err := s.db.GetContext(ctx, &row, `
+		SELECT owner_id, user_id, level FROM calendar_shares
+		WHERE owner_id = $1 AND user_id = $2`, ownerID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Share{}, storage.ErrShareNotFound
+	}
+	if err != nil {
+		return storage.Share{}, fmt.Errorf("select share: %w", err)
+	}
+	return row.toShare(), nil
+}
+
+// ListShares returns the shares of the owner's calendar sorted by user.
+func (s *Storage) ListShares(ctx context.Context, ownerID string) ([]storage.Share, error) {
+	return s.listShares(ctx, `
+		SELECT owner_id, user_id, level FROM calendar_shares
+		WHERE owner_id = $1
+		ORDER BY user_id`, ownerID)
+}
+
+// ListSharedWith returns the shares of calendars shared with the user sorted by owner.
+func (s *Storage) ListSharedWith(ctx context.Context, userID string) ([]storage.Share, error) {
+	return s.listShares(ctx, `
+		SELECT owner_id, user_id, level FROM calendar_shares
+		WHERE user_id = $1
+		ORDER BY owner_id`, userID)
+}
+
+func (s *Storage) listShares(ctx context.Context, query string, userID string) ([]storage.Share, error) {
+	var rows []shareRow
+	if err := s.db.SelectContext(ctx, &rows, query, userID); err != nil {
+		return nil, fmt.Errorf("select shares: %w", err)
+	}
+	shares := make([]storage.Share, 0, len(rows))
+	for _, row := range rows {
+		shares = append(shares, row.toShare())
+	}
+	return shares, nil
+}
+
+// ListDigestSettings returns the settings of the users opted in to the daily digest sorted by user.
+func (s *Storage) ListDigestSettings(ctx context.Context) ([]storage.UserSettings, error) {
+	return listUserSettings(ctx, s.db, `SELECT user_id FROM user_settings WHERE digest_enabled ORDER BY user_id`)
+}
+
+// listUserSettings loads the settings of the users selected by the query.
+func listUserSettings(ctx context.Context, q Queryer, query string) ([]storage.UserSettings, error) {
+	var userIDs []string
+	if err := sqlx.SelectContext(ctx, q, &userIDs, query); err != nil {
+		return nil, fmt.Errorf("select user settings: %w", err)
+	}
+	settings := make([]storage.UserSettings, 0, len(userIDs))
+	for _, userID := range userIDs {
+		userSettings, err := getUserSettings(ctx, q, userID)
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, userSettings)
+	}
+	return settings, nil
+}
+
+// GetUserSettings returns the default settings if the user has not saved any.
+func (s *Storage) GetUserSettings(ctx context.Context, userID string) (storage.UserSettings, error) {
+	return getUserSettings(ctx, s.db, userID)
+}
+
+// SaveUserSettings recomputes which events of the user are exclusive, so it fails with ErrDateBusy
+// if the existing events conflict under the new policy.
+func (s *Storage) SaveUserSettings(ctx context.Context, settings storage.UserSettings) error {
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		return s.saveUserSettings(ctx, tx, settings)
+	})
+}
+
+func (s *Storage) saveUserSettings(ctx context.Context, tx *sqlx.Tx, settings storage.UserSettings) error {
+	row := toUserSettingsRow(settings)
+	_, err := tx.NamedExecContext(ctx, `
+		INSERT INTO user_settings (user_id, conflict_policy, working_days, working_start, working_end, time_zone,
+			digest_enabled, digest_time_zone)
+		VALUES (:user_id, :conflict_policy, :working_days, :working_start, :working_end, :time_zone,
+			:digest_enabled, :digest_time_zone)
+		ON CONFLICT (user_id) DO UPDATE SET conflict_policy = excluded.conflict_policy,
+			working_days = excluded.working_days, working_start = excluded.working_start,
+			working_end = excluded.working_end, time_zone = excluded.time_zone,
+			digest_enabled = excluded.digest_enabled, digest_time_zone = excluded.digest_time_zone`,
+		row)
+	if err != nil {
+		return fmt.Errorf("save user settings: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_default_reminders WHERE user_id = $1`, settings.UserID)
+	if err != nil {
+		return fmt.Errorf("delete default reminders: %w", err)
+	}
+	for _, before := range settings.DefaultReminders {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO user_default_reminders (user_id, before) VALUES ($1, $2)`,
+			settings.UserID, int64(before))
+		if err != nil {
+			return fmt.Errorf("insert default reminder: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE events
+		SET exclusive = kind <> 'out_of_office' AND CASE $2
+			WHEN 'allow' THEN false
+			WHEN 'allow_tentative' THEN NOT tentative
+			ELSE true
+		END
+		WHERE user_id = $1`,
+		settings.UserID, string(settings.ConflictPolicy))
+	if violation := s.dialect.Violation(err); violation != nil {
+		return violation
+	}
+	if err != nil {
+		return fmt.Errorf("update exclusive events: %w", err)
+	}
+	return nil
+}
+
+// ListTags returns the tag vocabulary of the user sorted by name.
+func (s *Storage) ListTags(ctx context.Context, userID string) ([]storage.Tag, error) {
+	return listTags(ctx, s.db, `
+		SELECT user_id, name, color FROM user_tags
+		WHERE user_id = $1
+		ORDER BY name`, userID)
+}
+
+func listTags(ctx context.Context, q Queryer, query string, args ...interface{}) ([]storage.Tag, error) {
+	var rows []tagRow
+	if err := sqlx.SelectContext(ctx, q, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("select tags: %w", err)
+	}
+	tags := make([]storage.Tag, 0, len(rows))
+	for _, row := range rows {
+		tags = append(tags, storage.Tag{UserID: row.UserID, Name: row.Name, Color: row.Color})
+	}
+	return tags, nil
+}
+
+// SaveTag adds the tag to the vocabulary of the user or changes the color of the existing one.
+func (s *Storage) SaveTag(ctx context.Context, tag storage.Tag) error {
+	return saveTag(ctx, s.db, tag)
+}
+
+func saveTag(ctx context.Context, e sqlx.ExtContext, tag storage.Tag) error {
+	_, err := sqlx.NamedExecContext(ctx, e, `
+		INSERT INTO user_tags (user_id, name, color)
+		VALUES (:user_id, :name, :color)
+		ON CONFLICT (user_id, name) DO UPDATE SET color = excluded.color`,
+		tagRow{UserID: tag.UserID, Name: tag.Name, Color: tag.Color})
+	if err != nil {
+		return fmt.Errorf("save tag: %w", err)
+	}
+	return nil
+}
+
+// DeleteTag removes the tag from the vocabulary of the user and from all the events of the user,
+// the trashed ones included.
+func (s *Storage) DeleteTag(ctx context.Context, userID, name string) error {
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM user_tags WHERE user_id = $1 AND name = $2`, userID, name)
+		if err != nil {
+			return fmt.Errorf("delete tag: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("rows affected: %w", err)
+		}
+		if n == 0 {
+			return storage.ErrTagNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM event_tags
+			WHERE tag = $2 AND event_id IN (SELECT id FROM events WHERE user_id = $1)`,
+			userID, name)
+		if err != nil {
+			return fmt.Errorf("delete event tags: %w", err)
+		}
+		return nil
+	})
+}
+
+// Snapshot runs fn with the exporter reading in a single read-only transaction, so a backup sees the database
+// as it was when it started: the events changed meanwhile are neither skipped nor exported twice.
+func (s *Storage) Snapshot(ctx context.Context, fn func(e storage.Exporter) error) error {
+	q, end, err := s.dialect.Snapshot(ctx, s.db)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer end()
+	return fn(exporter{q: q, dialect: s.dialect})
+}
+
+// exporter reads all the data of the storage for backups, within the snapshot transaction.
+type exporter struct {
+	q       Queryer
+	dialect Dialect
+}
+
+// ExportEvents returns up to limit events with IDs after afterID in ID order, either the trashed ones or the others.
+func (e exporter) ExportEvents(ctx context.Context, trashed bool, afterID string, limit int) ([]storage.Event, error) {
+	query := `
+		SELECT id, title, start_at, end_at, description, user_id, kind, category, color, tentative, deleted_at
+		FROM events
+		WHERE (deleted_at IS NOT NULL) = $1`
+	args := []interface{}{trashed, limit}
+	if afterID != "" {
+		query += ` AND id > $3`
+		args = append(args, afterID)
+	}
+	query += ` ORDER BY id LIMIT $2`
+
+	var rows []eventRow
+	if err := sqlx.SelectContext(ctx, e.q, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("select events: %w", err)
+	}
+	return withDetails(ctx, e.q, e.dialect, rows)
+}
+
+// ExportUserSettings returns the settings saved by the users sorted by user.
+func (e exporter) ExportUserSettings(ctx context.Context) ([]storage.UserSettings, error) {
+	return listUserSettings(ctx, e.q, `SELECT user_id FROM user_settings ORDER BY user_id`)
+}
+
+// ExportTags returns the tags of all the users sorted by user and name.
+func (e exporter) ExportTags(ctx context.Context) ([]storage.Tag, error) {
+	return listTags(ctx, e.q, `SELECT user_id, name, color FROM user_tags ORDER BY user_id, name`)
+}
+
+// Import runs fn with the importer writing in a single transaction, which is committed only if fn
+// succeeds, so a failed restore leaves the database as it was.
+func (s *Storage) Import(ctx context.Context, fn func(im storage.Importer) error) error {
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		return fn(importer{s: s, tx: tx})
+	})
+}
+
+// importer writes into the transaction of Import.
+type importer struct {
+	s  *Storage
+	tx *sqlx.Tx
+}
+
+func (im importer) CreateEvent(ctx context.Context, event storage.Event) error {
+	return im.s.createEvent(ctx, im.tx, event)
+}
+
+func (im importer) TrashEvent(ctx context.Context, id string, deletedAt time.Time) error {
+	return im.s.trashEvent(ctx, im.tx, id, deletedAt)
+}
+
+func (im importer) SaveUserSettings(ctx context.Context, settings storage.UserSettings) error {
+	return im.s.saveUserSettings(ctx, im.tx, settings)
+}
+
+func (im importer) SaveTag(ctx context.Context, tag storage.Tag) error {
+	return saveTag(ctx, im.tx, tag)
+}
+
+func (s *Storage) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// withDetails loads the attendees, the reminders and the tags of the events.
+func withDetails(ctx context.Context, q Queryer, dialect Dialect, rows []eventRow) ([]storage.Event, error) {
+	events := make([]storage.Event, 0, len(rows))
+	if len(rows) == 0 {
+		return events, nil
+	}
+
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	query, args, err := sqlx.In(`
+		SELECT event_id, user_id, status
+		FROM event_attendees
+		WHERE event_id IN (?)
+		ORDER BY user_id`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("build attendees query: %w", err)
+	}
+	var attendees []attendeeRow
+	if err := sqlx.SelectContext(ctx, q, &attendees, q.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("select attendees: %w", err)
+	}
+
+	query, args, err = sqlx.In(`
+		SELECT event_id, before
+		FROM event_reminders
+		WHERE event_id IN (?)
+		ORDER BY before DESC`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("build reminders query: %w", err)
+	}
+	var reminders []eventReminderRow
+	if err := sqlx.SelectContext(ctx, q, &reminders, q.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("select reminders: %w", err)
+	}
+
+	query, args, err = sqlx.In(`
+		SELECT event_id, tag
+		FROM event_tags
+		WHERE event_id IN (?)
+		ORDER BY tag`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("build tags query: %w", err)
+	}
+	var tags []eventTagRow
+	if err := sqlx.SelectContext(ctx, q, &tags, q.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("select tags: %w", err)
+	}
+
+	attendeesByEvent := make(map[string][]storage.Attendee, len(rows))
+	for _, a := range attendees {
+		attendeesByEvent[a.EventID] = append(attendeesByEvent[a.EventID], storage.Attendee{
+			UserID: a.UserID,
+			Status: storage.RSVPStatus(a.Status),
+		})
+	}
+	remindersByEvent := make(map[string][]time.Duration, len(rows))
+	for _, r := range reminders {
+		remindersByEvent[r.EventID] = append(remindersByEvent[r.EventID], time.Duration(r.Before))
+	}
+	tagsByEvent := make(map[string][]string, len(rows))
+	for _, t := range tags {
+		tagsByEvent[t.EventID] = append(tagsByEvent[t.EventID], t.Tag)
+	}
+	for _, row := range rows {
+		event, err := row.toEvent(dialect)
+		if err != nil {
+			return nil, err
+		}
+		event.Attendees = attendeesByEvent[row.ID]
+		event.Reminders = remindersByEvent[row.ID]
+		event.Tags = tagsByEvent[row.ID]
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (s *Storage) createEvent(ctx context.Context, tx *sqlx.Tx, event storage.Event) error {
+	row, err := s.exclusiveEventRow(ctx, tx, event)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NamedExecContext(ctx, `
+		INSERT INTO events (id, title, start_at, end_at, description, user_id, kind, category, color, tentative, exclusive)
+		VALUES (:id, :title, :start_at, :end_at, :description, :user_id, :kind, :category, :color, :tentative, :exclusive)`,
+		row)
+	if violation := s.dialect.Violation(err); violation != nil {
+		return violation
+	}
+	if err != nil {
+		return fmt.Errorf("insert event: %w", err)
+	}
+
+	if err := insertAttendees(ctx, tx, event); err != nil {
+		return err
+	}
+	if err := insertReminders(ctx, tx, event); err != nil {
+		return err
+	}
+	return insertTags(ctx, tx, event)
+}
+
+func (s *Storage) updateEvent(ctx context.Context, tx *sqlx.Tx, event storage.Event) error {
+	row, err := s.exclusiveEventRow(ctx, tx, event)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.NamedExecContext(ctx, `
+		UPDATE events
+		SET title = :title, start_at = :start_at, end_at = :end_at, description = :description,
+			user_id = :user_id, kind = :kind, category = :category, color = :color, tentative = :tentative,
+			exclusive = :exclusive
+		WHERE id = :id AND deleted_at IS NULL`,
+		row)
+	if violation := s.dialect.Violation(err); violation != nil {
+		return violation
+	}
+	if err != nil {
+		return fmt.Errorf("update event: %w", err)
+	}
+	if err := checkAffected(res); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM event_attendees WHERE event_id = $1`, event.ID); err != nil {
+		return fmt.Errorf("delete attendees: %w", err)
+	}
+	if err := insertAttendees(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM event_reminders WHERE event_id = $1`, event.ID); err != nil {
+		return fmt.Errorf("delete reminders: %w", err)
+	}
+	if err := insertReminders(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM event_tags WHERE event_id = $1`, event.ID); err != nil {
+		return fmt.Errorf("delete tags: %w", err)
+	}
+	return insertTags(ctx, tx, event)
+}
+
+func (s *Storage) trashEvent(ctx context.Context, e sqlx.ExecerContext, id string, deletedAt time.Time) error {
+	res, err := e.ExecContext(ctx, `
+		UPDATE events SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`, id, s.dialect.EncodeTime(deletedAt))
+	if err != nil {
+		return fmt.Errorf("trash event: %w", err)
+	}
+	return checkAffected(res)
+}
+
+func (s *Storage) applyBatchOp(ctx context.Context, tx *sqlx.Tx, op storage.BatchOp) error {
+	switch op.Kind {
+	case storage.BatchCreate:
+		return s.createEvent(ctx, tx, op.Event)
+	case storage.BatchUpdate:
+		return s.updateEvent(ctx, tx, op.Event)
+	case storage.BatchDelete:
+		return s.trashEvent(ctx, tx, op.Event.ID, op.Event.DeletedAt)
+	default:
+		return fmt.Errorf("unknown batch operation %q", op.Kind)
+	}
+}
+
+// exclusiveEventRow marks the event as exclusive according to the conflict policy of its owner. The settings
+// are read with the dialect's shared lock, so a concurrent change of the policy waits for the event
+// to be written and then recomputes whether it's exclusive along with the other events.
+func (s *Storage) exclusiveEventRow(ctx context.Context, tx *sqlx.Tx, event storage.Event) (eventRow, error) {
+	settings, err := selectUserSettings(ctx, tx, event.UserID, s.dialect.LockShared())
+	if err != nil {
+		return eventRow{}, err
+	}
+	row := toEventRow(s.dialect, event)
+	row.Exclusive = settings.ConflictPolicy.Exclusive(event)
+	return row, nil
+}
+
+func getUserSettings(ctx context.Context, q sqlx.QueryerContext, userID string) (storage.UserSettings, error) {
+	return selectUserSettings(ctx, q, userID, "")
+}
+
+// selectUserSettings reads the settings row with the locking clause appended to the query.
+func selectUserSettings(
+	ctx context.Context, q sqlx.QueryerContext, userID, lock string,
+) (storage.UserSettings, error) {
+	var row userSettingsRow
+	err := sqlx.GetContext(ctx, q, &row, `
+		SELECT user_id, conflict_policy, working_days, working_start, working_end, time_zone,
+			digest_enabled, digest_time_zone
+		FROM user_settings
+		WHERE user_id = $1`+lock, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.DefaultUserSettings(userID), nil
+	}
+	if err != nil {
+		return storage.UserSettings{}, fmt.Errorf("select user settings: %w", err)
+	}
+
+	var reminders []int64
+	err = sqlx.SelectContext(ctx, q, &reminders, `
+		SELECT before FROM user_default_reminders WHERE user_id = $1 ORDER BY before DESC`, userID)
+	if err != nil {
+		return storage.UserSettings{}, fmt.Errorf("select default reminders: %w", err)
+	}
+
+	settings := row.toUserSettings()
+	for _, before := range reminders {
+		settings.DefaultReminders = append(settings.DefaultReminders, time.Duration(before))
+	}
+	return settings, nil
+}
+
+func insertAttendees(ctx context.Context, tx *sqlx.Tx, event storage.Event) error {
+	for _, a := range event.Attendees {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO event_attendees (event_id, user_id, status) VALUES ($1, $2, $3)`,
+			event.ID, a.UserID, string(a.Status))
+		if err != nil {
+			return fmt.Errorf("insert attendee: %w", err)
+		}
+	}
+	return nil
+}
+
+func insertReminders(ctx context.Context, tx *sqlx.Tx, event storage.Event) error {
+	for _, before := range event.Reminders {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO event_reminders (event_id, before) VALUES ($1, $2)`,
+			event.ID, int64(before))
+		if err != nil {
+			return fmt.Errorf("insert reminder: %w", err)
+		}
+	}
+	return nil
+}
+
+func insertTags(ctx context.Context, tx *sqlx.Tx, event storage.Event) error {
+	for _, tag := range event.Tags {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO event_tags (event_id, tag) VALUES ($1, $2)`,
+			event.ID, tag)
+		if err != nil {
+			return fmt.Errorf("insert tag: %w", err)
+		}
+	}
+	return nil
+}
+
+func checkAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if n == 0 {
+		return storage.ErrEventNotFound
+	}
+	return nil
+}
+
+func toEventRow(dialect Dialect, event storage.Event) eventRow {
+	return eventRow{
+		ID:          event.ID,
+		Title:       event.Title,
+		StartAt:     dialect.EncodeTime(event.StartAt),
+		EndAt:       dialect.EncodeTime(event.EndAt),
+		Description: event.Description,
+		UserID:      event.UserID,
+		Kind:        string(event.Kind),
+		Category:    event.Category,
+		Color:       event.Color,
+		Tentative:   event.Tentative,
+	}
+}
+
+func (r eventRow) toEvent(dialect Dialect) (storage.Event, error) {
+	event := storage.Event{
+		ID:          r.ID,
+		Title:       r.Title,
+		Description: r.Description,
+		UserID:      r.UserID,
+		Kind:        storage.EventKind(r.Kind),
+		Category:    r.Category,
+		Color:       r.Color,
+		Tentative:   r.Tentative,
+	}
+	var err error
+	if event.StartAt, err = dialect.DecodeTime(r.StartAt); err != nil {
+		return storage.Event{}, err
+	}
+	if event.EndAt, err = dialect.DecodeTime(r.EndAt); err != nil {
+		return storage.Event{}, err
+	}
+	if event.DeletedAt, err = dialect.DecodeTime(r.DeletedAt); err != nil {
+		return storage.Event{}, err
+	}
+	return event, nil
+}
+
+func (r shareRow) toShare() storage.Share {
+	return storage.Share{OwnerID: r.OwnerID, UserID: r.UserID, Level: storage.AccessLevel(r.Level)}
+}
+
+func toUserSettingsRow(settings storage.UserSettings) userSettingsRow {
+	row := userSettingsRow{
+		UserID:         settings.UserID,
+		ConflictPolicy: string(settings.ConflictPolicy),
+		WorkingStart:   int64(settings.WorkingHours.Start),
+		WorkingEnd:     int64(settings.WorkingHours.End),
+		TimeZone:       settings.WorkingHours.TimeZone,
+		DigestEnabled:  settings.Digest.Enabled,
+		DigestTimeZone: settings.Digest.TimeZone,
+	}
+	for _, day := range settings.WorkingHours.Days {
+		row.WorkingDays |= 1 << day
+	}
+	return row
+}
+
+func (r userSettingsRow) toUserSettings() storage.UserSettings {
+	settings := storage.UserSettings{
+		UserID:         r.UserID,
+		ConflictPolicy: storage.ConflictPolicy(r.ConflictPolicy),
+		WorkingHours: storage.WorkingHours{
+			Start:    time.Duration(r.WorkingStart),
+			End:      time.Duration(r.WorkingEnd),
+			TimeZone: r.TimeZone,
+		},
+		Digest: storage.DigestSettings{Enabled: r.DigestEnabled, TimeZone: r.DigestTimeZone},
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if r.WorkingDays&(1<<day) != 0 {
+			settings.WorkingHours.Days = append(settings.WorkingHours.Days, day)
+		}
+	}
+	return settings
+}
@@ -0,0 +1,96 @@
+package sqlstorage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/storagetest"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/migrations"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests need a Postgres database with the btree_gist extension available, "make test-postgres" starts
+// the one of deployments/docker-compose.yaml and runs them. Its DSN is set in CALENDAR_TEST_POSTGRES_DSN,
+// without it the tests are skipped, or fail if CALENDAR_TEST_POSTGRES_REQUIRED is set as in CI.
+// Every test gets a schema of its own, dropped when it ends.
+const (
+	dsnEnv      = "CALENDAR_TEST_POSTGRES_DSN"
+	requiredEnv = "CALENDAR_TEST_POSTGRES_REQUIRED"
+)
+
+func TestStorage(t *testing.T) {
+	dsn := testDSN(t)
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		return newTestStorage(t, dsn)
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	s := newTestStorage(t, testDSN(t))
+	storagetest.RunSnapshot(t, s, s)
+}
+
+func testDSN(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		if os.Getenv(requiredEnv) != "" {
+			t.Fatal(dsnEnv + " is not set")
+		}
+		t.Skip(dsnEnv + " is not set")
+	}
+	return dsn
+}
+
+func newTestStorage(t *testing.T, dsn string) *Storage {
+	t.Helper()
+	ctx := context.Background()
+
+	admin, err := sqlx.ConnectContext(ctx, "pgx", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+	_, err = admin.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS btree_gist`)
+	require.NoError(t, err)
+	schema := fmt.Sprintf("storagetest_%d", time.Now().UnixNano())
+	_, err = admin.ExecContext(ctx, `CREATE SCHEMA `+schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := admin.ExecContext(context.Background(), `DROP SCHEMA `+schema+` CASCADE`)
+		require.NoError(t, err)
+	})
+
+	// The extension stays in public, so it is in the search path too.
+	s := New(withSearchPath(dsn, schema+",public"))
+	require.NoError(t, s.Connect(ctx))
+	t.Cleanup(func() { s.Close(context.Background()) })
+	migrate(t, s.db)
+	return s
+}
+
+// withSearchPath adds the search_path parameter to the DSN either in the URL or in the key=value form.
+func withSearchPath(dsn, path string) string {
+	switch {
+	case !strings.Contains(dsn, "://"):
+		return dsn + " search_path=" + path
+	case strings.Contains(dsn, "?"):
+		return dsn + "&search_path=" + path
+	default:
+		return dsn + "?search_path=" + path
+	}
+}
+
+// migrate applies the Up sections of the migrations the way goose does.
+func migrate(t *testing.T, db *sqlx.DB) {
+	t.Helper()
+	list, err := migrations.Postgres()
+	require.NoError(t, err)
+	for _, m := range list {
+		_, err = db.Exec(m.Up())
+		require.NoError(t, err, m.Name)
+	}
+}
@@ -0,0 +1,61 @@
+package sqlitestorage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/migrations"
+	"github.com/jmoiron/sqlx"
+)
+
+// migrate applies the Up sections of the migrations newer than the database. The versions are recorded
+// in the goose_db_version table the way goose does, so the goose command works on the same file
+// given the shared and the SQLite migrations.
+func migrate(ctx context.Context, db *sqlx.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS goose_db_version (
+			id         integer PRIMARY KEY AUTOINCREMENT,
+			version_id integer NOT NULL,
+			is_applied integer NOT NULL,
+			tstamp     timestamp DEFAULT (datetime('now'))
+		)`)
+	if err != nil {
+		return fmt.Errorf("create version table: %w", err)
+	}
+	var current int64
+	err = db.GetContext(ctx, &current, `
+		SELECT coalesce(max(version_id), 0) FROM goose_db_version WHERE is_applied`)
+	if err != nil {
+		return fmt.Errorf("select schema version: %w", err)
+	}
+
+	list, err := migrations.SQLite()
+	if err != nil {
+		return fmt.Errorf("list migrations: %w", err)
+	}
+	for _, m := range list {
+		if m.Version <= current {
+			continue
+		}
+		if err := applyMigration(ctx, db, m.Version, m.Up()); err != nil {
+			return fmt.Errorf("apply migration %s: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sqlx.DB, version int64, up string) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if _, err := tx.ExecContext(ctx, up); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, true)`, version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,110 @@
+package sqlitestorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	sqlstorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/sql"
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// connOptions enforce the foreign keys, which SQLite ignores by default, and let the scheduler process
+// use the same database file: WAL lets it read while the calendar writes, and transactions take
+// the write lock up front, so they wait for each other instead of failing with SQLITE_BUSY.
+const connOptions = "_pragma=foreign_keys(1)&_pragma=journal_mode(wal)&_pragma=busy_timeout(5000)&_txlock=immediate"
+
+// New creates the storage of the database file at the path given by dsn, ":memory:" keeps it in memory.
+// It keeps the calendar in a single SQLite file, for the installs that don't need a database server.
+func New(dsn string) *sqlstorage.Storage {
+	return sqlstorage.NewWithDialect(dsn, dialect{})
+}
+
+// dialect stores times as Unix nanoseconds and keeps the exclusive events from overlapping with
+// the events_no_overlap triggers, SQLite has no exclusion constraints. A policy change only ever makes events
+// exclusive or only ever makes them not, so the triggers, which check one row at a time, fail exactly when
+// the events conflict under the new policy.
+type dialect struct{}
+
+// Connect opens the database and applies the migrations it misses.
+func (dialect) Connect(ctx context.Context, dsn string) (*sqlx.DB, error) {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	db, err := sqlx.ConnectContext(ctx, "sqlite", dsn+sep+connOptions)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer anyway, one connection also keeps a ":memory:" database shared.
+	db.SetMaxOpenConns(1)
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Snapshot begins a deferred transaction rather than an immediate one, as the others are, so that with WAL
+// the backup doesn't hold the write lock and the calendar keeps writing meanwhile.
+func (dialect) Snapshot(ctx context.Context, db *sqlx.DB) (sqlstorage.Queryer, func(), error) {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get connection: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `BEGIN DEFERRED`); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, func() {
+		_, _ = conn.ExecContext(context.Background(), `ROLLBACK`) // Nothing was written.
+		conn.Close()
+	}, nil
+}
+
+func (dialect) EncodeTime(t time.Time) interface{} {
+	return t.UnixNano()
+}
+
+func (dialect) DecodeTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case int64:
+		return time.Unix(0, v).UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("decode time: unexpected %T", v)
+	}
+}
+
+// LockShared is empty, SQLite has no row locks. Its transactions are immediate, so the writes take
+// the database lock up front and run one at a time anyway.
+func (dialect) LockShared() string {
+	return ""
+}
+
+func (dialect) ReminderAt() string {
+	return `e.start_at - r.before`
+}
+
+// Violation tells the constraints apart by the extended result code,
+// the events_no_overlap triggers fail with SQLITE_CONSTRAINT_TRIGGER.
+func (dialect) Violation(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return storage.ErrEventExists
+	case sqlite3.SQLITE_CONSTRAINT_TRIGGER:
+		return storage.ErrDateBusy
+	default:
+		return nil
+	}
+}
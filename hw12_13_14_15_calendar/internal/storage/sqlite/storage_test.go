@@ -0,0 +1,100 @@
+package sqlitestorage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	sqlstorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/sql"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/storagetest"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+var day = time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+func newStorage(t *testing.T, dsn string) *sqlstorage.Storage {
+	t.Helper()
+	s := New(dsn)
+	require.NoError(t, s.Connect(context.Background()))
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s
+}
+
+// openDB opens the database file of the storage to look into it.
+func openDB(t *testing.T, dsn string) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Open("sqlite", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newEvent(start time.Time) storage.Event {
+	return storage.Event{
+		ID:        "00000000-0000-0000-0000-000000000001",
+		Title:     "meeting",
+		StartAt:   start,
+		EndAt:     start.Add(time.Hour),
+		UserID:    "alice",
+		Attendees: []storage.Attendee{{UserID: "bob", Status: storage.RSVPPending}},
+		Reminders: []time.Duration{time.Hour},
+		Tags:      []string{"team"},
+	}
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		return newStorage(t, ":memory:")
+	})
+}
+
+// TestSnapshot backs up the file the calendar keeps writing to. The snapshot doesn't hold the write lock,
+// so the writes don't wait for it.
+func TestSnapshot(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "calendar.db")
+	storagetest.RunSnapshot(t, newStorage(t, dsn), newStorage(t, dsn))
+}
+
+func TestStorageForeignKeys(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "calendar.db")
+	s := newStorage(t, dsn)
+
+	event := newEvent(day.Add(10 * time.Hour))
+	require.NoError(t, s.CreateEvent(ctx, event))
+	require.NoError(t, s.TrashEvent(ctx, event.ID, day))
+
+	// Purging the trash deletes the attendees, the reminders and the tags along with the event.
+	n, err := s.PurgeTrash(ctx, day.Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	var left int
+	require.NoError(t, openDB(t, dsn).GetContext(ctx, &left, `
+		SELECT (SELECT count(*) FROM event_attendees) + (SELECT count(*) FROM event_reminders)
+			+ (SELECT count(*) FROM event_tags)`))
+	require.Zero(t, left)
+}
+
+func TestStorageMigrations(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "calendar.db")
+
+	s := newStorage(t, dsn)
+	event := newEvent(day.Add(10 * time.Hour))
+	require.NoError(t, s.CreateEvent(ctx, event))
+	require.NoError(t, s.Close(ctx))
+
+	// Reopening the file keeps the data and doesn't apply the migrations again.
+	s = newStorage(t, dsn)
+	_, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	var versions []int64
+	require.NoError(t, openDB(t, dsn).SelectContext(ctx, &versions, `SELECT version_id FROM goose_db_version ORDER BY id`))
+	require.Equal(t, []int64{
+		20220601120000, 20220602120000, 20220610120000, 20220615120000, 20220620120000, 20220625120000,
+		20220630120000, 20220705120000, 20220710120000, 20220715120000, 20220720120000,
+	}, versions)
+}
@@ -0,0 +1,845 @@
+// Package storagetest holds the behavior every storage backend must have. The tests of each backend run it
+// against the backend, so the backends can't drift apart unnoticed.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// Storage is what the app and the scheduler need from a backend.
+type Storage interface {
+	CreateEvent(ctx context.Context, event storage.Event) error
+	UpdateEvent(ctx context.Context, event storage.Event) error
+	TrashEvent(ctx context.Context, id string, deletedAt time.Time) error
+	RestoreEvent(ctx context.Context, id string) error
+	ListTrash(ctx context.Context, userID string) ([]storage.Event, error)
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+	DeleteOldEvents(ctx context.Context, before time.Time) (int64, error)
+	ListRemindersDue(ctx context.Context, from, to time.Time) ([]storage.Reminder, error)
+	GetEvent(ctx context.Context, id string) (storage.Event, error)
+	ListEvents(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error)
+	SetAttendeeStatus(ctx context.Context, eventID, userID string, status storage.RSVPStatus) error
+	GetIdempotencyKey(ctx context.Context, userID, key string) (storage.IdempotencyKey, error)
+	ReserveIdempotencyKey(ctx context.Context, key storage.IdempotencyKey, now time.Time) error
+	DeleteIdempotencyKey(ctx context.Context, key storage.IdempotencyKey) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) error
+	AddAuditRecord(ctx context.Context, record storage.AuditRecord) error
+	ListAuditRecords(ctx context.Context, eventID string) ([]storage.AuditRecord, error)
+	SaveShare(ctx context.Context, share storage.Share) error
+	DeleteShare(ctx context.Context, ownerID, userID string) error
+	GetShare(ctx context.Context, ownerID, userID string) (storage.Share, error)
+	ListShares(ctx context.Context, ownerID string) ([]storage.Share, error)
+	ListSharedWith(ctx context.Context, userID string) ([]storage.Share, error)
+	GetUserSettings(ctx context.Context, userID string) (storage.UserSettings, error)
+	SaveUserSettings(ctx context.Context, settings storage.UserSettings) error
+	ListDigestSettings(ctx context.Context) ([]storage.UserSettings, error)
+	ListTags(ctx context.Context, userID string) ([]storage.Tag, error)
+	SaveTag(ctx context.Context, tag storage.Tag) error
+	DeleteTag(ctx context.Context, userID, name string) error
+	Snapshot(ctx context.Context, fn func(e storage.Exporter) error) error
+	Import(ctx context.Context, fn func(im storage.Importer) error) error
+	ApplyBatch(ctx context.Context, ops []storage.BatchOp, mode storage.BatchMode) ([]error, error)
+}
+
+// Run runs every test against an empty storage made by newStorage.
+func Run(t *testing.T, newStorage func(t *testing.T) Storage) {
+	t.Helper()
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newStorage(t))
+		})
+	}
+}
+
+// RunSnapshot checks that the snapshot of reader doesn't see the changes made through writer meanwhile.
+// They are either the same storage or two of them on the same database, e.g. the backup command
+// and a running calendar.
+func RunSnapshot(t *testing.T, reader, writer Storage) {
+	t.Helper()
+	ctx := context.Background()
+	for n := 1; n <= 3; n++ {
+		require.NoError(t, writer.CreateEvent(ctx, newEvent(n, "alice", day.Add(time.Duration(n)*time.Hour))))
+	}
+
+	require.NoError(t, reader.Snapshot(ctx, func(e storage.Exporter) error {
+		events, err := e.ExportEvents(ctx, false, "", 1)
+		require.NoError(t, err)
+		require.Equal(t, []string{eventID(1)}, ids(events))
+
+		// The event on the next page moves to the trash, it is neither skipped nor exported twice.
+		require.NoError(t, writer.TrashEvent(ctx, eventID(2), day))
+		require.NoError(t, writer.CreateEvent(ctx, newEvent(4, "alice", day.Add(4*time.Hour))))
+		require.NoError(t, writer.SaveTag(ctx, storage.Tag{UserID: "alice", Name: "team"}))
+
+		events, err = e.ExportEvents(ctx, false, eventID(1), 10)
+		require.NoError(t, err)
+		require.Equal(t, []string{eventID(2), eventID(3)}, ids(events))
+		events, err = e.ExportEvents(ctx, true, "", 10)
+		require.NoError(t, err)
+		require.Empty(t, events)
+		tags, err := e.ExportTags(ctx)
+		require.NoError(t, err)
+		require.Empty(t, tags)
+		return nil
+	}))
+
+	inSnapshot(t, reader, func(e storage.Exporter) {
+		events, err := e.ExportEvents(ctx, true, "", 10)
+		require.NoError(t, err)
+		require.Equal(t, []string{eventID(2)}, ids(events))
+		events, err = e.ExportEvents(ctx, false, "", 10)
+		require.NoError(t, err)
+		require.Equal(t, []string{eventID(1), eventID(3), eventID(4)}, ids(events))
+	})
+}
+
+var tests = []struct {
+	name string
+	test func(t *testing.T, s Storage)
+}{
+	{"crud", testCRUD},
+	{"trash", testTrash},
+	{"old events", testOldEvents},
+	{"reminders due", testRemindersDue},
+	{"date busy", testDateBusy},
+	{"list boundaries", testListBoundaries},
+	{"list includes invitations", testListInvitations},
+	{"attendee status", testAttendeeStatus},
+	{"returned events are copies", testCopies},
+	{"idempotency keys", testIdempotencyKeys},
+	{"audit records", testAuditRecords},
+	{"shares", testShares},
+	{"conflict policy", testConflictPolicy},
+	{"out of office", testOutOfOffice},
+	{"user settings", testUserSettings},
+	{"apply batch", testApplyBatch},
+	{"export", testExport},
+	{"import", testImport},
+	{"tags", testTags},
+	{"concurrent writes", testConcurrentWrites},
+}
+
+// day is Wednesday, its week starts on May 30.
+var day = time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+// eventID makes the n-th event ID, a UUID as the SQL storages require.
+func eventID(n int) string {
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", n)
+}
+
+func newEvent(n int, userID string, start time.Time, attendees ...storage.Attendee) storage.Event {
+	return storage.Event{
+		ID:        eventID(n),
+		Title:     fmt.Sprintf("event %d", n),
+		StartAt:   start,
+		EndAt:     start.Add(time.Hour),
+		UserID:    userID,
+		Attendees: attendees,
+	}
+}
+
+// inUTC brings the times of the event to UTC, the backends may return them in another location.
+func inUTC(event storage.Event) storage.Event {
+	event.StartAt = event.StartAt.UTC()
+	event.EndAt = event.EndAt.UTC()
+	event.DeletedAt = event.DeletedAt.UTC()
+	return event
+}
+
+func ids(events []storage.Event) []string {
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func listIDs(t *testing.T, s Storage, userID string, from, to time.Time) []string {
+	t.Helper()
+	events, err := s.ListEvents(context.Background(), userID, from, to)
+	require.NoError(t, err)
+	return ids(events)
+}
+
+func testCRUD(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	event := newEvent(1, "alice", day.Add(10*time.Hour), storage.Attendee{UserID: "bob", Status: storage.RSVPPending})
+	event.Description = "weekly"
+	event.Reminders = []time.Duration{time.Hour, 10 * time.Minute}
+	event.Category = "work"
+	event.Color = "#336699"
+	event.Tags = []string{"planning", "team"}
+	require.NoError(t, s.CreateEvent(ctx, event))
+	require.ErrorIs(t, s.CreateEvent(ctx, event), storage.ErrEventExists)
+
+	got, err := s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, event, inUTC(got))
+
+	event.Title = "updated"
+	event.Attendees = nil
+	event.Reminders = []time.Duration{24 * time.Hour}
+	event.Color = ""
+	event.Tags = []string{"team"}
+	require.NoError(t, s.UpdateEvent(ctx, event))
+	got, err = s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, event, inUTC(got))
+
+	require.NoError(t, s.TrashEvent(ctx, event.ID, day))
+	got, err = s.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, day, got.DeletedAt.UTC())
+	require.ErrorIs(t, s.TrashEvent(ctx, event.ID, day), storage.ErrEventNotFound)
+	require.ErrorIs(t, s.UpdateEvent(ctx, event), storage.ErrEventNotFound)
+	require.ErrorIs(t, s.TrashEvent(ctx, eventID(2), day), storage.ErrEventNotFound)
+	_, err = s.GetEvent(ctx, eventID(2))
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+}
+
+func testTrash(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateEvent(ctx, newEvent(1, "alice", day.Add(10*time.Hour),
+		storage.Attendee{UserID: "bob", Status: storage.RSVPPending})))
+	require.NoError(t, s.CreateEvent(ctx, newEvent(2, "alice", day.Add(12*time.Hour))))
+	require.NoError(t, s.TrashEvent(ctx, eventID(1), day))
+	require.NoError(t, s.TrashEvent(ctx, eventID(2), day.Add(time.Hour)))
+
+	trash, err := s.ListTrash(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []string{eventID(2), eventID(1)}, ids(trash))
+
+	// Trashed events are hidden from lists and do not take the time.
+	require.Empty(t, listIDs(t, s, "alice", day, day.AddDate(0, 0, 1)))
+	require.Empty(t, listIDs(t, s, "bob", day, day.AddDate(0, 0, 1)))
+	require.ErrorIs(t, s.SetAttendeeStatus(ctx, eventID(1), "bob", storage.RSVPAccepted), storage.ErrEventNotFound)
+	require.NoError(t, s.CreateEvent(ctx, newEvent(3, "alice", day.Add(10*time.Hour))))
+
+	require.ErrorIs(t, s.RestoreEvent(ctx, eventID(1)), storage.ErrDateBusy)
+	require.NoError(t, s.RestoreEvent(ctx, eventID(2)))
+	require.ErrorIs(t, s.RestoreEvent(ctx, eventID(2)), storage.ErrEventNotFound)
+	require.Len(t, listIDs(t, s, "alice", day, day.AddDate(0, 0, 1)), 2)
+
+	purged, err := s.PurgeTrash(ctx, day.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), purged)
+	_, err = s.GetEvent(ctx, eventID(1))
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+}
+
+func testOldEvents(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateEvent(ctx, newEvent(1, "alice", day.AddDate(-1, 0, -1))))
+	require.NoError(t, s.CreateEvent(ctx, newEvent(2, "alice", day)))
+
+	deleted, err := s.DeleteOldEvents(ctx, day.AddDate(-1, 0, 0))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+	_, err = s.GetEvent(ctx, eventID(2))
+	require.NoError(t, err)
+}
+
+func testRemindersDue(t *testing.T, s Storage) {
+	ctx := context.Background()
+	remind := func(e storage.Event, reminders ...time.Duration) storage.Event {
+		e.Reminders = reminders
+		return e
+	}
+
+	require.NoError(t, s.CreateEvent(ctx,
+		remind(newEvent(1, "alice", day.Add(10*time.Hour)), 24*time.Hour, time.Hour, 10*time.Minute)))
+	require.NoError(t, s.CreateEvent(ctx, remind(newEvent(2, "bob", day.Add(10*time.Hour)), 2*time.Hour)))
+	require.NoError(t, s.CreateEvent(ctx, newEvent(3, "carol", day.Add(9*time.Hour))))
+	require.NoError(t, s.CreateEvent(ctx, remind(newEvent(4, "dave", day.Add(10*time.Hour)), time.Hour)))
+	require.NoError(t, s.TrashEvent(ctx, eventID(4), day))
+
+	reminders, err := s.ListRemindersDue(ctx, day.Add(9*time.Hour), day.Add(9*time.Hour+time.Minute))
+	require.NoError(t, err)
+	require.Len(t, reminders, 1)
+	require.Equal(t, eventID(1), reminders[0].Event.ID)
+	require.Equal(t, time.Hour, reminders[0].Before)
+
+	// Every reminder of the event is due on its own, the period is half-open.
+	reminders, err = s.ListRemindersDue(ctx, day.Add(-24*time.Hour), day.Add(9*time.Hour+50*time.Minute))
+	require.NoError(t, err)
+	befores := make([]time.Duration, 0, len(reminders))
+	for _, r := range reminders {
+		befores = append(befores, r.Before)
+	}
+	require.Equal(t, []time.Duration{24 * time.Hour, 2 * time.Hour, time.Hour}, befores)
+}
+
+func testDateBusy(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateEvent(ctx, newEvent(1, "alice", day.Add(10*time.Hour))))
+	require.ErrorIs(t, s.CreateEvent(ctx, newEvent(2, "alice", day.Add(10*time.Hour+30*time.Minute))),
+		storage.ErrDateBusy)
+	require.ErrorIs(t, s.CreateEvent(ctx, newEvent(2, "alice", day.Add(9*time.Hour+30*time.Minute))),
+		storage.ErrDateBusy)
+
+	// Adjacent events and events of other users do not conflict.
+	require.NoError(t, s.CreateEvent(ctx, newEvent(3, "alice", day.Add(11*time.Hour))))
+	require.NoError(t, s.CreateEvent(ctx, newEvent(4, "alice", day.Add(9*time.Hour))))
+	require.NoError(t, s.CreateEvent(ctx, newEvent(5, "bob", day.Add(10*time.Hour))))
+
+	require.ErrorIs(t, s.UpdateEvent(ctx, newEvent(3, "alice", day.Add(10*time.Hour+30*time.Minute))),
+		storage.ErrDateBusy)
+	got, err := s.GetEvent(ctx, eventID(3))
+	require.NoError(t, err)
+	require.Equal(t, day.Add(11*time.Hour), got.StartAt.UTC())
+
+	// The event doesn't conflict with itself when moved within its own time.
+	require.NoError(t, s.UpdateEvent(ctx, newEvent(3, "alice", day.Add(11*time.Hour+30*time.Minute))))
+}
+
+// testListBoundaries checks that lists take the events overlapping the half-open period [from, to),
+// so an event touching a midnight belongs only to the day it is in, and one spanning it to both.
+func testListBoundaries(t *testing.T, s Storage) {
+	ctx := context.Background()
+	create := func(n int, userID string, start, end time.Time) {
+		event := newEvent(n, userID, start)
+		event.EndAt = end
+		require.NoError(t, s.CreateEvent(ctx, event))
+	}
+	nextDay := day.AddDate(0, 0, 1)
+
+	create(1, "alice", day.Add(-time.Hour), day)
+	create(2, "alice", day, day.Add(time.Hour))
+	create(3, "alice", nextDay.Add(-time.Hour), nextDay)
+	create(4, "alice", nextDay, nextDay.Add(time.Hour))
+	require.Equal(t, []string{eventID(2), eventID(3)}, listIDs(t, s, "alice", day, nextDay))
+
+	create(5, "bob", nextDay.Add(-30*time.Minute), nextDay.Add(30*time.Minute))
+	require.Equal(t, []string{eventID(5)}, listIDs(t, s, "bob", day, nextDay))
+	require.Equal(t, []string{eventID(5)}, listIDs(t, s, "bob", nextDay, nextDay.AddDate(0, 0, 1)))
+
+	// The week of the day runs from Monday, May 30 to Monday, June 6.
+	weekStart, weekEnd := day.AddDate(0, 0, -2), day.AddDate(0, 0, 5)
+	create(6, "carol", weekStart.Add(-time.Hour), weekStart)
+	create(7, "carol", weekEnd.Add(-time.Hour), weekEnd)
+	create(8, "carol", weekEnd, weekEnd.Add(time.Hour))
+	require.Equal(t, []string{eventID(7)}, listIDs(t, s, "carol", weekStart, weekEnd))
+
+	monthEnd := day.AddDate(0, 1, 0)
+	create(9, "dave", day.Add(-30*time.Minute), day.Add(30*time.Minute))
+	create(10, "dave", monthEnd.Add(-time.Hour), monthEnd)
+	create(11, "dave", monthEnd, monthEnd.Add(time.Hour))
+	require.Equal(t, []string{eventID(9), eventID(10)}, listIDs(t, s, "dave", day, monthEnd))
+	require.Equal(t, []string{eventID(9)}, listIDs(t, s, "dave", day.AddDate(0, -1, 0), day))
+
+	// The period may come in any location, it is the instant that counts.
+	moscow := time.FixedZone("MSK", 3*60*60)
+	require.Equal(t, []string{eventID(2), eventID(3)}, listIDs(t, s, "alice", day.In(moscow), nextDay.In(moscow)))
+}
+
+func testListInvitations(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateEvent(ctx, newEvent(1, "alice", day.Add(12*time.Hour))))
+	require.NoError(t, s.CreateEvent(ctx, newEvent(2, "bob", day.Add(9*time.Hour),
+		storage.Attendee{UserID: "alice", Status: storage.RSVPPending})))
+	require.NoError(t, s.CreateEvent(ctx, newEvent(3, "bob", day.Add(14*time.Hour))))
+	require.NoError(t, s.CreateEvent(ctx, newEvent(4, "alice", day.AddDate(0, 0, 1))))
+
+	require.Equal(t, []string{eventID(2), eventID(1)}, listIDs(t, s, "alice", day, day.AddDate(0, 0, 1)))
+}
+
+func testAttendeeStatus(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateEvent(ctx, newEvent(1, "bob", day,
+		storage.Attendee{UserID: "carol", Status: storage.RSVPPending},
+		storage.Attendee{UserID: "alice", Status: storage.RSVPPending})))
+
+	require.NoError(t, s.SetAttendeeStatus(ctx, eventID(1), "alice", storage.RSVPAccepted))
+	require.ErrorIs(t, s.SetAttendeeStatus(ctx, eventID(1), "dave", storage.RSVPAccepted), storage.ErrNotAttendee)
+	require.ErrorIs(t, s.SetAttendeeStatus(ctx, eventID(2), "alice", storage.RSVPAccepted), storage.ErrEventNotFound)
+
+	// Attendees come sorted by user.
+	event, err := s.GetEvent(ctx, eventID(1))
+	require.NoError(t, err)
+	require.Equal(t, []storage.Attendee{
+		{UserID: "alice", Status: storage.RSVPAccepted},
+		{UserID: "carol", Status: storage.RSVPPending},
+	}, event.Attendees)
+}
+
+func testCopies(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	event := newEvent(1, "bob", day, storage.Attendee{UserID: "alice", Status: storage.RSVPPending})
+	event.Reminders = []time.Duration{time.Hour}
+	require.NoError(t, s.CreateEvent(ctx, event))
+	event.Attendees[0].Status = storage.RSVPDeclined
+
+	got, err := s.GetEvent(ctx, eventID(1))
+	require.NoError(t, err)
+	require.Equal(t, storage.RSVPPending, got.Attendees[0].Status)
+	got.Attendees[0].Status = storage.RSVPDeclined
+	got.Reminders[0] = time.Minute
+
+	got, err = s.GetEvent(ctx, eventID(1))
+	require.NoError(t, err)
+	require.Equal(t, storage.RSVPPending, got.Attendees[0].Status)
+	require.Equal(t, []time.Duration{time.Hour}, got.Reminders)
+}
+
+func testIdempotencyKeys(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	_, err := s.GetIdempotencyKey(ctx, "alice", "key")
+	require.ErrorIs(t, err, storage.ErrIdempotencyKeyNotFound)
+
+	key := storage.IdempotencyKey{UserID: "alice", Key: "key", EventID: eventID(1), ExpiresAt: day.Add(time.Hour)}
+	require.NoError(t, s.ReserveIdempotencyKey(ctx, key, day))
+	require.NoError(t, s.ReserveIdempotencyKey(ctx, storage.IdempotencyKey{
+		UserID: "bob", Key: "key", EventID: eventID(2), ExpiresAt: day.Add(2 * time.Hour),
+	}, day))
+
+	// A live key can't be reserved again, an expired one is replaced.
+	retry := storage.IdempotencyKey{UserID: "alice", Key: "key", EventID: eventID(3), ExpiresAt: day.Add(2 * time.Hour)}
+	require.ErrorIs(t, s.ReserveIdempotencyKey(ctx, retry, day), storage.ErrIdempotencyKeyExists)
+
+	got, err := s.GetIdempotencyKey(ctx, "alice", "key")
+	require.NoError(t, err)
+	got.ExpiresAt = got.ExpiresAt.UTC()
+	require.Equal(t, key, got)
+
+	require.NoError(t, s.ReserveIdempotencyKey(ctx, retry, day.Add(time.Hour)))
+	got, err = s.GetIdempotencyKey(ctx, "alice", "key")
+	require.NoError(t, err)
+	require.Equal(t, eventID(3), got.EventID)
+
+	// A key is deleted only while it's reserved for the same event.
+	require.NoError(t, s.DeleteIdempotencyKey(ctx, key))
+	_, err = s.GetIdempotencyKey(ctx, "alice", "key")
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteIdempotencyKey(ctx, retry))
+	_, err = s.GetIdempotencyKey(ctx, "alice", "key")
+	require.ErrorIs(t, err, storage.ErrIdempotencyKeyNotFound)
+
+	require.NoError(t, s.DeleteExpiredIdempotencyKeys(ctx, day.Add(2*time.Hour)))
+	_, err = s.GetIdempotencyKey(ctx, "bob", "key")
+	require.ErrorIs(t, err, storage.ErrIdempotencyKeyNotFound)
+}
+
+func testAuditRecords(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	records, err := s.ListAuditRecords(ctx, eventID(1))
+	require.NoError(t, err)
+	require.Empty(t, records)
+
+	created := storage.AuditRecord{
+		EventID: eventID(1), Action: storage.AuditCreate, ActorID: "alice", At: day,
+		Changes: []storage.FieldChange{{Field: "title", New: "meeting"}},
+	}
+	updated := storage.AuditRecord{
+		EventID: eventID(1), Action: storage.AuditUpdate, ActorID: "alice", At: day.Add(time.Hour),
+		Changes: []storage.FieldChange{{Field: "title", Old: "meeting", New: "retro"}},
+	}
+	require.NoError(t, s.AddAuditRecord(ctx, created))
+	require.NoError(t, s.AddAuditRecord(ctx, storage.AuditRecord{
+		EventID: eventID(2), Action: storage.AuditCreate, ActorID: "bob", At: day,
+	}))
+	require.NoError(t, s.AddAuditRecord(ctx, updated))
+
+	records, err = s.ListAuditRecords(ctx, eventID(1))
+	require.NoError(t, err)
+	for i := range records {
+		records[i].At = records[i].At.UTC()
+	}
+	require.Equal(t, []storage.AuditRecord{created, updated}, records)
+
+	// Records are append-only, changing the returned ones does not affect the storage.
+	records[0].Changes[0].New = "changed"
+	records, err = s.ListAuditRecords(ctx, eventID(1))
+	require.NoError(t, err)
+	require.Equal(t, "meeting", records[0].Changes[0].New)
+}
+
+func testShares(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	_, err := s.GetShare(ctx, "alice", "bob")
+	require.ErrorIs(t, err, storage.ErrShareNotFound)
+
+	require.NoError(t, s.SaveShare(ctx, storage.Share{OwnerID: "alice", UserID: "carol", Level: storage.AccessRead}))
+	require.NoError(t, s.SaveShare(ctx, storage.Share{OwnerID: "alice", UserID: "bob", Level: storage.AccessRead}))
+	require.NoError(t, s.SaveShare(ctx, storage.Share{OwnerID: "alice", UserID: "bob", Level: storage.AccessWrite}))
+	require.NoError(t, s.SaveShare(ctx, storage.Share{OwnerID: "dave", UserID: "bob", Level: storage.AccessRead}))
+
+	share, err := s.GetShare(ctx, "alice", "bob")
+	require.NoError(t, err)
+	require.Equal(t, storage.AccessWrite, share.Level)
+
+	shares, err := s.ListShares(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []storage.Share{
+		{OwnerID: "alice", UserID: "bob", Level: storage.AccessWrite},
+		{OwnerID: "alice", UserID: "carol", Level: storage.AccessRead},
+	}, shares)
+
+	shares, err = s.ListSharedWith(ctx, "bob")
+	require.NoError(t, err)
+	require.Equal(t, []storage.Share{
+		{OwnerID: "alice", UserID: "bob", Level: storage.AccessWrite},
+		{OwnerID: "dave", UserID: "bob", Level: storage.AccessRead},
+	}, shares)
+
+	require.NoError(t, s.DeleteShare(ctx, "alice", "bob"))
+	require.ErrorIs(t, s.DeleteShare(ctx, "alice", "bob"), storage.ErrShareNotFound)
+	shares, err = s.ListSharedWith(ctx, "bob")
+	require.NoError(t, err)
+	require.Len(t, shares, 1)
+}
+
+func testConflictPolicy(t *testing.T, s Storage) {
+	ctx := context.Background()
+	start := day.Add(10 * time.Hour)
+	tentative := func(n int) storage.Event {
+		event := newEvent(n, "alice", start)
+		event.Tentative = true
+		return event
+	}
+	policy := func(p storage.ConflictPolicy) storage.UserSettings {
+		return storage.UserSettings{UserID: "alice", ConflictPolicy: p}
+	}
+
+	settings, err := s.GetUserSettings(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, storage.ConflictReject, settings.ConflictPolicy)
+
+	require.NoError(t, s.CreateEvent(ctx, newEvent(1, "alice", start)))
+	require.ErrorIs(t, s.CreateEvent(ctx, tentative(2)), storage.ErrDateBusy)
+
+	require.NoError(t, s.SaveUserSettings(ctx, policy(storage.ConflictAllowTentative)))
+	require.NoError(t, s.CreateEvent(ctx, tentative(2)))
+	require.ErrorIs(t, s.CreateEvent(ctx, newEvent(3, "alice", start)), storage.ErrDateBusy)
+
+	require.NoError(t, s.SaveUserSettings(ctx, policy(storage.ConflictAllow)))
+	require.NoError(t, s.CreateEvent(ctx, newEvent(3, "alice", start)))
+
+	// Existing events overlap, so the stricter policies can't be chosen until they are moved.
+	require.ErrorIs(t, s.SaveUserSettings(ctx, policy(storage.ConflictAllowTentative)), storage.ErrDateBusy)
+	settings, err = s.GetUserSettings(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, storage.ConflictAllow, settings.ConflictPolicy)
+
+	require.NoError(t, s.TrashEvent(ctx, eventID(3), start))
+	require.NoError(t, s.SaveUserSettings(ctx, policy(storage.ConflictAllowTentative)))
+	require.ErrorIs(t, s.RestoreEvent(ctx, eventID(3)), storage.ErrDateBusy)
+
+	settings, err = s.GetUserSettings(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, storage.ConflictAllowTentative, settings.ConflictPolicy)
+}
+
+func testOutOfOffice(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	away := newEvent(1, "alice", day)
+	away.EndAt = day.AddDate(0, 0, 1)
+	away.Kind = storage.EventOutOfOffice
+	require.NoError(t, s.CreateEvent(ctx, away))
+	require.NoError(t, s.CreateEvent(ctx, newEvent(2, "alice", day.Add(10*time.Hour))))
+
+	// Out-of-office events stay out of the way under any policy.
+	require.NoError(t, s.SaveUserSettings(ctx, storage.UserSettings{
+		UserID: "alice", ConflictPolicy: storage.ConflictAllow,
+	}))
+	require.NoError(t, s.SaveUserSettings(ctx, storage.UserSettings{
+		UserID: "alice", ConflictPolicy: storage.ConflictReject,
+	}))
+
+	got, err := s.GetEvent(ctx, away.ID)
+	require.NoError(t, err)
+	require.Equal(t, storage.EventOutOfOffice, got.Kind)
+}
+
+func testUserSettings(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	got, err := s.GetUserSettings(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, storage.DefaultUserSettings("alice"), got)
+
+	settings := storage.UserSettings{
+		UserID:           "alice",
+		ConflictPolicy:   storage.ConflictAllow,
+		DefaultReminders: []time.Duration{24 * time.Hour, 15 * time.Minute},
+		WorkingHours: storage.WorkingHours{
+			Days:     []time.Weekday{time.Monday, time.Friday},
+			Start:    9 * time.Hour,
+			End:      18 * time.Hour,
+			TimeZone: "Europe/Moscow",
+		},
+		Digest: storage.DigestSettings{Enabled: true, TimeZone: "Asia/Tokyo"},
+	}
+	require.NoError(t, s.SaveUserSettings(ctx, settings))
+	got, err = s.GetUserSettings(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, settings, got)
+
+	// Only the users opted in get the digest.
+	require.NoError(t, s.SaveUserSettings(ctx, storage.DefaultUserSettings("bob")))
+	digests, err := s.ListDigestSettings(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []storage.UserSettings{settings}, digests)
+
+	// Saving again replaces the settings as a whole.
+	settings = storage.UserSettings{UserID: "alice", ConflictPolicy: storage.ConflictReject}
+	require.NoError(t, s.SaveUserSettings(ctx, settings))
+	got, err = s.GetUserSettings(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, settings, got)
+	digests, err = s.ListDigestSettings(ctx)
+	require.NoError(t, err)
+	require.Empty(t, digests)
+
+	got, err = s.GetUserSettings(ctx, "carol")
+	require.NoError(t, err)
+	require.Equal(t, storage.DefaultUserSettings("carol"), got)
+}
+
+func testApplyBatch(t *testing.T, s Storage) {
+	ctx := context.Background()
+	start := day.Add(10 * time.Hour)
+	require.NoError(t, s.CreateEvent(ctx, newEvent(1, "alice", start)))
+
+	ops := []storage.BatchOp{
+		{Kind: storage.BatchCreate, Event: newEvent(2, "alice", start.Add(time.Hour))},
+		{Kind: storage.BatchDelete, Event: storage.Event{ID: eventID(1), DeletedAt: start}},
+		{Kind: storage.BatchCreate, Event: newEvent(3, "alice", start.Add(time.Hour))},
+	}
+	errs, err := s.ApplyBatch(ctx, ops, storage.BatchAtomic)
+	require.NoError(t, err)
+	require.ErrorIs(t, errs[0], storage.ErrBatchAborted)
+	require.ErrorIs(t, errs[1], storage.ErrBatchAborted)
+	require.ErrorIs(t, errs[2], storage.ErrDateBusy)
+	require.Equal(t, []string{eventID(1)}, listIDs(t, s, "alice", day, day.AddDate(0, 0, 1)))
+
+	errs, err = s.ApplyBatch(ctx, ops, storage.BatchBestEffort)
+	require.NoError(t, err)
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	require.ErrorIs(t, errs[2], storage.ErrDateBusy)
+	require.Equal(t, []string{eventID(2)}, listIDs(t, s, "alice", day, day.AddDate(0, 0, 1)))
+}
+
+func testExport(t *testing.T, s Storage) {
+	ctx := context.Background()
+	for n := 5; n >= 1; n-- {
+		event := newEvent(n, "alice", day.Add(time.Duration(n)*time.Hour), storage.Attendee{
+			UserID: "bob",
+			Status: storage.RSVPPending,
+		})
+		event.Reminders = []time.Duration{time.Hour}
+		require.NoError(t, s.CreateEvent(ctx, event))
+	}
+	require.NoError(t, s.TrashEvent(ctx, eventID(2), day))
+
+	inSnapshot(t, s, func(e storage.Exporter) {
+		events, err := e.ExportEvents(ctx, false, "", 2)
+		require.NoError(t, err)
+		require.Equal(t, []string{eventID(1), eventID(3)}, ids(events))
+		require.Equal(t, []storage.Attendee{{UserID: "bob", Status: storage.RSVPPending}}, events[0].Attendees)
+		require.Equal(t, []time.Duration{time.Hour}, events[0].Reminders)
+		events, err = e.ExportEvents(ctx, false, eventID(3), 2)
+		require.NoError(t, err)
+		require.Equal(t, []string{eventID(4), eventID(5)}, ids(events))
+		events, err = e.ExportEvents(ctx, false, eventID(5), 2)
+		require.NoError(t, err)
+		require.Empty(t, events)
+
+		events, err = e.ExportEvents(ctx, true, "", 2)
+		require.NoError(t, err)
+		require.Equal(t, []string{eventID(2)}, ids(events))
+		require.True(t, events[0].DeletedAt.Equal(day))
+
+		settings, err := e.ExportUserSettings(ctx)
+		require.NoError(t, err)
+		require.Empty(t, settings)
+	})
+
+	bob := storage.UserSettings{
+		UserID:           "bob",
+		ConflictPolicy:   storage.ConflictAllow,
+		DefaultReminders: []time.Duration{15 * time.Minute},
+	}
+	alice := storage.UserSettings{UserID: "alice", ConflictPolicy: storage.ConflictReject}
+	require.NoError(t, s.SaveUserSettings(ctx, bob))
+	require.NoError(t, s.SaveUserSettings(ctx, alice))
+	inSnapshot(t, s, func(e storage.Exporter) {
+		settings, err := e.ExportUserSettings(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []storage.UserSettings{alice, bob}, settings)
+	})
+}
+
+func testImport(t *testing.T, s Storage) {
+	ctx := context.Background()
+	require.NoError(t, s.CreateEvent(ctx, newEvent(1, "alice", day)))
+
+	importAll := func(im storage.Importer) error {
+		if err := im.SaveUserSettings(ctx, storage.UserSettings{
+			UserID:         "bob",
+			ConflictPolicy: storage.ConflictAllow,
+		}); err != nil {
+			return err
+		}
+		if err := im.SaveTag(ctx, storage.Tag{UserID: "bob", Name: "team"}); err != nil {
+			return err
+		}
+		if err := im.CreateEvent(ctx, newEvent(2, "bob", day)); err != nil {
+			return err
+		}
+		if err := im.TrashEvent(ctx, eventID(2), day); err != nil {
+			return err
+		}
+		return im.CreateEvent(ctx, newEvent(3, "bob", day))
+	}
+
+	// A failed import leaves the storage as it was.
+	err := s.Import(ctx, func(im storage.Importer) error {
+		if err := importAll(im); err != nil {
+			return err
+		}
+		return im.CreateEvent(ctx, newEvent(1, "bob", day.Add(time.Hour)))
+	})
+	require.ErrorIs(t, err, storage.ErrEventExists)
+	inSnapshot(t, s, func(e storage.Exporter) {
+		settings, err := e.ExportUserSettings(ctx)
+		require.NoError(t, err)
+		require.Empty(t, settings)
+		tags, err := e.ExportTags(ctx)
+		require.NoError(t, err)
+		require.Empty(t, tags)
+		events, err := e.ExportEvents(ctx, true, "", 10)
+		require.NoError(t, err)
+		require.Empty(t, events)
+		events, err = e.ExportEvents(ctx, false, "", 10)
+		require.NoError(t, err)
+		require.Equal(t, []string{eventID(1)}, ids(events))
+	})
+
+	require.NoError(t, s.Import(ctx, importAll))
+	inSnapshot(t, s, func(e storage.Exporter) {
+		settings, err := e.ExportUserSettings(ctx)
+		require.NoError(t, err)
+		require.Len(t, settings, 1)
+		tags, err := e.ExportTags(ctx)
+		require.NoError(t, err)
+		require.Len(t, tags, 1)
+		events, err := e.ExportEvents(ctx, true, "", 10)
+		require.NoError(t, err)
+		require.Equal(t, []string{eventID(2)}, ids(events))
+		events, err = e.ExportEvents(ctx, false, "", 10)
+		require.NoError(t, err)
+		require.Equal(t, []string{eventID(1), eventID(3)}, ids(events))
+	})
+}
+
+// inSnapshot runs fn with the exporter of a storage snapshot.
+func inSnapshot(t *testing.T, s Storage, fn func(e storage.Exporter)) {
+	t.Helper()
+	require.NoError(t, s.Snapshot(context.Background(), func(e storage.Exporter) error {
+		fn(e)
+		return nil
+	}))
+}
+
+func testTags(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	tags, err := s.ListTags(ctx, "alice")
+	require.NoError(t, err)
+	require.Empty(t, tags)
+
+	require.NoError(t, s.SaveTag(ctx, storage.Tag{UserID: "alice", Name: "team"}))
+	require.NoError(t, s.SaveTag(ctx, storage.Tag{UserID: "alice", Name: "planning", Color: "#ff0000"}))
+	require.NoError(t, s.SaveTag(ctx, storage.Tag{UserID: "alice", Name: "team", Color: "#00ff00"}))
+	require.NoError(t, s.SaveTag(ctx, storage.Tag{UserID: "bob", Name: "team"}))
+
+	tags, err = s.ListTags(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []storage.Tag{
+		{UserID: "alice", Name: "planning", Color: "#ff0000"},
+		{UserID: "alice", Name: "team", Color: "#00ff00"},
+	}, tags)
+	inSnapshot(t, s, func(e storage.Exporter) {
+		tags, err := e.ExportTags(ctx)
+		require.NoError(t, err)
+		require.Len(t, tags, 3)
+	})
+
+	// Deleting a tag takes it off the events of the user, the trashed ones too, but not off the events
+	// of other users.
+	for n, userID := range []string{"alice", "alice", "bob"} {
+		event := newEvent(n+1, userID, day.Add(time.Duration(n)*time.Hour))
+		event.Tags = []string{"planning", "team"}
+		require.NoError(t, s.CreateEvent(ctx, event))
+	}
+	require.NoError(t, s.TrashEvent(ctx, eventID(2), day))
+	require.NoError(t, s.DeleteTag(ctx, "alice", "team"))
+	require.ErrorIs(t, s.DeleteTag(ctx, "alice", "team"), storage.ErrTagNotFound)
+	for n, want := range [][]string{{"planning"}, {"planning"}, {"planning", "team"}} {
+		event, err := s.GetEvent(ctx, eventID(n+1))
+		require.NoError(t, err)
+		require.Equal(t, want, event.Tags)
+	}
+	tags, err = s.ListTags(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []storage.Tag{{UserID: "alice", Name: "planning", Color: "#ff0000"}}, tags)
+}
+
+// testConcurrentWrites checks that concurrent writers of different users all succeed,
+// while of the writers competing for the same time exactly one does.
+func testConcurrentWrites(t *testing.T, s Storage) {
+	ctx := context.Background()
+	const writers = 20
+
+	errs := make([]error, 2*writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.CreateEvent(ctx, newEvent(i, fmt.Sprintf("user%d", i), day))
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.CreateEvent(ctx, newEvent(i, "alice", day.Add(10*time.Hour)))
+		}(writers + i)
+	}
+	wg.Wait()
+
+	busy := 0
+	for i, err := range errs {
+		if i < writers {
+			require.NoError(t, err)
+			continue
+		}
+		if err != nil {
+			require.ErrorIs(t, err, storage.ErrDateBusy)
+			busy++
+		}
+	}
+	require.Equal(t, writers-1, busy)
+	require.Len(t, listIDs(t, s, "alice", day, day.AddDate(0, 0, 1)), 1)
+	for i := 0; i < writers; i++ {
+		require.Equal(t, []string{eventID(i)}, listIDs(t, s, fmt.Sprintf("user%d", i), day, day.AddDate(0, 0, 1)))
+	}
+}
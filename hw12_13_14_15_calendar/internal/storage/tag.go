@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MaxTagLength limits the length of tag names in characters.
+const MaxTagLength = 32
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+// Tag is an entry of the tag vocabulary of the user, the events of the user are tagged with its names only.
+type Tag struct {
+	UserID string
+	Name   string
+	Color  string // The #rrggbb color of the tag, empty for the default one.
+}
+
+// HasTag reports whether the event is tagged with the name.
+func (e Event) HasTag(name string) bool {
+	for _, tag := range e.Tags {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeTag trims and lowercases the tag name, so "Work " and "work" are the same tag.
+func NormalizeTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// NormalizeTags normalizes the names, drops the empty ones and the duplicates and sorts the rest.
+// Nil stays nil, as it means the tags are not specified, unlike an empty list.
+func NormalizeTags(names []string) []string {
+	if names == nil {
+		return nil
+	}
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		name = NormalizeTag(name)
+		if name != "" && !containsString(normalized, name) {
+			normalized = append(normalized, name)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// NormalizeColor lowercases the color, so "#FFAA00" and "#ffaa00" are stored the same.
+func NormalizeColor(color string) string {
+	return strings.ToLower(strings.TrimSpace(color))
+}
+
+// ValidColor reports whether the normalized color is empty or has the #rrggbb form.
+func ValidColor(color string) bool {
+	return color == "" || colorPattern.MatchString(color)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+// Package tlstest writes a CA with server and client certificates issued by it for the TLS tests.
+package tlstest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writes counts the files written, every one gets a modification time later than any previous one,
+// so that a reload is noticed even on file systems with coarse timestamps.
+var writes int64
+
+// Files are the PEM files written to the directory. The server certificate is valid for localhost
+// and 127.0.0.1.
+type Files struct {
+	CA         string
+	ServerCert string
+	ServerKey  string
+	ClientCert string
+	ClientKey  string
+}
+
+// CA issues certificates, its own certificate is self-signed.
+type CA struct {
+	cert   *x509.Certificate
+	key    crypto.Signer
+	serial int64
+}
+
+// WriteFiles creates a CA and writes it along with the server and client certificates into dir.
+func WriteFiles(t *testing.T, dir string) (*CA, Files) {
+	t.Helper()
+
+	files := Files{
+		CA:         filepath.Join(dir, "ca.pem"),
+		ServerCert: filepath.Join(dir, "server.pem"),
+		ServerKey:  filepath.Join(dir, "server-key.pem"),
+		ClientCert: filepath.Join(dir, "client.pem"),
+		ClientKey:  filepath.Join(dir, "client-key.pem"),
+	}
+	ca := NewCA(t, files.CA)
+	ca.Issue(t, "localhost", x509.ExtKeyUsageServerAuth, files.ServerCert, files.ServerKey)
+	ca.Issue(t, "alice", x509.ExtKeyUsageClientAuth, files.ClientCert, files.ClientKey)
+	return ca, files
+}
+
+// NewCA creates a CA and writes its certificate, replacing the file if it exists.
+func NewCA(t *testing.T, certFile string) *CA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "calendar test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	writePEM(t, certFile, "CERTIFICATE", der)
+	return &CA{cert: cert, key: key, serial: 1}
+}
+
+// Issue writes a new certificate and key, replacing the files if they exist, and returns the serial number
+// of the certificate.
+func (ca *CA) Issue(t *testing.T, name string, usage x509.ExtKeyUsage, certFile, keyFile string) int64 {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	if usage == x509.ExtKeyUsageServerAuth {
+		template.DNSNames = []string{name}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "PRIVATE KEY", keyDER)
+	return ca.serial
+}
+
+func writePEM(t *testing.T, name, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(name, data, 0o600))
+	modTime := time.Now().Add(time.Duration(atomic.AddInt64(&writes, 1)) * time.Second)
+	require.NoError(t, os.Chtimes(name, modTime, modTime))
+}
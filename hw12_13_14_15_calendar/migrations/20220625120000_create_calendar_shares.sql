@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE calendar_shares (
+    owner_id text NOT NULL,
+    user_id  text NOT NULL,
+    level    text NOT NULL,
+    PRIMARY KEY (owner_id, user_id)
+);
+
+CREATE INDEX calendar_shares_user_id_idx ON calendar_shares (user_id);
+
+-- +goose Down
+DROP TABLE calendar_shares;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE events ADD COLUMN kind text NOT NULL DEFAULT 'regular';
+
+ALTER TABLE user_settings ADD COLUMN working_days smallint NOT NULL DEFAULT 0; -- bit mask of weekdays, bit 0 is Sunday
+ALTER TABLE user_settings ADD COLUMN working_start bigint NOT NULL DEFAULT 0; -- nanoseconds since midnight
+ALTER TABLE user_settings ADD COLUMN working_end bigint NOT NULL DEFAULT 0; -- nanoseconds since midnight
+ALTER TABLE user_settings ADD COLUMN time_zone text NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE user_settings DROP COLUMN time_zone;
+ALTER TABLE user_settings DROP COLUMN working_end;
+ALTER TABLE user_settings DROP COLUMN working_start;
+ALTER TABLE user_settings DROP COLUMN working_days;
+
+ALTER TABLE events DROP COLUMN kind;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE user_settings ADD COLUMN digest_enabled boolean NOT NULL DEFAULT false;
+ALTER TABLE user_settings ADD COLUMN digest_time_zone text NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE user_settings DROP COLUMN digest_time_zone;
+ALTER TABLE user_settings DROP COLUMN digest_enabled;
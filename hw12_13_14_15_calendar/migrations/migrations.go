@@ -0,0 +1,80 @@
+// Package migrations holds the database migrations in the goose format. The ones in this directory are
+// dialect-neutral and shared, postgres/ and sqlite/ hold the ones that differ, e.g. the exclusion constraint
+// of Postgres and the SQLite triggers standing in for it. Every version lives either here or in both
+// dialect directories. "make migrate" applies the shared and the Postgres ones with goose, the SQLite
+// storage applies the shared and the SQLite ones itself on connect.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// Migration is a migration file of a dialect.
+type Migration struct {
+	Version int64
+	Name    string
+	Source  string
+}
+
+// Up returns the statements between the "-- +goose Up" and "-- +goose Down" annotations.
+func (m Migration) Up() string {
+	src := m.Source
+	if i := strings.Index(src, "-- +goose Up"); i >= 0 {
+		src = src[i:]
+	}
+	if i := strings.Index(src, "-- +goose Down"); i >= 0 {
+		src = src[:i]
+	}
+	return src
+}
+
+// Postgres returns the shared and the Postgres migrations ordered by version.
+func Postgres() ([]Migration, error) {
+	return dialect("postgres")
+}
+
+// SQLite returns the shared and the SQLite migrations ordered by version.
+func SQLite() ([]Migration, error) {
+	return dialect("sqlite")
+}
+
+func dialect(dir string) ([]Migration, error) {
+	shared, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	own, err := fs.Glob(files, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Migration
+	seen := make(map[int64]string)
+	for _, file := range append(shared, own...) {
+		name := path.Base(file)
+		version, err := strconv.ParseInt(strings.SplitN(name, "_", 2)[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: bad version: %w", file, err)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migration %s: version of %s", file, other)
+		}
+		seen[version] = file
+		src, err := fs.ReadFile(files, file)
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", file, err)
+		}
+		list = append(list, Migration{Version: version, Name: name, Source: string(src)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialects(t *testing.T) {
+	postgres, err := Postgres()
+	require.NoError(t, err)
+	sqlite, err := SQLite()
+	require.NoError(t, err)
+
+	// Both dialects go through the same versions, so a database of either is at the same schema.
+	versions := func(list []Migration) []int64 {
+		result := make([]int64, 0, len(list))
+		for _, m := range list {
+			result = append(result, m.Version)
+		}
+		return result
+	}
+	require.Equal(t, versions(postgres), versions(sqlite))
+	require.Len(t, postgres, 11)
+	require.IsIncreasing(t, versions(postgres))
+
+	require.NotContains(t, sqlite[0].Up(), "-- +goose Down")
+	require.Contains(t, sqlite[0].Up(), "CREATE TABLE events")
+}
@@ -0,0 +1,15 @@
+-- +goose Up
+-- The history outlives the events it describes, so there is no reference to the events table.
+CREATE TABLE audit_records (
+    id       bigserial PRIMARY KEY,
+    event_id uuid        NOT NULL,
+    action   text        NOT NULL,
+    actor_id text        NOT NULL,
+    at       timestamptz NOT NULL,
+    changes  jsonb       NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX audit_records_event_id_idx ON audit_records (event_id, id);
+
+-- +goose Down
+DROP TABLE audit_records;
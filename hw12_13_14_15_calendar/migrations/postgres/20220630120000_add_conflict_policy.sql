@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+CREATE TABLE user_settings (
+    user_id         text PRIMARY KEY,
+    conflict_policy text NOT NULL DEFAULT 'reject'
+);
+
+ALTER TABLE events
+    ADD COLUMN tentative boolean NOT NULL DEFAULT false,
+    ADD COLUMN exclusive boolean NOT NULL DEFAULT true;
+
+ALTER TABLE events ADD CONSTRAINT events_no_overlap EXCLUDE USING gist (
+    user_id WITH =,
+    tstzrange(start_at, end_at) WITH &&
+) WHERE (exclusive AND deleted_at IS NULL);
+
+-- +goose Down
+ALTER TABLE events DROP CONSTRAINT events_no_overlap;
+
+ALTER TABLE events
+    DROP COLUMN exclusive,
+    DROP COLUMN tentative;
+
+DROP TABLE user_settings;
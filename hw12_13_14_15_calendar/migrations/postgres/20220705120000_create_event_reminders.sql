@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE event_reminders (
+    event_id uuid   NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    before   bigint NOT NULL, -- nanoseconds
+    PRIMARY KEY (event_id, before)
+);
+
+INSERT INTO event_reminders (event_id, before)
+SELECT id, notify_before FROM events WHERE notify_before > 0;
+
+ALTER TABLE events DROP COLUMN notify_before;
+
+CREATE TABLE user_default_reminders (
+    user_id text   NOT NULL,
+    before  bigint NOT NULL, -- nanoseconds
+    PRIMARY KEY (user_id, before)
+);
+
+-- +goose Down
+DROP TABLE user_default_reminders;
+
+ALTER TABLE events ADD COLUMN notify_before bigint NOT NULL DEFAULT 0;
+
+UPDATE events e SET notify_before = r.before
+FROM (SELECT event_id, min(before) AS before FROM event_reminders GROUP BY event_id) r
+WHERE r.event_id = e.id;
+
+DROP TABLE event_reminders;
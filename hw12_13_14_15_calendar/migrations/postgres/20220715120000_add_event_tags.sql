@@ -0,0 +1,29 @@
+-- +goose Up
+ALTER TABLE events
+    ADD COLUMN category text NOT NULL DEFAULT '',
+    ADD COLUMN color    text NOT NULL DEFAULT ''; -- #rrggbb
+
+CREATE TABLE user_tags (
+    user_id text NOT NULL,
+    name    text NOT NULL,
+    color   text NOT NULL DEFAULT '', -- #rrggbb
+    PRIMARY KEY (user_id, name)
+);
+
+-- The tags of an event are the names from the vocabulary of its owner, deleting a tag from the vocabulary
+-- deletes it from the events, so there is no reference to user_tags.
+CREATE TABLE event_tags (
+    event_id uuid NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    tag      text NOT NULL,
+    PRIMARY KEY (event_id, tag)
+);
+
+CREATE INDEX event_tags_tag_idx ON event_tags (tag);
+
+-- +goose Down
+DROP TABLE event_tags;
+DROP TABLE user_tags;
+
+ALTER TABLE events
+    DROP COLUMN color,
+    DROP COLUMN category;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Times are Unix nanoseconds, so they compare and add up with the nanosecond reminder offsets as plain integers.
+-- The SQLite storage came after the reminders moved to event_reminders, so there is no notify_before column.
+CREATE TABLE events (
+    id          text    PRIMARY KEY,
+    title       text    NOT NULL,
+    start_at    integer NOT NULL,
+    end_at      integer NOT NULL,
+    description text    NOT NULL DEFAULT '',
+    user_id     text    NOT NULL
+);
+
+CREATE INDEX events_user_id_start_at_idx ON events (user_id, start_at);
+
+-- +goose Down
+DROP TABLE events;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE event_attendees (
+    event_id text NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    user_id  text NOT NULL,
+    status   text NOT NULL DEFAULT 'pending',
+    PRIMARY KEY (event_id, user_id)
+);
+
+CREATE INDEX event_attendees_user_id_idx ON event_attendees (user_id);
+
+-- +goose Down
+DROP TABLE event_attendees;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- The history outlives the events it describes, so there is no reference to the events table.
+CREATE TABLE audit_records (
+    id       integer PRIMARY KEY AUTOINCREMENT,
+    event_id text    NOT NULL,
+    action   text    NOT NULL,
+    actor_id text    NOT NULL,
+    at       integer NOT NULL,
+    changes  text    NOT NULL DEFAULT '[]' -- JSON array
+);
+
+CREATE INDEX audit_records_event_id_idx ON audit_records (event_id, id);
+
+-- +goose Down
+DROP TABLE audit_records;
@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE user_settings (
+    user_id         text PRIMARY KEY,
+    conflict_policy text NOT NULL DEFAULT 'reject'
+);
+
+ALTER TABLE events ADD COLUMN tentative boolean NOT NULL DEFAULT false;
+ALTER TABLE events ADD COLUMN exclusive boolean NOT NULL DEFAULT true;
+
+-- SQLite has no exclusion constraints, the triggers stand in for events_no_overlap of Postgres.
+-- +goose StatementBegin
+CREATE TRIGGER events_no_overlap_insert BEFORE INSERT ON events
+WHEN NEW.exclusive AND NEW.deleted_at IS NULL
+BEGIN
+    SELECT RAISE(ABORT, 'events_no_overlap') FROM events
+    WHERE user_id = NEW.user_id AND id <> NEW.id AND exclusive AND deleted_at IS NULL
+        AND start_at < NEW.end_at AND end_at > NEW.start_at;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER events_no_overlap_update BEFORE UPDATE OF user_id, start_at, end_at, exclusive, deleted_at ON events
+WHEN NEW.exclusive AND NEW.deleted_at IS NULL
+BEGIN
+    SELECT RAISE(ABORT, 'events_no_overlap') FROM events
+    WHERE user_id = NEW.user_id AND id <> NEW.id AND exclusive AND deleted_at IS NULL
+        AND start_at < NEW.end_at AND end_at > NEW.start_at;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER events_no_overlap_update;
+DROP TRIGGER events_no_overlap_insert;
+
+ALTER TABLE events DROP COLUMN exclusive;
+ALTER TABLE events DROP COLUMN tentative;
+
+DROP TABLE user_settings;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE event_reminders (
+    event_id text    NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    before   integer NOT NULL, -- nanoseconds
+    PRIMARY KEY (event_id, before)
+);
+
+CREATE TABLE user_default_reminders (
+    user_id text    NOT NULL,
+    before  integer NOT NULL, -- nanoseconds
+    PRIMARY KEY (user_id, before)
+);
+
+-- +goose Down
+DROP TABLE user_default_reminders;
+DROP TABLE event_reminders;
@@ -0,0 +1,339 @@
+// Package calendarclient is a typed client of the calendar HTTP API described by /openapi.json. The API is
+// transcoded from the gRPC service by the gateway under /v1/, the requests and responses are the messages
+// of eventpb in their JSON form.
+package calendarclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/eventpb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Client calls the calendar on behalf of a single user.
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	authenticate func(req *http.Request)
+}
+
+type Option func(c *Client)
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts or TLS.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTLS replaces http.DefaultClient with a client using the TLS config, e.g. the one made by calendartls
+// to verify the calendar by a private CA or to present a client certificate.
+func WithTLS(cfg *tls.Config) Option {
+	return func(c *Client) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = cfg
+		c.httpClient = &http.Client{Transport: transport}
+	}
+}
+
+// WithUserHeader authenticates requests by the user ID passed in the header, as the calendar in header auth
+// mode expects.
+func WithUserHeader(header, userID string) Option {
+	return func(c *Client) {
+		c.authenticate = func(req *http.Request) {
+			req.Header.Set(header, userID)
+		}
+	}
+}
+
+// WithBearerToken authenticates requests by the JWT, as the calendar in jwt auth mode expects.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.authenticate = func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+}
+
+// New creates the client of the calendar at baseURL, e.g. http://localhost:8080 or https://localhost:8080.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   http.DefaultClient,
+		authenticate: func(*http.Request) {},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// CreateEvent creates the event owned by the user. A non-empty idempotency key makes retries
+// return the originally created event instead of creating another one.
+func (c *Client) CreateEvent(ctx context.Context, event Event, idempotencyKey string) (Event, error) {
+	var header http.Header
+	if idempotencyKey != "" {
+		header = http.Header{"Idempotency-Key": {idempotencyKey}}
+	}
+	resp := &eventpb.EventResponse{}
+	if err := c.do(ctx, http.MethodPost, "/v1/events", header, toEventPB(event), resp); err != nil {
+		return Event{}, err
+	}
+	return fromEventPB(resp.GetEvent()), nil
+}
+
+func (c *Client) UpdateEvent(ctx context.Context, id string, event Event) (Event, error) {
+	resp := &eventpb.EventResponse{}
+	if err := c.do(ctx, http.MethodPut, "/v1/events/"+url.PathEscape(id), nil, toEventPB(event), resp); err != nil {
+		return Event{}, err
+	}
+	return fromEventPB(resp.GetEvent()), nil
+}
+
+// DeleteEvent moves the event to the trash.
+func (c *Client) DeleteEvent(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/events/"+url.PathEscape(id), nil, nil, nil)
+}
+
+func (c *Client) RestoreEvent(ctx context.Context, id string) (Event, error) {
+	resp := &eventpb.EventResponse{}
+	if err := c.do(ctx, http.MethodPost, "/v1/events/"+url.PathEscape(id)+"/restore", nil, nil, resp); err != nil {
+		return Event{}, err
+	}
+	return fromEventPB(resp.GetEvent()), nil
+}
+
+func (c *Client) ListTrash(ctx context.Context) ([]Event, error) {
+	resp := &eventpb.ListEventsResponse{}
+	if err := c.do(ctx, http.MethodGet, "/v1/events/trash", nil, nil, resp); err != nil {
+		return nil, err
+	}
+	return fromEventsPB(resp.GetEvents()), nil
+}
+
+func (c *Client) RespondToEvent(ctx context.Context, id string, status RSVPStatus) error {
+	return c.do(ctx, http.MethodPost, "/v1/events/"+url.PathEscape(id)+"/rsvp", nil,
+		&eventpb.RespondToEventRequest{Status: string(status)}, nil)
+}
+
+func (c *Client) EventHistory(ctx context.Context, id string) ([]AuditRecord, error) {
+	resp := &eventpb.EventHistoryResponse{}
+	if err := c.do(ctx, http.MethodGet, "/v1/events/"+url.PathEscape(id)+"/history", nil, nil, resp); err != nil {
+		return nil, err
+	}
+	records := make([]AuditRecord, 0, len(resp.GetRecords()))
+	for _, pb := range resp.GetRecords() {
+		records = append(records, fromAuditRecordPB(pb))
+	}
+	return records, nil
+}
+
+// ListOption tunes the list queries.
+type ListOption func(query url.Values)
+
+// IncludeShared adds the events of the calendars shared with the user.
+func IncludeShared() ListOption {
+	return func(query url.Values) {
+		query.Set("includeShared", "true")
+	}
+}
+
+// WithTag keeps the events tagged with the tag only.
+func WithTag(tag string) ListOption {
+	return func(query url.Values) {
+		query.Set("tag", tag)
+	}
+}
+
+func (c *Client) ListDayEvents(ctx context.Context, date time.Time, opts ...ListOption) ([]Event, error) {
+	return c.listEvents(ctx, "day", date, opts)
+}
+
+func (c *Client) ListWeekEvents(ctx context.Context, date time.Time, opts ...ListOption) ([]Event, error) {
+	return c.listEvents(ctx, "week", date, opts)
+}
+
+func (c *Client) ListMonthEvents(ctx context.Context, date time.Time, opts ...ListOption) ([]Event, error) {
+	return c.listEvents(ctx, "month", date, opts)
+}
+
+func (c *Client) listEvents(ctx context.Context, period string, date time.Time, opts []ListOption) ([]Event, error) {
+	// The calendar starts the list at the UTC day of the timestamp, the day of date is taken as it is.
+	year, month, day := date.Date()
+	query := url.Values{"date": {time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)}}
+	for _, opt := range opts {
+		opt(query)
+	}
+	resp := &eventpb.ListEventsResponse{}
+	if err := c.do(ctx, http.MethodGet, "/v1/events/"+period+"?"+query.Encode(), nil, nil, resp); err != nil {
+		return nil, err
+	}
+	return fromEventsPB(resp.GetEvents()), nil
+}
+
+// ShareCalendar grants the user access to the calendar, sharing again changes the level.
+func (c *Client) ShareCalendar(ctx context.Context, userID string, level AccessLevel) (Share, error) {
+	resp := &eventpb.Share{}
+	err := c.do(ctx, http.MethodPut, "/v1/shares/"+url.PathEscape(userID), nil,
+		&eventpb.ShareCalendarRequest{Level: string(level)}, resp)
+	if err != nil {
+		return Share{}, err
+	}
+	return fromSharePB(resp), nil
+}
+
+func (c *Client) UnshareCalendar(ctx context.Context, userID string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/shares/"+url.PathEscape(userID), nil, nil, nil)
+}
+
+// ListShares returns the users the calendar is shared with.
+func (c *Client) ListShares(ctx context.Context) ([]Share, error) {
+	return c.listShares(ctx, "/v1/shares")
+}
+
+// ListSharedWithMe returns the calendars shared with the user.
+func (c *Client) ListSharedWithMe(ctx context.Context) ([]Share, error) {
+	return c.listShares(ctx, "/v1/shares/received")
+}
+
+func (c *Client) listShares(ctx context.Context, path string) ([]Share, error) {
+	resp := &eventpb.ListSharesResponse{}
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, resp); err != nil {
+		return nil, err
+	}
+	shares := make([]Share, 0, len(resp.GetShares()))
+	for _, pb := range resp.GetShares() {
+		shares = append(shares, fromSharePB(pb))
+	}
+	return shares, nil
+}
+
+// ApplyBatch applies the operations in a single transaction. The error is returned only if the batch as a whole
+// is rejected, failures of operations are reported in BatchReport. The operations are streamed to the gateway
+// as newline-delimited messages.
+func (c *Client) ApplyBatch(ctx context.Context, mode BatchMode, ops ...BatchOperation) (BatchReport, error) {
+	var body bytes.Buffer
+	for _, op := range ops {
+		data, err := protojson.Marshal(op.toPB())
+		if err != nil {
+			return BatchReport{}, fmt.Errorf("marshal request: %w", err)
+		}
+		body.Write(data)
+		body.WriteByte('\n')
+	}
+	header := http.Header{"Batch-Mode": {string(mode)}}
+	resp := &eventpb.BatchEventsResponse{}
+	if err := c.send(ctx, http.MethodPost, "/v1/events/batch", header, body.Bytes(), resp); err != nil {
+		return BatchReport{}, err
+	}
+	return fromBatchReportPB(resp), nil
+}
+
+// ListTags returns the tag vocabulary of the user sorted by name.
+func (c *Client) ListTags(ctx context.Context) ([]Tag, error) {
+	resp := &eventpb.ListTagsResponse{}
+	if err := c.do(ctx, http.MethodGet, "/v1/tags", nil, nil, resp); err != nil {
+		return nil, err
+	}
+	tags := make([]Tag, 0, len(resp.GetTags()))
+	for _, pb := range resp.GetTags() {
+		tags = append(tags, Tag{Name: pb.GetName(), Color: pb.GetColor()})
+	}
+	return tags, nil
+}
+
+// SaveTag adds the tag to the vocabulary of the user, saving an existing tag changes its color.
+func (c *Client) SaveTag(ctx context.Context, tag Tag) (Tag, error) {
+	resp := &eventpb.Tag{}
+	err := c.do(ctx, http.MethodPut, "/v1/tags/"+url.PathEscape(tag.Name), nil, &eventpb.Tag{Color: tag.Color}, resp)
+	if err != nil {
+		return Tag{}, err
+	}
+	return Tag{Name: resp.GetName(), Color: resp.GetColor()}, nil
+}
+
+// DeleteTag removes the tag from the vocabulary and from all the events of the user.
+func (c *Client) DeleteTag(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/tags/"+url.PathEscape(name), nil, nil, nil)
+}
+
+func (c *Client) GetSettings(ctx context.Context) (Settings, error) {
+	resp := &eventpb.Settings{}
+	if err := c.do(ctx, http.MethodGet, "/v1/settings", nil, nil, resp); err != nil {
+		return Settings{}, err
+	}
+	return fromSettingsPB(resp)
+}
+
+// UpdateSettings fails with a conflict error if events of the user overlap under the new conflict policy.
+func (c *Client) UpdateSettings(ctx context.Context, settings Settings) (Settings, error) {
+	resp := &eventpb.Settings{}
+	if err := c.do(ctx, http.MethodPut, "/v1/settings", nil, toSettingsPB(settings), resp); err != nil {
+		return Settings{}, err
+	}
+	return fromSettingsPB(resp)
+}
+
+// do sends in as the JSON body, if not nil, and decodes the successful response into out, if not nil.
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, in, out proto.Message) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = protojson.Marshal(in); err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+	}
+	return c.send(ctx, method, path, header, body, out)
+}
+
+// send sends the body, if not nil, and decodes the successful response into out, if not nil.
+func (c *Client) send(
+	ctx context.Context, method, path string, header http.Header, body []byte, out proto.Message,
+) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.authenticate(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newAPIError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	// Fields added by newer calendars are skipped.
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package calendarclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+var start = time.Date(2022, time.June, 1, 10, 0, 0, 0, time.UTC)
+
+func TestCreateEvent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/v1/events", r.URL.Path)
+		require.Equal(t, "alice", r.Header.Get("X-User-ID"))
+		require.Equal(t, "key-1", r.Header.Get("Idempotency-Key"))
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, map[string]interface{}{
+			"title":     "meeting",
+			"startAt":   "2022-06-01T10:00:00Z",
+			"endAt":     "2022-06-01T11:00:00Z",
+			"reminders": []interface{}{"3600s", "900s"},
+			"attendees": []interface{}{map[string]interface{}{"userId": "bob"}},
+		}, body)
+
+		_, _ = w.Write([]byte(`{"event": {
+			"id": "1", "title": "meeting", "startAt": "2022-06-01T10:00:00Z", "endAt": "2022-06-01T11:00:00Z",
+			"userId": "alice", "reminders": ["3600s", "900s"], "attendees": [{"userId": "bob", "status": "pending"}]
+		}}`))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL+"/", WithUserHeader("X-User-ID", "alice"))
+	event, err := c.CreateEvent(context.Background(), Event{
+		Title:     "meeting",
+		StartAt:   start,
+		EndAt:     start.Add(time.Hour),
+		Reminders: []time.Duration{time.Hour, 15 * time.Minute},
+		Attendees: []Attendee{{UserID: "bob"}},
+	}, "key-1")
+	require.NoError(t, err)
+	require.Equal(t, Event{
+		ID:        "1",
+		Title:     "meeting",
+		StartAt:   start,
+		EndAt:     start.Add(time.Hour),
+		UserID:    "alice",
+		Reminders: []time.Duration{time.Hour, 15 * time.Minute},
+		Attendees: []Attendee{{UserID: "bob", Status: RSVPPending}},
+	}, event)
+}
+
+func TestSettings(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		require.Equal(t, "/v1/settings", r.URL.Path)
+
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.JSONEq(t, `{
+			"conflictPolicy": "allow",
+			"workingHours": {"days": ["monday", "friday"], "start": "32400s", "end": "64800s", "timeZone": "Europe/Moscow"},
+			"digest": {"enabled": true}
+		}`, string(data))
+		_, _ = w.Write(data)
+	}))
+	defer ts.Close()
+
+	settings := Settings{
+		ConflictPolicy: ConflictAllow,
+		WorkingHours: &WorkingHours{
+			Days:     []time.Weekday{time.Monday, time.Friday},
+			Start:    9 * time.Hour,
+			End:      18 * time.Hour,
+			TimeZone: "Europe/Moscow",
+		},
+		Digest: &Digest{},
+	}
+	updated, err := New(ts.URL).UpdateSettings(context.Background(), settings)
+	require.NoError(t, err)
+	require.Equal(t, settings, updated)
+}
+
+func TestApplyBatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/events/batch", r.URL.Path)
+		require.Equal(t, "best_effort", r.Header.Get("Batch-Mode"))
+
+		// The operations are streamed one per line.
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		require.Len(t, lines, 2)
+		require.JSONEq(t, `{"update": {"id": "1", "event": {
+			"title": "moved", "startAt": "2022-06-01T10:00:00Z", "endAt": "2022-06-01T11:00:00Z", "noReminders": true
+		}}}`, lines[0])
+		require.JSONEq(t, `{"delete": {"id": "2"}}`, lines[1])
+
+		_, _ = w.Write([]byte(`{"applied": 1, "results": [
+			{"status": "applied", "code": "OK", "event": {"id": "1", "title": "moved"}},
+			{"index": 1, "status": "failed", "code": "NotFound", "error": "event not found"}
+		]}`))
+	}))
+	defer ts.Close()
+
+	report, err := New(ts.URL).ApplyBatch(context.Background(), BatchBestEffort,
+		UpdateOp("1", Event{Title: "moved", StartAt: start, EndAt: start.Add(time.Hour), Reminders: []time.Duration{}}),
+		DeleteOp("2"))
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Applied)
+	require.Equal(t, "1", report.Results[0].Event.ID)
+	require.Equal(t, BatchResult{Index: 1, Status: "failed", Code: "NotFound", Error: "event not found"},
+		report.Results[1])
+}
+
+func TestErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/v1/events/day":
+			require.Equal(t, "2022-06-01T00:00:00Z", r.URL.Query().Get("date"))
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"code": 8, "message": "rate limit exceeded"}`))
+		case "/v1/events":
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"code": 9, "message": "date is busy"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code": 5, "message": "event not found"}`))
+		}
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, WithBearerToken("token"))
+
+	err := c.DeleteEvent(context.Background(), "1")
+	require.True(t, IsNotFound(err))
+	require.EqualError(t, err, "404 Not Found: event not found")
+
+	// The day of the date is taken as it is in its location.
+	_, err = c.ListDayEvents(context.Background(), time.Date(2022, time.June, 1, 1, 0, 0, 0, time.FixedZone("", 3*3600)))
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	require.Equal(t, codes.ResourceExhausted, apiErr.Code)
+	require.Equal(t, 2*time.Second, apiErr.RetryAfter)
+	require.False(t, IsConflict(err))
+
+	// The conflict is told by the gRPC code.
+	_, err = c.CreateEvent(context.Background(), Event{Title: "overlap", StartAt: start, EndAt: start.Add(time.Hour)}, "")
+	require.True(t, IsConflict(err))
+}
+
+func TestWithTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/events/1", r.URL.Path)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	err := New(ts.URL).DeleteEvent(context.Background(), "1")
+	require.Error(t, err, "the test server certificate isn't trusted by the system")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	c := New(ts.URL, WithTLS(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}))
+	require.NoError(t, c.DeleteEvent(context.Background(), "1"))
+}
@@ -0,0 +1,67 @@
+package calendarclient
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// APIError is returned for responses with an error status. Check the error with the helpers below
+// or with errors.As.
+type APIError struct {
+	StatusCode int
+	// Code is the gRPC status code of the call the request was transcoded to, HTTP and gRPC clients
+	// get the same one.
+	Code       codes.Code
+	Message    string
+	RetryAfter time.Duration // Set for 429 Too Many Requests.
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return http.StatusText(e.StatusCode)
+	}
+	return strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode) + ": " + e.Message
+}
+
+func IsNotFound(err error) bool {
+	return hasCode(err, codes.NotFound)
+}
+
+// IsConflict reports whether the event time is already taken by another event of the user,
+// or the event already exists.
+func IsConflict(err error) bool {
+	return hasCode(err, codes.FailedPrecondition) || hasCode(err, codes.AlreadyExists)
+}
+
+func IsForbidden(err error) bool {
+	return hasCode(err, codes.PermissionDenied)
+}
+
+func hasCode(err error, code codes.Code) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+
+	// The body is the google.rpc.Status of the call.
+	var body struct {
+		Code    codes.Code `json:"code"`
+		Message string     `json:"message"`
+	}
+	if data, err := io.ReadAll(resp.Body); err == nil && json.Unmarshal(data, &body) == nil {
+		apiErr.Code = body.Code
+		apiErr.Message = body.Message
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
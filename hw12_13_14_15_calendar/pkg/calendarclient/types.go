@@ -0,0 +1,367 @@
+package calendarclient
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/pkg/eventpb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type RSVPStatus string
+
+const (
+	RSVPPending   RSVPStatus = "pending"
+	RSVPAccepted  RSVPStatus = "accepted"
+	RSVPDeclined  RSVPStatus = "declined"
+	RSVPTentative RSVPStatus = "tentative"
+)
+
+type AccessLevel string
+
+const (
+	AccessRead  AccessLevel = "read"
+	AccessWrite AccessLevel = "write"
+)
+
+// Share grants the user access to the calendar of the owner.
+type Share struct {
+	OwnerID string
+	UserID  string
+	Level   AccessLevel
+}
+
+// Tag is an entry of the tag vocabulary of the user, names are stored lowercase.
+type Tag struct {
+	Name  string
+	Color string // #rrggbb.
+}
+
+type ConflictPolicy string
+
+const (
+	ConflictReject         ConflictPolicy = "reject"
+	ConflictAllow          ConflictPolicy = "allow"
+	ConflictAllowTentative ConflictPolicy = "allow_tentative"
+)
+
+// Settings are the preferences of the user. ConflictPolicy decides whether events of the user may overlap,
+// DefaultReminders are given to the events created or updated without reminders. Without WorkingHours
+// the user is available at any time, without Digest the user gets no daily digest.
+type Settings struct {
+	ConflictPolicy   ConflictPolicy
+	DefaultReminders []time.Duration
+	WorkingHours     *WorkingHours
+	Digest           *Digest
+}
+
+// WorkingHours are the hours of the working days the user is available at.
+type WorkingHours struct {
+	Days     []time.Weekday
+	Start    time.Duration // Since midnight.
+	End      time.Duration // Up to 24h.
+	TimeZone string        // IANA name, UTC if empty.
+}
+
+// Digest opts the user in to the daily digest of the day's events, sent at the time of day
+// the scheduler is configured with in the time zone.
+type Digest struct {
+	TimeZone string // IANA name, UTC if empty.
+}
+
+type EventKind string
+
+const (
+	EventRegular     EventKind = "regular"
+	EventOutOfOffice EventKind = "out_of_office" // Declines the overlapping invitations of the owner.
+)
+
+// Event mirrors the Event message, its JSON form is the one of the message too. ID, attendee statuses,
+// DeletedAt and OutsideWorkingHours are set by the calendar and ignored in requests. UserID of a new event
+// selects the calendar to create it in, the user's own by default.
+type Event struct {
+	ID          string
+	Title       string
+	StartAt     time.Time
+	EndAt       time.Time
+	Description string
+	UserID      string
+	Kind        EventKind       // Regular if empty.
+	Category    string          // Free-form, like work or family.
+	Color       string          // #rrggbb.
+	Tags        []string        // Names from the tag vocabulary of the owner, see Client.SaveTag.
+	Reminders   []time.Duration // Nil means the default reminders of the owner, empty means none.
+	Attendees   []Attendee
+	Tentative   bool
+	DeletedAt   time.Time // Zero unless the event is in the trash.
+	// OutsideWorkingHours is set in list responses for the events outside the user's working hours.
+	OutsideWorkingHours bool
+}
+
+type Attendee struct {
+	UserID string
+	Status RSVPStatus
+}
+
+type AuditRecord struct {
+	EventID string
+	Action  string
+	ActorID string
+	At      time.Time
+	Changes []FieldChange
+}
+
+// FieldChange holds the old and new value of an event field in its text form, empty when the field is not set.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+type BatchMode string
+
+const (
+	BatchAtomic     BatchMode = "atomic"      // Nothing is applied if any operation fails.
+	BatchBestEffort BatchMode = "best_effort" // Only the failed operations are skipped.
+)
+
+// BatchOperation is an operation of ApplyBatch, see CreateOp, UpdateOp and DeleteOp.
+type BatchOperation struct {
+	op *eventpb.BatchOperation
+}
+
+func CreateOp(event Event) BatchOperation {
+	return BatchOperation{op: &eventpb.BatchOperation{Op: &eventpb.BatchOperation_Create{
+		Create: &eventpb.CreateEventRequest{Event: toEventPB(event)},
+	}}}
+}
+
+func UpdateOp(id string, event Event) BatchOperation {
+	return BatchOperation{op: &eventpb.BatchOperation{Op: &eventpb.BatchOperation_Update{
+		Update: &eventpb.UpdateEventRequest{Id: id, Event: toEventPB(event)},
+	}}}
+}
+
+func DeleteOp(id string) BatchOperation {
+	return BatchOperation{op: &eventpb.BatchOperation{Op: &eventpb.BatchOperation_Delete{
+		Delete: &eventpb.DeleteEventRequest{Id: id},
+	}}}
+}
+
+func (o BatchOperation) toPB() *eventpb.BatchOperation {
+	if o.op == nil {
+		// The zero operation is rejected by the calendar as of unknown kind.
+		return &eventpb.BatchOperation{}
+	}
+	return o.op
+}
+
+type BatchReport struct {
+	Applied int
+	Results []BatchResult
+}
+
+// BatchResult reports an operation of the batch. Status is applied, failed or aborted when another operation
+// failed in the atomic mode, Code is the name of the gRPC status code the operation would get as a separate
+// call, e.g. OK or NotFound.
+type BatchResult struct {
+	Index  int
+	Status string
+	Code   string
+	Error  string
+	Event  *Event
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	return protojson.Marshal(toEventPB(e))
+}
+
+func (e *Event) UnmarshalJSON(data []byte) error {
+	pb := &eventpb.Event{}
+	if err := protojson.Unmarshal(data, pb); err != nil {
+		return err
+	}
+	*e = fromEventPB(pb)
+	return nil
+}
+
+func toEventPB(event Event) *eventpb.Event {
+	pb := &eventpb.Event{
+		Id:          event.ID,
+		Title:       event.Title,
+		StartAt:     timestamppb.New(event.StartAt),
+		EndAt:       timestamppb.New(event.EndAt),
+		Description: event.Description,
+		UserId:      event.UserID,
+		Kind:        string(event.Kind),
+		Category:    event.Category,
+		Color:       event.Color,
+		Tags:        event.Tags,
+		Reminders:   toDurationsPB(event.Reminders),
+		NoReminders: event.Reminders != nil && len(event.Reminders) == 0,
+		Tentative:   event.Tentative,
+
+		OutsideWorkingHours: event.OutsideWorkingHours,
+	}
+	if !event.DeletedAt.IsZero() {
+		pb.DeletedAt = timestamppb.New(event.DeletedAt)
+	}
+	for _, a := range event.Attendees {
+		pb.Attendees = append(pb.Attendees, &eventpb.Attendee{UserId: a.UserID, Status: string(a.Status)})
+	}
+	return pb
+}
+
+func fromEventPB(pb *eventpb.Event) Event {
+	event := Event{
+		ID:          pb.GetId(),
+		Title:       pb.GetTitle(),
+		StartAt:     pb.GetStartAt().AsTime(),
+		EndAt:       pb.GetEndAt().AsTime(),
+		Description: pb.GetDescription(),
+		UserID:      pb.GetUserId(),
+		Kind:        EventKind(pb.GetKind()),
+		Category:    pb.GetCategory(),
+		Color:       pb.GetColor(),
+		Tags:        pb.GetTags(),
+		Reminders:   fromDurationsPB(pb.GetReminders()),
+		Tentative:   pb.GetTentative(),
+
+		OutsideWorkingHours: pb.GetOutsideWorkingHours(),
+	}
+	if event.Reminders == nil && pb.GetNoReminders() {
+		event.Reminders = []time.Duration{}
+	}
+	if pb.GetDeletedAt() != nil {
+		event.DeletedAt = pb.GetDeletedAt().AsTime()
+	}
+	for _, a := range pb.GetAttendees() {
+		event.Attendees = append(event.Attendees, Attendee{UserID: a.GetUserId(), Status: RSVPStatus(a.GetStatus())})
+	}
+	return event
+}
+
+func fromEventsPB(pbs []*eventpb.Event) []Event {
+	events := make([]Event, 0, len(pbs))
+	for _, pb := range pbs {
+		events = append(events, fromEventPB(pb))
+	}
+	return events
+}
+
+func fromAuditRecordPB(pb *eventpb.AuditRecord) AuditRecord {
+	record := AuditRecord{
+		EventID: pb.GetEventId(),
+		Action:  pb.GetAction(),
+		ActorID: pb.GetActorId(),
+		At:      pb.GetAt().AsTime(),
+		Changes: make([]FieldChange, 0, len(pb.GetChanges())),
+	}
+	for _, c := range pb.GetChanges() {
+		record.Changes = append(record.Changes, FieldChange{Field: c.GetField(), Old: c.GetOld(), New: c.GetNew()})
+	}
+	return record
+}
+
+func fromSharePB(pb *eventpb.Share) Share {
+	return Share{OwnerID: pb.GetOwnerId(), UserID: pb.GetUserId(), Level: AccessLevel(pb.GetLevel())}
+}
+
+func fromBatchReportPB(pb *eventpb.BatchEventsResponse) BatchReport {
+	report := BatchReport{
+		Applied: int(pb.GetApplied()),
+		Results: make([]BatchResult, 0, len(pb.GetResults())),
+	}
+	for _, r := range pb.GetResults() {
+		result := BatchResult{Index: int(r.GetIndex()), Status: r.GetStatus(), Code: r.GetCode(), Error: r.GetError()}
+		if r.GetEvent() != nil {
+			event := fromEventPB(r.GetEvent())
+			result.Event = &event
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+func toSettingsPB(settings Settings) *eventpb.Settings {
+	pb := &eventpb.Settings{
+		ConflictPolicy:   string(settings.ConflictPolicy),
+		DefaultReminders: toDurationsPB(settings.DefaultReminders),
+	}
+	if h := settings.WorkingHours; h != nil {
+		pb.WorkingHours = &eventpb.WorkingHours{
+			Start:    durationpb.New(h.Start),
+			End:      durationpb.New(h.End),
+			TimeZone: h.TimeZone,
+		}
+		for _, day := range h.Days {
+			pb.WorkingHours.Days = append(pb.WorkingHours.Days, strings.ToLower(day.String()))
+		}
+	}
+	if d := settings.Digest; d != nil {
+		pb.Digest = &eventpb.Digest{Enabled: true, TimeZone: d.TimeZone}
+	}
+	return pb
+}
+
+func fromSettingsPB(pb *eventpb.Settings) (Settings, error) {
+	settings := Settings{
+		ConflictPolicy:   ConflictPolicy(pb.GetConflictPolicy()),
+		DefaultReminders: fromDurationsPB(pb.GetDefaultReminders()),
+	}
+	if pb.GetDigest().GetEnabled() {
+		settings.Digest = &Digest{TimeZone: pb.GetDigest().GetTimeZone()}
+	}
+	if pb.GetWorkingHours() == nil {
+		return settings, nil
+	}
+
+	h := &WorkingHours{
+		Start:    pb.GetWorkingHours().GetStart().AsDuration(),
+		End:      pb.GetWorkingHours().GetEnd().AsDuration(),
+		TimeZone: pb.GetWorkingHours().GetTimeZone(),
+	}
+	for _, name := range pb.GetWorkingHours().GetDays() {
+		day, err := parseWeekday(name)
+		if err != nil {
+			return Settings{}, fmt.Errorf("workingHours.days: %w", err)
+		}
+		h.Days = append(h.Days, day)
+	}
+	settings.WorkingHours = h
+	return settings, nil
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.ToLower(day.String()) == name {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q", name)
+}
+
+func toDurationsPB(durations []time.Duration) []*durationpb.Duration {
+	if durations == nil {
+		return nil
+	}
+	pbs := make([]*durationpb.Duration, 0, len(durations))
+	for _, d := range durations {
+		pbs = append(pbs, durationpb.New(d))
+	}
+	return pbs
+}
+
+func fromDurationsPB(pbs []*durationpb.Duration) []time.Duration {
+	if len(pbs) == 0 {
+		return nil
+	}
+	durations := make([]time.Duration, 0, len(pbs))
+	for _, pb := range pbs {
+		durations = append(durations, pb.AsDuration())
+	}
+	return durations
+}
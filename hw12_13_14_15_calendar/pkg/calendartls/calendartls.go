@@ -0,0 +1,289 @@
+// Package calendartls builds the TLS configurations of the calendar servers and their clients
+// from PEM files. Certificates are reloaded when their files change, so rotating them needs no restart.
+//
+// The configurations are used as they are by net/http, and by gRPC through credentials.NewTLS:
+//
+//	cfg, err := calendartls.ClientConfig{CAFile: "ca.pem"}.TLSConfig()
+//	...
+//	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
+//	client := eventpb.NewEventServiceClient(conn)
+package calendartls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrNoCertificates = errors.New("no certificates found")
+
+// ServerConfig enables TLS on a server. With ClientCAFile set, clients have to present
+// a certificate issued by one of its CAs. The CA file is reloaded once modified, like the certificate.
+type ServerConfig struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	// OnReloadError, if set, is called when a modified file fails to load. The previous certificate
+	// or CAs stay in use until the file is modified again.
+	OnReloadError func(err error)
+}
+
+// Enabled reports whether the server should listen with TLS, i.e. the certificate is set.
+func (c ServerConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// TLSConfig loads the certificate, failing if it can't be loaded now rather than on the first handshake.
+// The config offers both HTTP/2 and HTTP/1.1. With the client CA set, every handshake uses a copy
+// of the returned config with the current CAs, so the config must not be changed once in use,
+// and changes made to its clones, e.g. by net/http, are lost.
+func (c ServerConfig) TLSConfig() (*tls.Config, error) {
+	certificate, err := newReloader(c.CertFile, c.KeyFile, c.OnReloadError)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: certificate.GetCertificate,
+	}
+	if c.ClientCAFile != "" {
+		clientCAs, err := newPoolReloader(c.ClientCAFile, c.OnReloadError)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = clientCAs.Pool()
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			connCfg := cfg.Clone()
+			connCfg.GetConfigForClient = nil
+			connCfg.ClientCAs = clientCAs.Pool()
+			return connCfg, nil
+		}
+	}
+	return cfg, nil
+}
+
+// ClientConfig verifies the server by the CAs in CAFile, or by the system ones if it is empty.
+// The CA file is reloaded once modified, like the certificate, which, if set, is presented to servers
+// verifying their clients. ServerName overrides the name the server certificate is checked against,
+// which is the host dialed by default.
+type ClientConfig struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+	// OnReloadError is called when a modified file fails to load, as the one of ServerConfig.
+	OnReloadError func(err error)
+}
+
+// TLSConfig loads the files, failing if they can't be loaded now rather than on the first handshake.
+// With the CA file set, the server is verified by VerifyConnection against the current CAs
+// instead of by RootCAs, so InsecureSkipVerify is set and must stay so. VerifyConnection doesn't learn
+// the IP address dialed, so ServerName has to be set to dial one, e.g. to the address itself.
+func (c ClientConfig) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+	if c.CAFile != "" {
+		rootCAs, err := newPoolReloader(c.CAFile, c.OnReloadError)
+		if err != nil {
+			return nil, err
+		}
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			// The name is only known here when sent in SNI, which IP addresses are not.
+			if cs.ServerName == "" {
+				cs.ServerName = c.ServerName
+			}
+			return verifyServer(cs, rootCAs.Pool())
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		certificate, err := newReloader(c.CertFile, c.KeyFile, c.OnReloadError)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = certificate.GetClientCertificate
+	}
+	return cfg, nil
+}
+
+// verifyServer does what crypto/tls does to verify the server unless InsecureSkipVerify is set,
+// with the given CAs.
+func verifyServer(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server sent no certificate")
+	}
+	if cs.ServerName == "" {
+		return errors.New("tls: no server name to verify the certificate against, set ServerName to dial an IP address")
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// Reloader keeps the certificate loaded from the files and loads it again once any of them
+// is modified. The files are checked on every handshake. A pair failing to load, e.g. a certificate
+// already replaced while its key is not yet, keeps the previous one in use until the files change again.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	onError  func(err error)
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modTimes    [2]time.Time
+	// failedModTimes are those of the files that failed to load, they are not loaded again.
+	failedModTimes [2]time.Time
+}
+
+// NewReloader fails if the certificate can't be loaded.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	return newReloader(certFile, keyFile, nil)
+}
+
+// newReloader calls onError, if set, when the modified files fail to load.
+func newReloader(certFile, keyFile string, onError func(err error)) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, onError: onError}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// Certificate returns the certificate, loading it again first if the files changed.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes, err := r.stat()
+	if err == nil && modTimes != r.modTimes && modTimes != r.failedModTimes {
+		if err := r.reloadLocked(); err != nil {
+			r.failedModTimes = modTimes
+			if r.onError != nil {
+				r.onError(err)
+			}
+		}
+	}
+	return r.certificate
+}
+
+func (r *Reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.reloadLocked()
+}
+
+func (r *Reloader) reloadLocked() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate %s: %w", r.certFile, err)
+	}
+	r.certificate = &certificate
+	r.modTimes = modTimes
+	return nil
+}
+
+// poolReloader keeps the CA pool loaded from the file and loads it again once the file is modified.
+// A file failing to load keeps the previous pool in use, as Reloader does.
+type poolReloader struct {
+	name    string
+	onError func(err error)
+
+	mu            sync.Mutex
+	pool          *x509.CertPool
+	modTime       time.Time
+	failedModTime time.Time
+}
+
+func newPoolReloader(name string, onError func(err error)) (*poolReloader, error) {
+	r := &poolReloader{name: name, onError: onError}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.reloadLocked(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Pool returns the CA pool, loading it again first if the file changed.
+func (r *poolReloader) Pool() *x509.CertPool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, err := os.Stat(r.name)
+	if err == nil && !info.ModTime().Equal(r.modTime) && !info.ModTime().Equal(r.failedModTime) {
+		if err := r.reloadLocked(); err != nil {
+			r.failedModTime = info.ModTime()
+			if r.onError != nil {
+				r.onError(err)
+			}
+		}
+	}
+	return r.pool
+}
+
+func (r *poolReloader) reloadLocked() error {
+	info, err := os.Stat(r.name)
+	if err != nil {
+		return err
+	}
+	pool, err := loadCertPool(r.name)
+	if err != nil {
+		return err
+	}
+	r.pool = pool
+	r.modTime = info.ModTime()
+	return nil
+}
+
+func (r *Reloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func loadCertPool(name string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w in %s", ErrNoCertificates, name)
+	}
+	return pool, nil
+}
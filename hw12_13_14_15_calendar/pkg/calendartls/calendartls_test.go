@@ -0,0 +1,200 @@
+package calendartls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tlstest"
+	"github.com/stretchr/testify/require"
+)
+
+// serve answers with the common name of the client certificate.
+func serve(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	})}
+	go func() {
+		_ = server.Serve(tls.NewListener(lis, cfg))
+	}()
+	t.Cleanup(func() { _ = server.Close() })
+	return "https://" + lis.Addr().String()
+}
+
+// get returns the serial number of the server certificate.
+func get(t *testing.T, url string, cfg *tls.Config) (int64, error) {
+	t.Helper()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, DisableKeepAlives: true}}
+	resp, err := client.Get(url) //nolint:noctx
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func TestServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca, files := tlstest.WriteFiles(t, dir)
+
+	var reloadErrs int32
+	serverCfg, err := ServerConfig{
+		CertFile: files.ServerCert, KeyFile: files.ServerKey,
+		OnReloadError: func(err error) { atomic.AddInt32(&reloadErrs, 1) },
+	}.TLSConfig()
+	require.NoError(t, err)
+	url := serve(t, serverCfg)
+
+	_, err = get(t, url, &tls.Config{MinVersion: tls.VersionTLS12})
+	require.Error(t, err, "the server is verified by the CA")
+	// The IP address dialed is checked only if set as the server name.
+	clientCfg, err := ClientConfig{CAFile: files.CA}.TLSConfig()
+	require.NoError(t, err)
+	_, err = get(t, url, clientCfg)
+	require.Error(t, err)
+	clientCfg, err = ClientConfig{CAFile: files.CA, ServerName: "127.0.0.1"}.TLSConfig()
+	require.NoError(t, err)
+	serial, err := get(t, url, clientCfg)
+	require.NoError(t, err)
+
+	// The rotated certificate is used by the next connection.
+	rotated := ca.Issue(t, "localhost", x509.ExtKeyUsageServerAuth, files.ServerCert, files.ServerKey)
+	require.NotEqual(t, serial, rotated)
+	serial, err = get(t, url, clientCfg)
+	require.NoError(t, err)
+	require.Equal(t, rotated, serial)
+
+	// A broken pair keeps the previous certificate in use and is reported once.
+	require.NoError(t, os.WriteFile(files.ServerKey, []byte("garbage"), 0o600))
+	for i := 0; i < 2; i++ {
+		serial, err = get(t, url, clientCfg)
+		require.NoError(t, err)
+		require.Equal(t, rotated, serial)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&reloadErrs))
+}
+
+func TestServerCARotation(t *testing.T) {
+	dir := t.TempDir()
+	_, files := tlstest.WriteFiles(t, dir)
+	serverCfg, err := ServerConfig{CertFile: files.ServerCert, KeyFile: files.ServerKey}.TLSConfig()
+	require.NoError(t, err)
+	url := serve(t, serverCfg)
+
+	clientCfg, err := ClientConfig{CAFile: files.CA, ServerName: "localhost"}.TLSConfig()
+	require.NoError(t, err)
+	_, err = get(t, url, clientCfg)
+	require.NoError(t, err)
+
+	// The client trusts only the server certificates of the rotated CA from the next connection on.
+	newCA := tlstest.NewCA(t, files.CA)
+	_, err = get(t, url, clientCfg)
+	require.Error(t, err)
+	serial := newCA.Issue(t, "localhost", x509.ExtKeyUsageServerAuth, files.ServerCert, files.ServerKey)
+	got, err := get(t, url, clientCfg)
+	require.NoError(t, err)
+	require.Equal(t, serial, got)
+
+	// A broken file keeps the rotated CA in use.
+	require.NoError(t, os.WriteFile(files.CA, []byte("garbage"), 0o600))
+	_, err = get(t, url, clientCfg)
+	require.NoError(t, err)
+}
+
+func TestMutualTLS(t *testing.T) {
+	_, files := tlstest.WriteFiles(t, t.TempDir())
+
+	serverCfg, err := ServerConfig{
+		CertFile: files.ServerCert, KeyFile: files.ServerKey, ClientCAFile: files.CA,
+	}.TLSConfig()
+	require.NoError(t, err)
+	url := serve(t, serverCfg)
+
+	anonymous, err := ClientConfig{CAFile: files.CA, ServerName: "localhost"}.TLSConfig()
+	require.NoError(t, err)
+	_, err = get(t, url, anonymous)
+	require.Error(t, err)
+
+	clientCfg, err := ClientConfig{
+		CAFile: files.CA, CertFile: files.ClientCert, KeyFile: files.ClientKey, ServerName: "localhost",
+	}.TLSConfig()
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+	resp, err := client.Get(url) //nolint:noctx
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "alice", string(body))
+}
+
+func TestClientCARotation(t *testing.T) {
+	dir := t.TempDir()
+	_, files := tlstest.WriteFiles(t, dir)
+	serverCfg, err := ServerConfig{
+		CertFile: files.ServerCert, KeyFile: files.ServerKey, ClientCAFile: files.CA,
+	}.TLSConfig()
+	require.NoError(t, err)
+	url := serve(t, serverCfg)
+
+	// The clients verify the server by a copy of the CA, the file of the server is rotated below.
+	serverCA, err := os.ReadFile(files.CA)
+	require.NoError(t, err)
+	serverCAFile := filepath.Join(dir, "server-ca.pem")
+	require.NoError(t, os.WriteFile(serverCAFile, serverCA, 0o600))
+	oldClient, err := ClientConfig{
+		CAFile: serverCAFile, CertFile: files.ClientCert, KeyFile: files.ClientKey, ServerName: "localhost",
+	}.TLSConfig()
+	require.NoError(t, err)
+	_, err = get(t, url, oldClient)
+	require.NoError(t, err)
+
+	// The server trusts only the clients of the rotated CA from the next connection on.
+	newCA := tlstest.NewCA(t, files.CA)
+	newCert, newKey := filepath.Join(dir, "new-client.pem"), filepath.Join(dir, "new-client-key.pem")
+	newCA.Issue(t, "bob", x509.ExtKeyUsageClientAuth, newCert, newKey)
+	newClient, err := ClientConfig{
+		CAFile: serverCAFile, CertFile: newCert, KeyFile: newKey, ServerName: "localhost",
+	}.TLSConfig()
+	require.NoError(t, err)
+	_, err = get(t, url, newClient)
+	require.NoError(t, err)
+	_, err = get(t, url, oldClient)
+	require.Error(t, err)
+
+	// A broken file keeps the rotated CA in use.
+	require.NoError(t, os.WriteFile(files.CA, []byte("garbage"), 0o600))
+	_, err = get(t, url, newClient)
+	require.NoError(t, err)
+}
+
+func TestConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, files := tlstest.WriteFiles(t, dir)
+
+	_, err := ServerConfig{CertFile: files.ServerCert, KeyFile: files.ClientKey}.TLSConfig()
+	require.Error(t, err, "the key doesn't match")
+	_, err = ServerConfig{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: files.ServerKey}.TLSConfig()
+	require.Error(t, err)
+
+	empty := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(empty, nil, 0o600))
+	_, err = ClientConfig{CAFile: empty}.TLSConfig()
+	require.ErrorIs(t, err, ErrNoCertificates)
+
+	require.False(t, ServerConfig{ClientCAFile: files.CA}.Enabled())
+	require.True(t, ServerConfig{CertFile: files.ServerCert, KeyFile: files.ServerKey}.Enabled())
+}
@@ -0,0 +1,4 @@
+package eventpb
+
+// The google/api annotations are copied from googleapis into the api directory.
+//go:generate protoc -I ../../api --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative --grpc-gateway_out=. --grpc-gateway_opt=paths=source_relative ../../api/EventService.proto